@@ -0,0 +1,67 @@
+package techdetect
+
+import (
+	"sort"
+	"strings"
+)
+
+// AnyField is the field path matching a condition against every field of the response
+// in turn: the body, the final URL, each header and each cookie
+const AnyField = "any"
+
+// anyFields lists the fields "any" stands for, in the order they are tried
+func (ctx *DetectionContext) anyFields() []string {
+	fields := []string{"body", "url"}
+
+	headers := make([]string, 0, len(ctx.Headers))
+	for name := range ctx.Headers {
+		headers = append(headers, "headers."+strings.ToLower(name))
+	}
+	sort.Strings(headers)
+
+	cookies := ctx.cookies()
+	names := make([]string, 0, len(cookies))
+	for name := range cookies {
+		names = append(names, "cookies."+name)
+	}
+	sort.Strings(names)
+
+	return append(append(fields, headers...), names...)
+}
+
+// evaluateAny evaluates a condition on "any" (with its transforms, e.g. "any|base64decode")
+// against each field of the response, and returns the first field that satisfies it
+func (qe *QueryEvaluator) evaluateAny(transforms []string, condition interface{}, ctx *DetectionContext) (bool, string, string) {
+	suffix := ""
+	if len(transforms) > 0 {
+		suffix = "|" + strings.Join(transforms, "|")
+	}
+	for _, field := range ctx.anyFields() {
+		if match, version := qe.evaluateField(field+suffix, condition, ctx); match {
+			return true, version, field + suffix
+		}
+	}
+	return false, "", ""
+}
+
+// anyHaystack joins the values of every field "any" stands for by newlines, the value of
+// "any" where a single text is needed, such as extraction rules
+func (qe *QueryEvaluator) anyHaystack(ctx *DetectionContext) (interface{}, bool) {
+	var values []string
+	for _, field := range ctx.anyFields() {
+		if value := qe.getFieldValue(field, ctx); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+	return strings.Join(values, "\n"), true
+}
+
+// isAnyField checks if a field path is "any", possibly with transforms; inside
+// $elemMatch it names an element key instead
+func isAnyField(fieldPath string, ctx *DetectionContext) ([]string, bool) {
+	base, transforms := splitTransforms(fieldPath)
+	return transforms, base == AnyField && !ctx.inElement
+}
@@ -0,0 +1,198 @@
+package techdetect
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ApexCounterpart returns the www/apex counterpart of a URL: https://www.example.com/x
+// for https://example.com/x and vice versa. ok is false for IP addresses and for hosts
+// that are neither an apex domain nor its www subdomain, e.g. shop.example.com.
+func ApexCounterpart(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) != nil {
+		return "", false
+	}
+
+	apex, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimPrefix(host, "www."))
+	if err != nil {
+		return "", false
+	}
+
+	var counterpart string
+	switch host {
+	case apex:
+		counterpart = "www." + apex
+	case "www." + apex:
+		counterpart = apex
+	default:
+		return "", false
+	}
+
+	if port := u.Port(); port != "" {
+		counterpart = net.JoinHostPort(counterpart, port)
+	}
+	u.Host = counterpart
+	return u.String(), true
+}
+
+// AnalyzeWithApex analyzes a URL and its www/apex counterpart (see ApexCounterpart) and
+// merges both reports, since a CMS is sometimes only detectable on the canonical host.
+// Each technology lists the hosts it was found on. A URL that fails outright is replaced
+// by its counterpart; ErrURLDeadline on either side is returned with the merged report.
+func (d *Detector) AnalyzeWithApex(ctx context.Context, url string, useBrowser bool) (*Report, error) {
+	report, err := d.Analyze(ctx, url, useBrowser)
+
+	counterpartURL, ok := ApexCounterpart(url)
+	if !ok || ctx.Err() != nil {
+		return report, err
+	}
+	counterpart, counterpartErr := d.Analyze(ctx, counterpartURL, useBrowser)
+	if counterpart == nil {
+		return report, err
+	}
+	if report == nil {
+		// Only the counterpart answered; report it under the requested URL
+		counterpart.URL = url
+		setHosts(counterpart, counterpartURL)
+		return counterpart, counterpartErr
+	}
+
+	if err == nil {
+		err = counterpartErr
+	}
+	return MergeReports(report, counterpart), err
+}
+
+// MergeReports combines the reports of two URLs of the same site into one, keyed by the
+// first report's URL. Technologies found on both are merged (versions, sources, highest
+// confidence), and every technology lists the hosts it was found on. Only paths that
+// failed on both count as failed.
+func MergeReports(primary, secondary *Report) *Report {
+	merged := *primary
+	merged.Technologies = nil
+	merged.FailedPaths = nil
+	for _, path := range primary.FailedPaths {
+		// Only paths neither host answered count as failed
+		for _, other := range secondary.FailedPaths {
+			if path == other {
+				merged.FailedPaths = append(merged.FailedPaths, path)
+				break
+			}
+		}
+	}
+	merged.TLSInvalid = primary.TLSInvalid || secondary.TLSInvalid
+	merged.Duration = primary.Duration + secondary.Duration
+	merged.Explain = append(append([]Explanation(nil), primary.Explain...), secondary.Explain...)
+	if len(secondary.Headers) > 0 {
+		merged.Headers = make(map[string]map[string]string, len(primary.Headers)+len(secondary.Headers))
+		for _, source := range []*Report{primary, secondary} {
+			for probeURL, headers := range source.Headers {
+				merged.Headers[probeURL] = headers
+			}
+		}
+	}
+
+	index := make(map[string]int)
+	for _, source := range []*Report{primary, secondary} {
+		host := resultHost(source.URL)
+		for _, tech := range source.Technologies {
+			tech.Hosts = []string{host}
+			i, seen := index[tech.Name]
+			if !seen {
+				index[tech.Name] = len(merged.Technologies)
+				merged.Technologies = append(merged.Technologies, tech)
+				continue
+			}
+			mergeReportTechnology(&merged.Technologies[i], tech)
+		}
+	}
+
+	sort.Slice(merged.Technologies, func(i, j int) bool {
+		return merged.Technologies[i].Name < merged.Technologies[j].Name
+	})
+	merged.CategoryConfidence = categoryConfidence(merged.Technologies)
+	return &merged
+}
+
+// mergeReportTechnology folds another detection of the same technology into dst
+func mergeReportTechnology(dst *ReportTechnology, other ReportTechnology) {
+	tech := Technology{Name: dst.Name, Version: dst.Version, Versions: append([]string(nil), dst.Versions...)}
+	if len(tech.Versions) == 0 && tech.Version != "" {
+		tech.Versions = []string{tech.Version}
+	}
+	tech.addVersion(other.Version)
+	for _, v := range other.Versions {
+		tech.addVersion(v)
+	}
+	dst.Version = tech.Version
+	dst.Versions = tech.Versions
+
+	for name, value := range other.Metadata {
+		if _, exists := dst.Metadata[name]; !exists {
+			if dst.Metadata == nil {
+				dst.Metadata = make(map[string]string)
+			}
+			dst.Metadata[name] = value
+		}
+	}
+
+	dst.Sources = mergeStrings(dst.Sources, other.Sources)
+	dst.Hosts = mergeStrings(dst.Hosts, other.Hosts)
+	if other.Confidence > dst.Confidence {
+		dst.Confidence = other.Confidence
+	}
+}
+
+// mergeStrings appends the values of b missing from a
+func mergeStrings(a, b []string) []string {
+	merged := append([]string(nil), a...)
+	for _, value := range b {
+		found := false
+		for _, existing := range merged {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
+
+// setHosts records the host every technology of a report was found on
+func setHosts(report *Report, rawURL string) {
+	host := resultHost(rawURL)
+	for i := range report.Technologies {
+		report.Technologies[i].Hosts = []string{host}
+	}
+}
+
+// registrableDomain returns the effective TLD+1 of a URL's host, lowercased: shop.example.co.uk
+// gives example.co.uk. ok is false for IP addresses and hosts that are a public suffix.
+func registrableDomain(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" || net.ParseIP(host) != nil {
+		return "", false
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return "", false
+	}
+	return domain, true
+}
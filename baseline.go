@@ -0,0 +1,112 @@
+package techdetect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// VersionChange is a technology whose version differs from the baseline
+type VersionChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ScanDiff lists how the technologies of a URL changed since a baseline scan
+type ScanDiff struct {
+	New     bool                     `json:"new,omitempty"`     // the URL was not in the baseline
+	Added   map[string]string        `json:"added,omitempty"`   // tech name -> version
+	Removed map[string]string        `json:"removed,omitempty"` // tech name -> baseline version
+	Changed map[string]VersionChange `json:"changed,omitempty"` // tech name -> versions
+}
+
+// Empty reports whether nothing changed
+func (d *ScanDiff) Empty() bool {
+	return !d.New && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffScans compares the technologies of a scan with those of a baseline scan of the same
+// URL; a nil baseline means the URL is new, so every technology counts as added
+func DiffScans(baseline *ScanResult, current ScanResult) *ScanDiff {
+	diff := &ScanDiff{}
+	var before map[string]string
+	if baseline == nil {
+		diff.New = true
+	} else {
+		before = baseline.Technologies
+	}
+
+	for name, version := range current.Technologies {
+		previous, existed := before[name]
+		switch {
+		case !existed:
+			if diff.Added == nil {
+				diff.Added = make(map[string]string)
+			}
+			diff.Added[name] = version
+		case previous != version:
+			if diff.Changed == nil {
+				diff.Changed = make(map[string]VersionChange)
+			}
+			diff.Changed[name] = VersionChange{From: previous, To: version}
+		}
+	}
+	for name, version := range before {
+		if _, exists := current.Technologies[name]; !exists {
+			if diff.Removed == nil {
+				diff.Removed = make(map[string]string)
+			}
+			diff.Removed[name] = version
+		}
+	}
+	return diff
+}
+
+// Baseline holds the results of a previous batch, by URL, to compare new scans with
+type Baseline map[string]ScanResult
+
+// ReadBaseline reads previous results in the json format (a BatchResults object) or as
+// jsonl (one ScanResult per line). Failed scans are left out, so their URLs count as new.
+func ReadBaseline(r io.Reader) (Baseline, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+
+	var results []ScanResult
+	var batch struct {
+		Results *[]ScanResult `json:"results"`
+	}
+	if err := json.Unmarshal(data, &batch); err == nil && batch.Results != nil {
+		results = *batch.Results
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var result ScanResult
+			if err := dec.Decode(&result); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("invalid baseline: %w", err)
+			}
+			results = append(results, result)
+		}
+	}
+
+	baseline := make(Baseline, len(results))
+	for _, result := range results {
+		if result.Error == "" && result.URL != "" {
+			baseline[result.URL] = result
+		}
+	}
+	return baseline, nil
+}
+
+// Diff compares a scan with the baseline result of its URL
+func (b Baseline) Diff(current ScanResult) *ScanDiff {
+	if previous, ok := b[current.URL]; ok {
+		return DiffScans(&previous, current)
+	}
+	return DiffScans(nil, current)
+}
@@ -3,16 +3,41 @@ package techdetect
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 )
 
+// Chrome flag profiles of the browser stage (Options.BrowserProfile)
+const (
+	BrowserProfileDefault    = "default"    // Chrome's headless defaults, automation flag hidden; web security on
+	BrowserProfileMinimal    = "minimal"    // Chrome's headless defaults only
+	BrowserProfilePermissive = "permissive" // default plus disable-web-security: CORS and mixed content unchecked
+)
+
 // BrowserDetector performs browser-based detection
 type BrowserDetector struct {
 	timeout  time.Duration
 	proxyURL string
+	profile  string
+	flags    []string
+	headful  bool
+
+	hostPolicy *HostPolicy // checked for every request of the tab, nil when unrestricted
+	notifier   *notifier   // reports detections as they happen, nil without Options.OnDetect
+
+	versionPolicy  string // which stage's version wins, see VersionPreferHTTP
+	allowOffTarget bool   // templated paths may leave the target, see Options.AllowOffTargetTemplates
+
+	// Long-lived browser started by Warmup; scans open a tab in it instead of launching Chrome
+	mu            sync.Mutex
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
 }
 
 // NewBrowserDetector creates a new browser detector
@@ -22,9 +47,28 @@ func NewBrowserDetector() *BrowserDetector {
 
 // NewBrowserDetectorWithOptions creates a new browser detector with proxy support
 func NewBrowserDetectorWithOptions(proxyURL string) *BrowserDetector {
+	return NewBrowserDetectorWithConfig(Options{ProxyURL: proxyURL})
+}
+
+// NewBrowserDetectorWithConfig creates a new browser detector from an Options struct
+func NewBrowserDetectorWithConfig(opts Options) *BrowserDetector {
+	proxyURL := opts.ProxyURL
+	if len(opts.ProxyURLs) > 0 {
+		// Chrome takes a single proxy per browser, so use the first of the rotation
+		proxyURL = opts.ProxyURLs[0]
+	}
 	return &BrowserDetector{
 		timeout:  30 * time.Second,
 		proxyURL: proxyURL,
+		profile:  opts.BrowserProfile,
+		flags:    opts.BrowserFlags,
+		headful:  opts.BrowserHeadful,
+
+		hostPolicy: opts.HostPolicy,
+		notifier:   newNotifier(opts.OnDetect),
+
+		versionPolicy:  opts.VersionPolicy,
+		allowOffTarget: opts.AllowOffTargetTemplates,
 	}
 }
 
@@ -40,6 +84,9 @@ func ClassifyBrowserByPath(fingerprints map[string]Fingerprint) []BrowserPathCla
 
 	for techName, fp := range fingerprints {
 		for _, probe := range fp.Browser {
+			if probe.Path == "" {
+				probe.Path = "/"
+			}
 			key := probe.Path
 			if _, exists := pathMap[key]; !exists {
 				pathMap[key] = &BrowserPathClassification{
@@ -51,15 +98,31 @@ func ClassifyBrowserByPath(fingerprints map[string]Fingerprint) []BrowserPathCla
 		}
 	}
 
-	// Convert map to slice
+	// Convert map to slice, sorted by path
 	result := make([]BrowserPathClassification, 0, len(pathMap))
 	for _, pc := range pathMap {
 		result = append(result, *pc)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
 
 	return result
 }
 
+// hasRunnableProbe checks if any probe of the path still has something to find, as
+// decided by shouldRun; other paths are not navigated to at all
+func (bpc *BrowserPathClassification) hasRunnableProbe(shouldRun func(techName string, probe BrowserProbe) bool) bool {
+	for techName, probes := range bpc.Technologies {
+		for _, probe := range probes {
+			if shouldRun(techName, probe) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ShouldRunBrowserDetection determines if browser detection should run for a technology
 func ShouldRunBrowserDetection(techName string, results map[string]*Technology, probe BrowserProbe) bool {
 	tech, exists := results[techName]
@@ -78,8 +141,59 @@ func ShouldRunBrowserDetection(techName string, results map[string]*Technology,
 	return probe.HasVersionCapability()
 }
 
+// Version policies for technologies whose version both stages found (Options.VersionPolicy)
+const (
+	VersionPreferHTTP     = "http"     // keep the HTTP version; the browser only fills a missing one
+	VersionPreferBrowser  = "browser"  // the live runtime's version wins
+	VersionPreferSpecific = "specific" // the more specific version wins, as for version_from "longest"
+)
+
+// shouldRun decides whether a browser probe runs for a technology given the results so
+// far and the technologies the browser already settled. Unless HTTP versions are kept,
+// version probes also run for technologies that already have one.
+func (bd *BrowserDetector) shouldRun(techName string, results map[string]*Technology, settled map[string]bool, probe BrowserProbe) bool {
+	if bd.versionPolicy == "" || bd.versionPolicy == VersionPreferHTTP {
+		return ShouldRunBrowserDetection(techName, results, probe)
+	}
+	if _, exists := results[techName]; !exists {
+		return probe.HasDetectionCapability()
+	}
+	return !settled[techName] && probe.HasVersionCapability()
+}
+
+// mergeVersion merges a version found by the browser into a technology per the version policy
+func (bd *BrowserDetector) mergeVersion(tech *Technology, version string) {
+	if version == "" {
+		return
+	}
+	switch bd.versionPolicy {
+	case VersionPreferBrowser:
+		tech.addVersion(version)
+		tech.Version = version
+	case VersionPreferSpecific:
+		tech.addVersion(version)
+		if moreSpecificVersion(version, tech.Version) {
+			tech.Version = version
+		}
+	default:
+		if tech.Version == "" {
+			tech.addVersion(version)
+		}
+	}
+}
+
 // DetectBrowser performs browser-based detection
 func (bd *BrowserDetector) DetectBrowser(baseURL string, fingerprints map[string]Fingerprint, httpResults map[string]*Technology) (map[string]*Technology, error) {
+	return bd.DetectBrowserContext(context.Background(), baseURL, fingerprints, httpResults)
+}
+
+// DetectBrowserContext performs browser-based detection, shutting the browser down when ctx is done
+func (bd *BrowserDetector) DetectBrowserContext(parent context.Context, baseURL string, fingerprints map[string]Fingerprint, httpResults map[string]*Technology) (map[string]*Technology, error) {
+	return bd.detect(parent, baseURL, ClassifyBrowserByPath(fingerprints), httpResults)
+}
+
+// detect runs the browser probes of already classified paths
+func (bd *BrowserDetector) detect(parent context.Context, baseURL string, pathClassifications []BrowserPathClassification, httpResults map[string]*Technology) (map[string]*Technology, error) {
 	results := make(map[string]*Technology)
 
 	// Copy existing HTTP results
@@ -87,39 +201,49 @@ func (bd *BrowserDetector) DetectBrowser(baseURL string, fingerprints map[string
 		results[k] = v
 	}
 
-	// Classify browser probes by path
-	pathClassifications := ClassifyBrowserByPath(fingerprints)
-	if len(pathClassifications) == 0 {
+	// Skip paths whose technologies were all fully resolved by HTTP, and the browser
+	// launch when none is left
+	settled := make(map[string]bool)
+	shouldRun := func(techName string, probe BrowserProbe) bool {
+		return bd.shouldRun(techName, results, settled, probe)
+	}
+	var pending []BrowserPathClassification
+	for _, classification := range pathClassifications {
+		if classification.hasRunnableProbe(shouldRun) {
+			pending = append(pending, classification)
+		}
+	}
+	if len(pending) == 0 {
 		return results, nil
 	}
-
-	// Create browser context with options to suppress errors
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("disable-blink-features", "AutomationControlled"),
-		chromedp.Flag("disable-web-security", true),
-	)
-
-	// Add proxy configuration if provided
-	if bd.proxyURL != "" {
-		opts = append(opts, chromedp.ProxyServer(bd.proxyURL))
+	if err := bd.hostPolicy.CheckURL(parent, baseURL); err != nil {
+		return results, err
 	}
 
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancel()
+	notified := seenNames(httpResults)
 
-	// Create context with custom logger to suppress chromedp errors
-	ctx, cancel := chromedp.NewContext(allocCtx, chromedp.WithLogf(func(format string, v ...interface{}) {
-		// Suppress all chromedp logs
-	}))
+	ctx, cancel := bd.newTab(parent)
 	defer cancel()
+	if err := bd.guardRequests(ctx); err != nil {
+		// Without the interception, the page could reach denied hosts
+		return results, fmt.Errorf("failed to enforce host policy in the browser: %w", err)
+	}
 
 	// Set timeout
 	ctx, cancel = context.WithTimeout(ctx, bd.timeout)
 	defer cancel()
 
 	// Process each unique path
-	for _, classification := range pathClassifications {
-		fullURL := strings.TrimSuffix(baseURL, "/") + classification.Path
+	for _, classification := range pending {
+		if !classification.hasRunnableProbe(shouldRun) {
+			// Resolved by an earlier path
+			continue
+		}
+		// Paths resolve against the target like HTTP probe paths
+		fullURL, ok := probeURL(baseURL, classification.Path, bd.allowOffTarget)
+		if !ok {
+			continue
+		}
 
 		// Navigate to the page
 		if err := chromedp.Run(ctx, chromedp.Navigate(fullURL)); err != nil {
@@ -135,7 +259,7 @@ func (bd *BrowserDetector) DetectBrowser(baseURL string, fingerprints map[string
 		for techName, probes := range classification.Technologies {
 			for _, probe := range probes {
 				// Check if we should run this probe
-				if !ShouldRunBrowserDetection(techName, results, probe) {
+				if !shouldRun(techName, probe) {
 					continue
 				}
 
@@ -165,23 +289,189 @@ func (bd *BrowserDetector) DetectBrowser(baseURL string, fingerprints map[string
 				// Update results
 				if detected {
 					if _, exists := results[techName]; !exists {
-						results[techName] = &Technology{
-							Name:    techName,
-							Version: version,
-						}
-					} else if version != "" && results[techName].Version == "" {
-						// Update version if found and not already set
-						results[techName].Version = version
+						results[techName] = &Technology{Name: techName}
 					}
+					bd.mergeVersion(results[techName], version)
+					settled[techName] = true
 					break // Found, no need to check other probes
-				} else if version != "" && results[techName] != nil && results[techName].Version == "" {
+				} else if version != "" && results[techName] != nil {
 					// Update version even if not detected (tech already detected in HTTP stage)
-					results[techName].Version = version
+					bd.mergeVersion(results[techName], version)
+					settled[techName] = true
 					break
 				}
 			}
 		}
+		bd.notifier.notifyNew(baseURL, results, notified)
 	}
 
 	return results, nil
 }
+
+// allocatorOptions returns the Chrome flags for launching a browser, per the flag profile
+func (bd *BrowserDetector) allocatorOptions() []chromedp.ExecAllocatorOption {
+	opts := append([]chromedp.ExecAllocatorOption{}, chromedp.DefaultExecAllocatorOptions[:]...)
+	switch bd.profile {
+	case BrowserProfileMinimal:
+		// Nothing added
+	case BrowserProfilePermissive:
+		opts = append(opts,
+			chromedp.Flag("disable-blink-features", "AutomationControlled"),
+			chromedp.Flag("disable-web-security", true),
+		)
+	default:
+		opts = append(opts, chromedp.Flag("disable-blink-features", "AutomationControlled"))
+	}
+
+	if bd.headful {
+		opts = append(opts, chromedp.Flag("headless", false))
+	}
+	for _, flag := range bd.flags {
+		opts = append(opts, chromeFlag(flag))
+	}
+
+	// Add proxy configuration if provided
+	if bd.proxyURL != "" {
+		opts = append(opts, chromedp.ProxyServer(bd.proxyURL))
+	}
+	return opts
+}
+
+// chromeFlag converts a command-line flag ("--lang=de", "window-size=1280,800" or a bare
+// "--auto-open-devtools-for-tabs") to an allocator option
+func chromeFlag(flag string) chromedp.ExecAllocatorOption {
+	name, value, hasValue := strings.Cut(strings.TrimLeft(strings.TrimSpace(flag), "-"), "=")
+	if !hasValue {
+		return chromedp.Flag(name, true)
+	}
+	return chromedp.Flag(name, value)
+}
+
+// guardRequests makes a tab check every request against the host policy before it is
+// sent, failing denied ones: redirects, frames, scripts and the page's own fetches, not
+// only the scanned URL. No-op without a policy.
+func (bd *BrowserDetector) guardRequests(ctx context.Context) error {
+	if bd.hostPolicy == nil {
+		return nil
+	}
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		// The listener must not block, so answer from another goroutine
+		go func() {
+			var action chromedp.Action = fetch.ContinueRequest(paused.RequestID)
+			if err := bd.hostPolicy.CheckURL(ctx, paused.Request.URL); err != nil {
+				action = fetch.FailRequest(paused.RequestID, network.ErrorReasonBlockedByClient)
+			}
+			chromedp.Run(ctx, action)
+		}()
+	})
+	return chromedp.Run(ctx, fetch.Enable())
+}
+
+// newTab returns a browser context for one scan: a tab in the warmed-up browser if there
+// is one, a freshly launched browser otherwise. Cancelling parent or the returned function
+// closes the tab (or shuts the fresh browser down).
+func (bd *BrowserDetector) newTab(parent context.Context) (context.Context, context.CancelFunc) {
+	// Suppress all chromedp logs
+	quiet := chromedp.WithLogf(func(format string, v ...interface{}) {})
+
+	bd.mu.Lock()
+	browserCtx := bd.browserCtx
+	bd.mu.Unlock()
+
+	if browserCtx != nil && browserCtx.Err() == nil {
+		tabCtx, cancel := chromedp.NewContext(browserCtx, quiet)
+		stop := context.AfterFunc(parent, cancel)
+		return tabCtx, func() {
+			stop()
+			cancel()
+		}
+	}
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(parent, bd.allocatorOptions()...)
+	ctx, cancel := chromedp.NewContext(allocCtx, quiet)
+	return ctx, func() {
+		cancel()
+		cancelAlloc()
+	}
+}
+
+// Warmup launches a long-lived browser that later scans open tabs in, so the first scan
+// doesn't pay Chrome's start-up time. ctx bounds the launch only; the browser keeps
+// running until Close. Calling Warmup on a running browser does nothing.
+func (bd *BrowserDetector) Warmup(ctx context.Context) error {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	if bd.browserCtx != nil && bd.browserCtx.Err() == nil {
+		return nil
+	}
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), bd.allocatorOptions()...)
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx, chromedp.WithLogf(func(format string, v ...interface{}) {}))
+	cancel := func() {
+		cancelBrowser()
+		cancelAlloc()
+	}
+
+	// The first Run on a browser context starts Chrome
+	started := make(chan error, 1)
+	go func() {
+		started <- chromedp.Run(browserCtx)
+	}()
+
+	select {
+	case err := <-started:
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to start browser: %w", err)
+		}
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+
+	bd.browserCtx = browserCtx
+	bd.browserCancel = cancel
+	return nil
+}
+
+// Healthy checks that the warmed-up browser is running and evaluates a script in a new
+// tab within 5 seconds. It returns false if Warmup was not called or the browser died.
+func (bd *BrowserDetector) Healthy() bool {
+	bd.mu.Lock()
+	browserCtx := bd.browserCtx
+	bd.mu.Unlock()
+
+	if browserCtx == nil || browserCtx.Err() != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tabCtx, cancelTab := bd.newTab(ctx)
+	defer cancelTab()
+
+	var result int
+	if err := chromedp.Run(tabCtx, chromedp.Evaluate("1 + 1", &result)); err != nil {
+		return false
+	}
+	return result == 2
+}
+
+// Close shuts down the browser started by Warmup, if any. Later scans launch a browser
+// per scan again until the next Warmup.
+func (bd *BrowserDetector) Close() error {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	if bd.browserCancel != nil {
+		bd.browserCancel()
+	}
+	bd.browserCtx = nil
+	bd.browserCancel = nil
+	return nil
+}
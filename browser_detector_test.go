@@ -0,0 +1,81 @@
+package techdetect
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeVersion(t *testing.T) {
+	tests := []struct {
+		policy   string
+		http     string // version found by the HTTP stage
+		browser  string // version found by the browser
+		want     string
+		versions []string
+	}{
+		{VersionPreferHTTP, "3.6", "3.7.1", "3.6", []string{"3.6"}},
+		{"", "3.6", "3.7.1", "3.6", []string{"3.6"}},
+		{VersionPreferHTTP, "", "3.7.1", "3.7.1", []string{"3.7.1"}},
+		{VersionPreferHTTP, "3.6", "", "3.6", []string{"3.6"}},
+		{VersionPreferBrowser, "3.6", "3.7.1", "3.7.1", []string{"3.6", "3.7.1"}},
+		{VersionPreferBrowser, "3.7.1", "3.7", "3.7", []string{"3.7.1", "3.7"}},
+		{VersionPreferBrowser, "", "3.7.1", "3.7.1", []string{"3.7.1"}},
+		{VersionPreferBrowser, "3.6", "", "3.6", []string{"3.6"}},
+		{VersionPreferSpecific, "3", "3.7.1", "3.7.1", []string{"3", "3.7.1"}},
+		{VersionPreferSpecific, "3.7.1", "3.7", "3.7.1", []string{"3.7.1", "3.7"}},
+		{VersionPreferSpecific, "3.6.4", "3.7.1", "3.6.4", []string{"3.6.4", "3.7.1"}},
+		{VersionPreferSpecific, "", "3.7.1", "3.7.1", []string{"3.7.1"}},
+		{VersionPreferSpecific, "3.7.1", "3.7.1", "3.7.1", []string{"3.7.1"}},
+	}
+
+	for _, tt := range tests {
+		bd := NewBrowserDetectorWithConfig(Options{VersionPolicy: tt.policy})
+		tech := &Technology{Name: "jQuery"}
+		tech.addVersion(tt.http)
+		bd.mergeVersion(tech, tt.browser)
+		if tech.Version != tt.want || !slices.Equal(tech.Versions, tt.versions) {
+			t.Errorf("policy %q, HTTP %q, browser %q: version %q %v, want %q %v",
+				tt.policy, tt.http, tt.browser, tech.Version, tech.Versions, tt.want, tt.versions)
+		}
+	}
+}
+
+func TestShouldRunBrowserProbe(t *testing.T) {
+	detect := BrowserProbe{Path: "/", Detection: "return !!window.jQuery;"}
+	version := BrowserProbe{Path: "/", Version: "return jQuery.fn.jquery;"}
+	results := map[string]*Technology{
+		"Versioned":   {Name: "Versioned", Version: "3.6"},
+		"Unversioned": {Name: "Unversioned"},
+	}
+
+	tests := []struct {
+		name    string
+		tech    string
+		probe   BrowserProbe
+		settled bool
+		want    map[string]bool // policy -> whether the probe runs
+	}{
+		{"undetected, detection probe", "Missing", detect, false,
+			map[string]bool{VersionPreferHTTP: true, VersionPreferBrowser: true, VersionPreferSpecific: true}},
+		{"undetected, version probe", "Missing", version, false,
+			map[string]bool{VersionPreferHTTP: false, VersionPreferBrowser: false, VersionPreferSpecific: false}},
+		{"no version yet", "Unversioned", version, false,
+			map[string]bool{VersionPreferHTTP: true, VersionPreferBrowser: true, VersionPreferSpecific: true}},
+		{"HTTP version", "Versioned", version, false,
+			map[string]bool{VersionPreferHTTP: false, VersionPreferBrowser: true, VersionPreferSpecific: true}},
+		{"detection probe for a detected tech", "Versioned", detect, false,
+			map[string]bool{VersionPreferHTTP: false, VersionPreferBrowser: false, VersionPreferSpecific: false}},
+		{"settled by the browser", "Versioned", version, true,
+			map[string]bool{VersionPreferHTTP: false, VersionPreferBrowser: false, VersionPreferSpecific: false}},
+	}
+
+	for _, tt := range tests {
+		for policy, want := range tt.want {
+			bd := NewBrowserDetectorWithConfig(Options{VersionPolicy: policy})
+			settled := map[string]bool{tt.tech: tt.settled}
+			if got := bd.shouldRun(tt.tech, results, settled, tt.probe); got != want {
+				t.Errorf("%s, policy %q: shouldRun = %v, want %v", tt.name, policy, got, want)
+			}
+		}
+	}
+}
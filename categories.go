@@ -0,0 +1,103 @@
+package techdetect
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+//go:embed data/categories.json
+var embeddedCategories []byte
+
+// Well-known category IDs, following the Wappalyzer taxonomy in data/categories.json
+const (
+	CategoryCMS                  = 1
+	CategoryEcommerce            = 6
+	CategoryAnalytics            = 10
+	CategoryJavaScriptFrameworks = 12
+	CategorySecurity             = 16
+	CategoryWebFrameworks        = 18
+	CategoryWebServers           = 22
+	CategoryCaching              = 23
+	CategoryProgrammingLanguages = 27
+	CategoryOperatingSystems     = 28
+	CategoryCDN                  = 31
+	CategoryDatabases            = 34
+	CategoryJavaScriptLibraries  = 59
+	CategoryPaaS                 = 62
+	CategoryReverseProxies       = 64
+	CategoryLoadBalancers        = 65
+	CategoryUIFrameworks         = 66
+	CategoryAuthentication       = 69
+	CategoryHosting              = 88
+)
+
+// Category describes a technology category referenced by Fingerprint.Cats
+type Category struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Groups   []int  `json:"groups,omitempty"`
+	Priority int    `json:"priority"`
+}
+
+// Categories maps every known category ID to its definition
+var Categories = mustParseCategories(embeddedCategories)
+
+// parseCategories decodes a categories file keyed by category ID
+func parseCategories(data []byte) (map[int]Category, error) {
+	var raw map[string]Category
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse categories: %w", err)
+	}
+
+	categories := make(map[int]Category, len(raw))
+	for key, cat := range raw {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid category ID %q", key)
+		}
+		cat.ID = id
+		categories[id] = cat
+	}
+	return categories, nil
+}
+
+// mustParseCategories parses the embedded categories, which are known to be valid
+func mustParseCategories(data []byte) map[int]Category {
+	categories, err := parseCategories(data)
+	if err != nil {
+		panic(err)
+	}
+	return categories
+}
+
+// CategoryByID looks up a category, reporting whether the ID is known
+func CategoryByID(id int) (Category, bool) {
+	cat, ok := Categories[id]
+	return cat, ok
+}
+
+// CategoriesFor resolves category IDs to their definitions, skipping unknown IDs
+func CategoriesFor(ids []int) []Category {
+	categories := make([]Category, 0, len(ids))
+	for _, id := range ids {
+		if cat, ok := Categories[id]; ok {
+			categories = append(categories, cat)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].ID < categories[j].ID
+	})
+	return categories
+}
+
+// CategoriesForTech returns the categories of a loaded technology, or nil if it is unknown
+func (d *Detector) CategoriesForTech(name string) []Category {
+	fp, ok := d.fingerprints[name]
+	if !ok {
+		return nil
+	}
+	return CategoriesFor(fp.Cats)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	techdetect "github.com/X-Cotang/UltraTechDetector"
+)
+
+// cycloneDXSpecVersion is the CycloneDX specification version of -format cyclonedx output
+const cycloneDXSpecVersion = "1.5"
+
+// cdxBOM is a minimal CycloneDX bill of materials: one application component per scanned
+// URL, with the technologies detected on it as nested components
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber,omitempty"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp  string        `json:"timestamp"`
+	Tools      cdxTools      `json:"tools"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	Description        string                 `json:"description,omitempty"`
+	CPE                string                 `json:"cpe,omitempty"`
+	ExternalReferences []cdxExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty          `json:"properties,omitempty"`
+	Components         []cdxComponent         `json:"components,omitempty"`
+}
+
+type cdxExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// printCycloneDX writes the batch as one CycloneDX JSON document. URLs that failed have
+// no inventory to report and are listed on stderr instead.
+func printCycloneDX(detector *techdetect.Detector, batchResults []urlResult) {
+	dbInfo := detector.DatabaseInfo()
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  cycloneDXSpecVersion,
+		SerialNumber: newSerialNumber(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: cdxTools{Components: []cdxComponent{
+				{Type: "application", Name: "techdetect", Version: buildVersion()},
+			}},
+			Properties: []cdxProperty{
+				{Name: "techdetect:database_hash", Value: dbInfo.Hash},
+				{Name: "techdetect:schema_version", Value: strconv.Itoa(techdetect.ResultSchemaVersion)},
+			},
+		},
+		Components: make([]cdxComponent, 0, len(batchResults)),
+	}
+
+	for _, result := range batchResults {
+		if result.scan.Error != "" {
+			fmt.Fprintf(os.Stderr, "%s - Error: %s\n", result.scan.URL, result.scan.Error)
+		}
+		if result.report == nil {
+			continue
+		}
+		bom.Components = append(bom.Components, cdxSite(result.scan.URL, result.report))
+	}
+
+	output, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal CycloneDX: %v", err)
+	}
+	fmt.Println(string(output))
+}
+
+// cdxSite describes a scanned URL and the technologies detected on it; a technology
+// found in several versions is listed once per version
+func cdxSite(targetURL string, report *techdetect.Report) cdxComponent {
+	site := cdxComponent{
+		Type:   "application",
+		BOMRef: targetURL,
+		Name:   targetURL,
+	}
+
+	for _, tech := range report.Technologies {
+		versions := tech.Versions
+		if len(versions) == 0 {
+			versions = []string{tech.Version}
+		}
+		for _, version := range versions {
+			component := cdxComponent{
+				Type:        cdxComponentType(tech.Categories),
+				BOMRef:      targetURL + "#" + tech.Name,
+				Name:        tech.Name,
+				Version:     version,
+				Description: tech.Description,
+				CPE:         cpeWithVersion(tech.CPE, version),
+				Properties: []cdxProperty{
+					{Name: "techdetect:confidence", Value: strconv.Itoa(tech.Confidence)},
+				},
+			}
+			if version != "" {
+				component.BOMRef += "@" + version
+			}
+			if tech.Website != "" {
+				component.ExternalReferences = []cdxExternalReference{{Type: "website", URL: tech.Website}}
+			}
+			for _, id := range tech.Categories {
+				name := strconv.Itoa(id)
+				if category, ok := techdetect.Categories[id]; ok {
+					name = category.Name
+				}
+				component.Properties = append(component.Properties, cdxProperty{Name: "techdetect:category", Value: name})
+			}
+			for _, source := range tech.Sources {
+				component.Properties = append(component.Properties, cdxProperty{Name: "techdetect:source", Value: source})
+			}
+			site.Components = append(site.Components, component)
+		}
+	}
+	return site
+}
+
+// cdxComponentType maps the categories of a technology to a CycloneDX component type
+func cdxComponentType(categories []int) string {
+	for _, id := range categories {
+		switch id {
+		case techdetect.CategoryJavaScriptLibraries:
+			return "library"
+		case techdetect.CategoryJavaScriptFrameworks, techdetect.CategoryWebFrameworks, techdetect.CategoryUIFrameworks:
+			return "framework"
+		case techdetect.CategoryOperatingSystems:
+			return "operating-system"
+		}
+	}
+	return "application"
+}
+
+// cpeWithVersion fills the version of a CPE 2.3 name left open ("*") by the fingerprint
+// with the detected version, so the name matches vulnerability feeds for that release
+func cpeWithVersion(cpe, version string) string {
+	parts := strings.Split(cpe, ":")
+	if version == "" || len(parts) < 6 || parts[0] != "cpe" || parts[1] != "2.3" || parts[5] != "*" {
+		return cpe
+	}
+
+	var escaped strings.Builder
+	for _, r := range version {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	parts[5] = escaped.String()
+	return strings.Join(parts, ":")
+}
+
+// newSerialNumber returns a random RFC 4122 UUID URN identifying the BOM
+func newSerialNumber() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	techdetect "github.com/X-Cotang/UltraTechDetector"
+)
+
+// printHitStats writes the -hit-stats summary to stderr: the detected technologies, most
+// detected first, with their stages, then the number of fingerprints that never matched
+func printHitStats(stats []techdetect.HitStat) {
+	never := 0
+	fmt.Fprintln(os.Stderr, "Hit statistics:")
+	for _, stat := range stats {
+		if stat.Detections == 0 {
+			never++
+			continue
+		}
+		stages := make([]string, 0, len(stat.Sources))
+		for stage, n := range stat.Sources {
+			stages = append(stages, fmt.Sprintf("%s %d", stage, n))
+		}
+		sort.Strings(stages)
+		fmt.Fprintf(os.Stderr, "  %6d  %-30s %s\n", stat.Detections, stat.Technology, strings.Join(stages, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d fingerprints never detected\n", never, len(stats))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// urlSelector applies -max-urls and -sample to input URLs as they are read
+type urlSelector struct {
+	maxURLs int     // 0 = unlimited
+	sample  float64 // 0 = keep all, (0,1) = inclusion probability, >= 1 = uniform sample size
+	rng     *rand.Rand
+
+	selected []string
+	seen     int // URLs offered so far (for reservoir sampling)
+}
+
+// newURLSelector creates a selector; seed makes sampling reproducible
+func newURLSelector(maxURLs int, sample float64, seed int64) *urlSelector {
+	return &urlSelector{
+		maxURLs: maxURLs,
+		sample:  sample,
+		rng:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+// add offers a URL to the selector and reports whether more input is useful
+func (s *urlSelector) add(url string) bool {
+	s.seen++
+
+	switch {
+	case s.sample >= 1:
+		// Reservoir sampling of a fixed number of URLs; needs the whole input
+		size := int(s.sample)
+		if len(s.selected) < size {
+			s.selected = append(s.selected, url)
+		} else if j := s.rng.Intn(s.seen); j < size {
+			s.selected[j] = url
+		}
+		return true
+
+	case s.sample > 0:
+		// Independent inclusion with probability sample
+		if s.rng.Float64() < s.sample {
+			s.selected = append(s.selected, url)
+		}
+
+	default:
+		s.selected = append(s.selected, url)
+	}
+
+	return s.maxURLs <= 0 || len(s.selected) < s.maxURLs
+}
+
+// urls returns the selected URLs, capped at maxURLs
+func (s *urlSelector) urls() []string {
+	if s.maxURLs > 0 && len(s.selected) > s.maxURLs {
+		return s.selected[:s.maxURLs]
+	}
+	return s.selected
+}
+
+// full reports whether no more URLs will be selected
+func (s *urlSelector) full() bool {
+	return s.sample < 1 && s.maxURLs > 0 && len(s.selected) >= s.maxURLs
+}
+
+// collectTargets offers the URLs of every input source to the selector, in order: -url,
+// positional arguments and the -targets file. Piped stdin is read only when none of
+// them is given.
+func collectTargets(selector *urlSelector, single string, args []string, targetsFile string) error {
+	if single != "" {
+		selector.add(single)
+	}
+	for _, arg := range args {
+		if selector.full() {
+			return nil
+		}
+		selector.add(arg)
+	}
+
+	if targetsFile != "" {
+		f, err := os.Open(targetsFile)
+		if err != nil {
+			return fmt.Errorf("failed to open targets file: %w", err)
+		}
+		defer f.Close()
+		if err := readTargets(f, selector); err != nil {
+			return fmt.Errorf("failed to read targets file: %w", err)
+		}
+	}
+
+	if single != "" || len(args) > 0 || targetsFile != "" {
+		return nil
+	}
+
+	// Check if stdin is a pipe or terminal; a terminal gives no targets and the usage is shown
+	stat, err := os.Stdin.Stat()
+	if err != nil || (stat.Mode()&os.ModeCharDevice) != 0 {
+		return nil
+	}
+	if err := readTargets(os.Stdin, selector); err != nil {
+		return fmt.Errorf("failed to read from stdin: %w", err)
+	}
+	return nil
+}
+
+// readTargets offers one URL per line to the selector, skipping blank lines and "#"
+// comments, and stops reading once the selector is full
+func readTargets(r io.Reader, selector *urlSelector) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if selector.full() {
+			return nil
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !selector.add(line) {
+			// Enough URLs selected, stop reading
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	techdetect "github.com/X-Cotang/UltraTechDetector"
+)
+
+// lintReport is the -format json output of the lint subcommand
+type lintReport struct {
+	Fingerprints int                    `json:"fingerprints"`
+	Errors       int                    `json:"errors"`
+	Warnings     int                    `json:"warnings"`
+	Issues       []techdetect.LintIssue `json:"issues"`
+}
+
+// runLint checks a fingerprint directory (the embedded database without one) and exits
+// with status 1 when it has errors
+func runLint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format: text or json")
+	errorsOnly := fs.Bool("errors-only", false, "Only report errors, not warnings")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: techdetect lint [flags] [fingerprints-dir]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	loader := techdetect.NewLoader("")
+	if dir := fs.Arg(0); dir != "" {
+		loader = techdetect.NewLoaderFromFS(os.DirFS(dir), ".")
+	}
+	fingerprints, err := loader.LoadAll()
+	if err != nil {
+		log.Fatalf("Failed to load fingerprints: %v", err)
+	}
+
+	issues := techdetect.Lint(fingerprints)
+	for _, dup := range loader.Duplicates() {
+		issues = append(issues, techdetect.LintIssue{
+			Technology: dup.Name,
+			Severity:   techdetect.LintWarning,
+			Location:   dup.File,
+			Message:    "overrides the definition in " + dup.Overridden,
+		})
+	}
+
+	report := lintReport{Fingerprints: len(fingerprints), Issues: []techdetect.LintIssue{}}
+	for _, issue := range issues {
+		if issue.Severity == techdetect.LintError {
+			report.Errors++
+		} else {
+			report.Warnings++
+			if *errorsOnly {
+				continue
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	if *format == "json" {
+		output, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal JSON: %v", err)
+		}
+		fmt.Println(string(output))
+	} else {
+		for _, issue := range report.Issues {
+			fmt.Println(issue)
+		}
+		fmt.Printf("%d fingerprints: %d errors, %d warnings\n", report.Fingerprints, report.Errors, report.Warnings)
+	}
+
+	if report.Errors > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,69 +1,167 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	techdetect "github.com/X-Cotang/UltraTechDetector"
 )
 
+// retryBackoff is the delay before the first -retry-failed pass, doubled on each pass up
+// to maxRetryBackoff
+const (
+	retryBackoff    = 2 * time.Second
+	maxRetryBackoff = time.Minute
+)
+
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		runStats(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		runLint(os.Args[2:])
+		return
+	}
+
 	// Command-line flags
 	url := flag.String("url", "", "Target URL to analyze (if not provided, reads from stdin)")
+	assumeScheme := flag.String("assume-scheme", "", "Scheme (http or https) prepended to inputs without one, e.g. bare domains like example.com")
+	targetsFile := flag.String("targets", "", "File with one target URL per line (blank lines and # comments are skipped)")
 	fingerprintsDir := flag.String("fingerprints", "./data/fingerprints", "Path to fingerprints directory")
 	useBrowser := flag.Bool("browser", false, "Enable browser detection (slower but more accurate)")
-	format := flag.String("format", "text", "Output format: text, json, or jsonl")
+	browserRequiredOnly := flag.Bool("browser-required-only", false, "With -browser, only run the browser probes of technologies HTTP probes can't detect")
+	browserProfile := flag.String("browser-profile", techdetect.BrowserProfileDefault, "Chrome flag profile: default, minimal (no automation flag tweaks) or permissive (also disables web security)")
+	browserFlags := flag.String("browser-flags", "", "Extra space-separated Chrome flags, e.g. \"--lang=de --window-size=1280,800\"")
+	browserHeadful := flag.Bool("browser-headful", false, "Show the browser window instead of running headless (for debugging)")
+	versionPolicy := flag.String("version-policy", techdetect.VersionPreferHTTP, "With -browser, which version wins when both stages find one: http, browser or specific (more components)")
+	format := flag.String("format", "text", "Output format: text, json, jsonl, ndjson-tech (one line per technology) or cyclonedx (CycloneDX SBOM)")
 	insecure := flag.Bool("insecure", true, "Skip SSL certificate verification (useful for self-signed certs)")
-	proxyURL := flag.String("proxy", "", "Proxy URL (http://[user:pass@]host:port or socks5://[user:pass@]host:port)")
+	proxyURL := flag.String("proxy", "", "Proxy URL (http://[user:pass@]host:port or socks5://[user:pass@]host:port); comma-separated to rotate over several")
+	proxyRotation := flag.String("proxy-rotation", techdetect.ProxyRotationRoundRobin, "Proxy rotation strategy when several proxies are given: round-robin or random")
+	tlsFallback := flag.Bool("tls-fallback", false, "Verify certificates, but retry once without verification on failure and flag the result as tls_invalid (overrides the -insecure default)")
+	insecureHosts := flag.String("insecure-hosts", "", "Comma-separated hosts to skip SSL verification for (others are verified; overrides the -insecure default)")
+	denyPrivate := flag.Bool("deny-private", false, "Refuse to contact loopback, private, link-local and other internal addresses (SSRF guard)")
+	allowHosts := flag.String("allow-hosts", "", "Comma-separated CIDRs, addresses or hosts always allowed (implies -deny-private)")
+	cookie := flag.String("cookie", "", "Cookies sent with HTTP requests to -cookie-domain, as in a Cookie header (\"session=abc; consent=yes\")")
+	cookieDomain := flag.String("cookie-domain", "", "Comma-separated hosts -cookie is sent to, each with its subdomains (required with -cookie)")
+	denyHosts := flag.String("deny-hosts", "", "Comma-separated CIDRs, addresses or hosts refused in addition to internal ranges (implies -deny-private)")
+	strict := flag.Bool("strict", false, "Fail if a technology is defined in more than one fingerprint file instead of warning")
+	extraPaths := flag.String("extra-paths", "", "Comma-separated paths also fetched and checked with the probes of the target page; \"common\" for /robots.txt, /sitemap.xml, /favicon.ico, /.git/HEAD and /wp-login.php")
+	allowSensitive := flag.Bool("allow-sensitive", false, "Also run probes that fingerprints mark as sensitive (e.g. admin API endpoints)")
+	readOnly := flag.Bool("read-only", false, "Only send GET and HEAD requests: skip probes using other methods (e.g. POST) for scanning sensitive systems")
+	urlDeadline := flag.Duration("url-deadline", 0, "Cap the total scan time per URL, e.g. 30s; partial results are reported with an error (0 = no cap)")
+	responseHeaderTimeout := flag.Duration("response-header-timeout", 0, "Fail requests whose response headers take longer than this, e.g. 5s (0 = only the request timeout)")
+	bodyIdleTimeout := flag.Duration("body-idle-timeout", 0, "Fail requests whose body stops arriving for this long, e.g. 5s (0 = only the request timeout)")
+	requestCache := flag.Duration("request-cache", 0, "Reuse responses of identical requests across the batch for this long, e.g. 5m (0 = off)")
+	retryFailed := flag.Int("retry-failed", 0, "Re-scan URLs that failed (errored, or had failed paths and no detections) up to N more times after the initial pass")
+	maxURLs := flag.Int("max-urls", 0, "Process at most N URLs (0 = all)")
+	sample := flag.Float64("sample", 0, "Randomly sample input URLs: probability P in (0,1), or N >= 1 URLs chosen uniformly")
+	seed := flag.Int64("seed", 0, "Random seed for -sample (default: time-based)")
+	categories := flag.String("categories", "", "Comma-separated category IDs; only fingerprints in these categories are loaded and probed")
+	var only stringList
+	flag.Var(&only, "only", "Only probe for this technology (and what its probes require); repeatable or comma-separated")
+	withTag := flag.String("with-tag", "", "Only report technologies carrying one of these comma-separated fingerprint tags (e.g. eol)")
+	includeHeaders := flag.Bool("include-headers", false, "Include the response headers of every fetched probe URL (headers key in JSON/JSONL)")
+	includeTransaction := flag.Bool("include-transaction", false, "Include every HTTP request of the scan, redirect hops included, with status and response headers (transaction key in JSON/JSONL)")
+	explain := flag.Bool("explain", false, "Include why each technology was detected (matched path, field, operator, text)")
+	snippet := flag.Int("snippet", 0, "Add about N characters of context around each -explain match, e.g. 120 (implies -explain)")
+	hitStats := flag.Bool("hit-stats", false, "At the end, print on stderr how often each technology was detected across the run and by which stage, and how many fingerprints never matched")
+	groupBy := flag.String("group-by", "", "Group results: host (merge technologies across each host's endpoints)")
+	harPath := flag.String("har", "", "Detect offline from the responses recorded in a HAR file instead of fetching URLs")
+	recordPath := flag.String("record", "", "Record every fetched response to a file for -replay")
+	replayPath := flag.String("replay", "", "Detect offline from a recording made with -record instead of fetching URLs")
+	baselinePath := flag.String("baseline", "", "Previous -format json or jsonl results: only output URLs whose technologies changed since, with a diff key")
+	includeApex := flag.Bool("include-apex", false, "Also scan the www/apex counterpart of each URL (www.example.com <-> example.com) and merge the results")
+	showVersion := flag.Bool("version", false, "Print the tool version, Go version and fingerprint database, then exit")
+	quiet := flag.Bool("quiet", false, "Text format: print only tab-separated target, technology and version lines (diagnostics still go to stderr)")
 
 	flag.Parse()
 
-	// Get URLs from either -url flag or positional arguments or stdin
-	var urls []string
+	if *showVersion {
+		if err := printVersion(*fingerprintsDir); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// Check if URL is provided as positional argument (after flags)
-	if flag.NArg() > 0 {
-		urls = flag.Args()
-	} else if *url != "" {
-		urls = []string{*url}
-	} else {
-		// Check if stdin is a pipe or terminal
-		stat, err := os.Stdin.Stat()
-		if err == nil && (stat.Mode()&os.ModeCharDevice) == 0 {
-			// stdin is piped, read from it
-			scanner := bufio.NewScanner(os.Stdin)
-			for scanner.Scan() {
-				line := strings.TrimSpace(scanner.Text())
-				if line != "" {
-					urls = append(urls, line)
-				}
+	if *groupBy != "" && *groupBy != "host" {
+		log.Fatalf("Invalid -group-by value %q (supported: host)", *groupBy)
+	}
+	switch *browserProfile {
+	case techdetect.BrowserProfileDefault, techdetect.BrowserProfileMinimal, techdetect.BrowserProfilePermissive:
+	default:
+		log.Fatalf("Invalid -browser-profile value %q (supported: default, minimal, permissive)", *browserProfile)
+	}
+	switch *versionPolicy {
+	case techdetect.VersionPreferHTTP, techdetect.VersionPreferBrowser, techdetect.VersionPreferSpecific:
+	default:
+		log.Fatalf("Invalid -version-policy value %q (supported: http, browser, specific)", *versionPolicy)
+	}
+	switch *assumeScheme {
+	case "", "http", "https":
+	default:
+		log.Fatalf("Invalid -assume-scheme value %q (supported: http, https)", *assumeScheme)
+	}
+	if *groupBy != "" && *format == "cyclonedx" {
+		log.Fatalf("-group-by is not supported with -format cyclonedx")
+	}
+	if *readOnly && *useBrowser {
+		// Pages loaded by the browser send requests of their own, whatever their method
+		log.Fatalf("-read-only is not supported with -browser")
+	}
+
+	if !flagWasSet("seed") {
+		*seed = time.Now().UnixNano()
+	}
+	selector := newURLSelector(*maxURLs, *sample, *seed)
+
+	// Get URLs from -url, positional arguments, -targets or stdin
+	offline := *harPath != "" || *replayPath != ""
+	if !offline {
+		// Offline mode takes its targets from the archive
+		if err := collectTargets(selector, *url, flag.Args(), *targetsFile); err != nil {
+			if *format == "text" {
+				log.Fatalf("Error reading targets: %v", err)
 			}
-			if err := scanner.Err(); err != nil {
-				if *format == "text" {
-					log.Fatalf("Error reading from stdin: %v", err)
-				}
-				// For JSON/JSONL, just exit silently
-				os.Exit(1)
+			// For JSON/JSONL, just exit silently
+			os.Exit(1)
+		}
+	}
+	urls := selector.urls()
+	if *assumeScheme != "" {
+		for i, target := range urls {
+			// Unusable inputs are kept, for the scan to report them
+			if normalized, err := techdetect.NormalizeURL(target, *assumeScheme); err == nil {
+				urls[i] = normalized
 			}
 		}
-		// If stdin is terminal (not piped), urls will remain empty
-		// and we'll show help below
 	}
 
-	if len(urls) == 0 {
+	if len(urls) == 0 && !offline {
 		if *format == "text" {
-			fmt.Fprintln(os.Stderr, "Usage: techdetect [options] <url> or pipe URLs via stdin")
+			fmt.Fprintln(os.Stderr, "Usage: techdetect [options] <url>, -targets <file> or pipe URLs via stdin")
 			fmt.Fprintln(os.Stderr, "")
 			fmt.Fprintln(os.Stderr, "Examples:")
 			fmt.Fprintln(os.Stderr, "  techdetect https://example.com")
 			fmt.Fprintln(os.Stderr, "  techdetect -format json https://example.com")
 			fmt.Fprintln(os.Stderr, "  echo https://example.com | techdetect -format jsonl")
 			fmt.Fprintln(os.Stderr, "  cat urls.txt | techdetect -format jsonl -browser")
+			fmt.Fprintln(os.Stderr, "  techdetect -targets urls.txt -format jsonl")
+			fmt.Fprintln(os.Stderr, "  techdetect -har capture.har")
+			fmt.Fprintln(os.Stderr, "  techdetect stats [-fingerprints dir] [-format json]")
 			fmt.Fprintln(os.Stderr, "")
 			flag.PrintDefaults()
 		}
@@ -71,13 +169,110 @@ func main() {
 	}
 
 	// Create detector
-	var detector *techdetect.Detector
-	var err error
-	if *insecure {
-		detector, err = techdetect.NewDetectorWithOptions(*fingerprintsDir, true, *proxyURL)
-	} else {
-		detector, err = techdetect.NewDetectorWithOptions(*fingerprintsDir, false, *proxyURL)
+	opts := techdetect.Options{
+		InsecureSkipVerify:    *insecure,
+		ProxyURL:              *proxyURL,
+		ProxyRotation:         *proxyRotation,
+		Explain:               *explain || *snippet > 0,
+		SnippetLength:         *snippet,
+		IncludeHeaders:        *includeHeaders,
+		IncludeTransaction:    *includeTransaction,
+		TLSFallback:           *tlsFallback,
+		PerURLDeadline:        *urlDeadline,
+		ResponseHeaderTimeout: *responseHeaderTimeout,
+		BodyIdleTimeout:       *bodyIdleTimeout,
+		AllowSensitive:        *allowSensitive,
+		ReadOnly:              *readOnly,
+		StrictFingerprints:    *strict,
+		BrowserRequiredOnly:   *browserRequiredOnly,
+		BrowserProfile:        *browserProfile,
+		BrowserFlags:          strings.Fields(*browserFlags),
+		BrowserHeadful:        *browserHeadful,
+		VersionPolicy:         *versionPolicy,
+		Only:                  only,
+		HitStats:              *hitStats,
+	}
+	if *requestCache > 0 {
+		opts.RequestCache = techdetect.NewRequestCache(*requestCache)
+	}
+	if *tlsFallback && !flagWasSet("insecure") {
+		opts.InsecureSkipVerify = false
+	}
+	if strings.Contains(*proxyURL, ",") {
+		opts.ProxyURL = ""
+		for _, p := range strings.Split(*proxyURL, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				opts.ProxyURLs = append(opts.ProxyURLs, p)
+			}
+		}
+	}
+	if *insecureHosts != "" {
+		opts.InsecureHosts = strings.Split(*insecureHosts, ",")
+		// Per-host policy replaces the blanket default unless -insecure was given explicitly
+		if !flagWasSet("insecure") {
+			opts.InsecureSkipVerify = false
+		}
+	}
+	if *denyPrivate || *allowHosts != "" || *denyHosts != "" {
+		var allow, deny []string
+		if *allowHosts != "" {
+			allow = strings.Split(*allowHosts, ",")
+		}
+		if *denyHosts != "" {
+			deny = strings.Split(*denyHosts, ",")
+		}
+		policy, err := techdetect.NewHostPolicy(allow, deny)
+		if err != nil {
+			log.Fatalf("Invalid host policy: %v", err)
+		}
+		opts.HostPolicy = policy
+	}
+	for _, path := range strings.Split(*extraPaths, ",") {
+		switch path = strings.TrimSpace(path); path {
+		case "":
+		case "common":
+			opts.ExtraPaths = append(opts.ExtraPaths, techdetect.CommonExtraPaths...)
+		default:
+			opts.ExtraPaths = append(opts.ExtraPaths, path)
+		}
+	}
+	if *cookie != "" {
+		cookies, err := http.ParseCookie(*cookie)
+		if err != nil {
+			log.Fatalf("Invalid -cookie: %v", err)
+		}
+		opts.Cookies = make(map[string]string, len(cookies))
+		for _, c := range cookies {
+			opts.Cookies[c.Name] = c.Value
+		}
+		// Credentials are never sent to every target of a batch
+		for _, domain := range strings.Split(*cookieDomain, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				opts.CookieDomains = append(opts.CookieDomains, domain)
+			}
+		}
+		if len(opts.CookieDomains) == 0 {
+			log.Fatal("-cookie requires -cookie-domain")
+		}
+	}
+	if *categories != "" {
+		for _, field := range strings.Split(*categories, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				log.Fatalf("Invalid -categories value %q", field)
+			}
+			opts.Categories = append(opts.Categories, id)
+		}
+	}
+	for _, p := range append(opts.ProxyURLs, opts.ProxyURL) {
+		if p == "" {
+			continue
+		}
+		if err := techdetect.ValidateProxyURL(p); err != nil {
+			log.Fatalf("Invalid -proxy: %v", err)
+		}
 	}
+	detector, err := techdetect.NewDetectorWithConfig(*fingerprintsDir, opts)
 	if err != nil {
 		if *format == "text" {
 			log.Fatalf("Failed to initialize detector: %v", err)
@@ -90,6 +285,8 @@ func main() {
 					Technologies: make(map[string]string),
 					Mode:         "http",
 					Error:        fmt.Sprintf("Failed to initialize detector: %v", err),
+
+					SchemaVersion: techdetect.ResultSchemaVersion,
 				}
 				output, _ := json.Marshal(scanResult)
 				fmt.Println(string(output))
@@ -104,70 +301,162 @@ func main() {
 					Error:        fmt.Sprintf("Failed to initialize detector: %v", err),
 				})
 			}
-			batch := techdetect.BatchResults{Results: results}
+			batch := techdetect.BatchResults{SchemaVersion: techdetect.ResultSchemaVersion, Results: results}
 			output, _ := json.MarshalIndent(batch, "", "  ")
 			fmt.Println(string(output))
 		}
 		os.Exit(1)
 	}
 
+	if !*quiet {
+		for _, duplicate := range detector.Duplicates() {
+			fmt.Fprintf(os.Stderr, "Warning: duplicate fingerprint: %s\n", duplicate)
+		}
+		if skipped := detector.SkippedProbes(); len(skipped) > 0 {
+			fmt.Fprintf(os.Stderr, "Read-only: skipping %d probe(s) that use a method other than GET or HEAD\n", len(skipped))
+		}
+	}
+
+	var withTags []string
+	if *withTag != "" {
+		withTags = strings.Split(*withTag, ",")
+	}
+
 	// Determine mode string
 	mode := "http"
 	if *useBrowser {
 		mode = "hybrid"
 	}
 
+	// Cancel in-flight scans on SIGINT/SIGTERM and flush what was collected;
+	// a second signal terminates immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	text := textOutput{quiet: *quiet}
+
+	// Grouped results need the whole batch, so only ndjson-tech keeps streaming
+	streamFormat := *format
+	if *groupBy != "" && *format != "ndjson-tech" {
+		streamFormat = ""
+	}
+
 	// Process URLs and collect results
-	var batchResults []techdetect.ScanResult
+	var batchResults []urlResult
 
-	for _, targetURL := range urls {
-		// Perform detection
-		var result *techdetect.DetectResult
-		var scanErr error
+	var baseline techdetect.Baseline
+	if *baselinePath != "" {
+		f, err := os.Open(*baselinePath)
+		if err != nil {
+			log.Fatalf("Failed to open baseline: %v", err)
+		}
+		baseline, err = techdetect.ReadBaseline(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Failed to load baseline: %v", err)
+		}
+	}
 
-		if *useBrowser {
-			result, scanErr = detector.DetectFull(targetURL)
-		} else {
-			result, scanErr = detector.DetectHTTPOnly(targetURL)
+	if *recordPath != "" {
+		if err := detector.RecordTo(*recordPath); err != nil {
+			log.Fatalf("Failed to start recording: %v", err)
 		}
+		defer detector.StopRecording()
+	}
 
-		// Convert to ScanResult format
-		technologies := make(map[string]string)
-		var errorMsg string
+	if offline {
+		batchResults = analyzeOffline(detector, *harPath, *replayPath, withTags)
+		for i := range batchResults {
+			compareBaseline(&batchResults[i], baseline)
+			printStreaming(streamFormat, &batchResults[i])
+		}
+	}
 
-		if scanErr != nil {
-			errorMsg = scanErr.Error()
-		} else if result != nil {
-			for _, tech := range result.Technologies {
-				technologies[tech.Name] = tech.Version
-			}
+	// Progress would be torn by results streamed to the same terminal
+	var prog *progress
+	streamsToTerminal := (streamFormat == "jsonl" || streamFormat == "ndjson-tech") && isTerminal(os.Stdout)
+	if !*quiet && !streamsToTerminal && len(urls) > 1 {
+		prog = startProgress(len(urls))
+	}
+
+	for _, targetURL := range urls {
+		if ctx.Err() != nil {
+			break
 		}
+		batchResults = append(batchResults, scanURL(ctx, detector, targetURL, *useBrowser, mode, withTags, *includeApex))
+		compareBaseline(&batchResults[len(batchResults)-1], baseline)
+		prog.add()
 
-		scanResult := techdetect.ScanResult{
-			URL:          targetURL,
-			Technologies: technologies,
-			Mode:         mode,
-			Error:        errorMsg,
+		// For streaming formats, output immediately (failed URLs wait for the retry passes)
+		if result := &batchResults[len(batchResults)-1]; !result.failed() || *retryFailed == 0 {
+			printStreaming(streamFormat, result)
 		}
+	}
 
-		batchResults = append(batchResults, scanResult)
+	// Retry failed URLs with backoff
+	for attempt := 1; attempt <= *retryFailed && ctx.Err() == nil; attempt++ {
+		var failed []int
+		for i, result := range batchResults {
+			if result.failed() {
+				failed = append(failed, i)
+			}
+		}
+		if len(failed) == 0 {
+			break
+		}
 
-		// For JSONL, output immediately
-		if *format == "jsonl" {
-			output, err := json.Marshal(scanResult)
-			if err != nil {
-				// Should never happen, but handle gracefully
-				continue
+		select {
+		case <-time.After(min(retryBackoff<<min(attempt-1, 30), maxRetryBackoff)):
+		case <-ctx.Done():
+		}
+		for _, i := range failed {
+			if ctx.Err() != nil {
+				break
+			}
+			batchResults[i] = scanURL(ctx, detector, batchResults[i].scan.URL, *useBrowser, mode, withTags, *includeApex)
+			compareBaseline(&batchResults[i], baseline)
+			if !batchResults[i].failed() {
+				printStreaming(streamFormat, &batchResults[i])
 			}
-			fmt.Println(string(output))
 		}
 	}
 
+	prog.stop()
+
+	// Stream results still held back for retries
+	for i := range batchResults {
+		printStreaming(streamFormat, &batchResults[i])
+	}
+
+	scanned := len(batchResults)
+	if baseline != nil {
+		batchResults = changedResults(batchResults)
+	}
+
+	if *groupBy == "host" {
+		printGrouped(*format, text, detector, batchResults)
+		*format = "grouped"
+	}
+
 	// Output results based on format
 	switch *format {
+	case "grouped":
+		// Already output by host
+
 	case "json":
+		scanResults := make([]techdetect.ScanResult, 0, len(batchResults))
+		for _, result := range batchResults {
+			scanResults = append(scanResults, result.scan)
+		}
+		dbInfo := detector.DatabaseInfo()
 		batch := techdetect.BatchResults{
-			Results: batchResults,
+			SchemaVersion: techdetect.ResultSchemaVersion,
+			Database:      &dbInfo,
+			Results:       scanResults,
 		}
 		output, err := json.MarshalIndent(batch, "", "  ")
 		if err != nil {
@@ -175,28 +464,371 @@ func main() {
 		}
 		fmt.Println(string(output))
 
-	case "jsonl":
+	case "jsonl", "ndjson-tech":
 		// Already output during processing
 		// Do nothing here
 
+	case "cyclonedx":
+		printCycloneDX(detector, batchResults)
+
 	case "text":
 		fallthrough
 	default:
 		// Human-readable output
-		for _, scanResult := range batchResults {
-			if scanResult.Error != "" {
-				fmt.Printf("\n❌ %s - Error: %s\n", scanResult.URL, scanResult.Error)
-			} else {
-				fmt.Printf("\n🔍 %s - Detected %d technologies:\n\n", scanResult.URL, len(scanResult.Technologies))
-				for name, version := range scanResult.Technologies {
-					if version != "" {
-						fmt.Printf("  ✓ %s (v%s)\n", name, version)
-					} else {
-						fmt.Printf("  ✓ %s\n", name)
-					}
+		for _, result := range batchResults {
+			text.result(result.scan)
+		}
+		text.end()
+	}
+
+	if *hitStats {
+		printHitStats(detector.HitStats())
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted: flushed %d of %d results\n", scanned, len(urls))
+		os.Exit(130)
+	}
+}
+
+// printGrouped writes the batch nested by host in the selected format
+func printGrouped(format string, text textOutput, detector *techdetect.Detector, batchResults []urlResult) {
+	scanResults := make([]techdetect.ScanResult, 0, len(batchResults))
+	for _, result := range batchResults {
+		scanResults = append(scanResults, result.scan)
+	}
+	hosts := techdetect.GroupByHost(scanResults)
+
+	switch format {
+	case "json":
+		dbInfo := detector.DatabaseInfo()
+		output, err := json.MarshalIndent(techdetect.HostBatchResults{
+			SchemaVersion: techdetect.ResultSchemaVersion,
+			Database:      &dbInfo,
+			Hosts:         hosts,
+		}, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal JSON: %v", err)
+		}
+		fmt.Println(string(output))
+
+	case "jsonl":
+		for _, host := range hosts {
+			host.SchemaVersion = techdetect.ResultSchemaVersion
+			printJSON(host)
+		}
+
+	case "ndjson-tech":
+		// Records already carry their URL, streamed during processing
+
+	default:
+		for _, host := range hosts {
+			text.host(host)
+		}
+		text.end()
+	}
+}
+
+// stringList is a flag value collecting every occurrence of a repeatable flag, each of
+// which may also list several comma-separated values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// flagWasSet checks if a flag was given explicitly on the command line
+func flagWasSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// urlResult pairs the scan result of a URL with its full report (nil on error)
+type urlResult struct {
+	scan      techdetect.ScanResult
+	report    *techdetect.Report
+	printed   bool // already written by a streaming format
+	unchanged bool // same technologies as in the -baseline, not written at all
+}
+
+// failed checks if a scan is worth retrying: it errored, or some probe paths couldn't be
+// fetched and nothing was detected, as when the target was down
+func (r *urlResult) failed() bool {
+	if r.scan.Error != "" {
+		return true
+	}
+	return r.report != nil && len(r.report.FailedPaths) > 0 && len(r.report.Technologies) == 0
+}
+
+// compareBaseline records how a successful scan differs from the baseline, or marks it
+// unchanged (no-op without a baseline)
+func compareBaseline(result *urlResult, baseline techdetect.Baseline) {
+	if baseline == nil || result.scan.Error != "" {
+		return
+	}
+	diff := baseline.Diff(result.scan)
+	result.unchanged = diff.Empty()
+	if !result.unchanged {
+		result.scan.Diff = diff
+	}
+}
+
+// changedResults drops the results unchanged since the baseline
+func changedResults(results []urlResult) []urlResult {
+	changed := results[:0]
+	for _, result := range results {
+		if !result.unchanged {
+			changed = append(changed, result)
+		}
+	}
+	return changed
+}
+
+// scanURL runs detection on a single URL and converts it to ScanResult format
+func scanURL(ctx context.Context, detector *techdetect.Detector, targetURL string, useBrowser bool, mode string, withTags []string, includeApex bool) urlResult {
+	analyze := detector.Analyze
+	if includeApex {
+		analyze = detector.AnalyzeWithApex
+	}
+	report, scanErr := analyze(ctx, targetURL, useBrowser)
+	keepTagged(report, withTags)
+	if ctx.Err() != nil {
+		// Cut short by an interrupt; keep any partial detections
+		scanErr = errors.New("scan interrupted")
+	}
+	return newURLResult(targetURL, mode, report, scanErr)
+}
+
+// analyzeOffline runs detection on the sites recorded in a HAR file or a -record recording
+func analyzeOffline(detector *techdetect.Detector, harPath, replayPath string, withTags []string) []urlResult {
+	var reports []*techdetect.Report
+	if replayPath != "" {
+		var err error
+		reports, err = detector.ReplayFrom(replayPath)
+		if err != nil {
+			log.Fatalf("Failed to replay recording: %v", err)
+		}
+	} else {
+		f, err := os.Open(harPath)
+		if err != nil {
+			log.Fatalf("Failed to open HAR file: %v", err)
+		}
+		defer f.Close()
+
+		reports, err = detector.AnalyzeHAR(f)
+		if err != nil {
+			log.Fatalf("Failed to analyze HAR file: %v", err)
+		}
+	}
+
+	results := make([]urlResult, 0, len(reports))
+	for _, report := range reports {
+		keepTagged(report, withTags)
+		results = append(results, newURLResult(report.URL, report.Mode, report, nil))
+	}
+	return results
+}
+
+// keepTagged drops the technologies of a report that carry none of the tags (no-op without tags)
+func keepTagged(report *techdetect.Report, tags []string) {
+	if report == nil || len(tags) == 0 {
+		return
+	}
+
+	kept := make(map[string]bool)
+	techs := report.Technologies[:0]
+	for _, tech := range report.Technologies {
+		for _, tag := range tags {
+			if techdetect.HasTag(tech.Tags, strings.TrimSpace(tag)) {
+				techs = append(techs, tech)
+				kept[tech.Name] = true
+				break
+			}
+		}
+	}
+	report.Technologies = techs
+
+	for cat, scores := range report.CategoryConfidence {
+		keptScores := scores[:0]
+		for _, score := range scores {
+			if kept[score.Name] {
+				keptScores = append(keptScores, score)
+			}
+		}
+		if len(keptScores) == 0 {
+			delete(report.CategoryConfidence, cat)
+		} else {
+			report.CategoryConfidence[cat] = keptScores
+		}
+	}
+
+	explanations := report.Explain[:0]
+	for _, e := range report.Explain {
+		if kept[e.Technology] {
+			explanations = append(explanations, e)
+		}
+	}
+	report.Explain = explanations
+}
+
+// newURLResult converts a report (or the error that prevented it) to ScanResult format
+func newURLResult(targetURL, mode string, report *techdetect.Report, scanErr error) urlResult {
+	technologies := make(map[string]string)
+	var versions map[string][]string
+	var errorMsg string
+
+	if scanErr != nil {
+		errorMsg = scanErr.Error()
+	}
+	var explanations []techdetect.Explanation
+	var hosts map[string][]string
+	var metadata map[string]map[string]string
+	var headers map[string]map[string]string
+	var transaction []techdetect.HTTPHop
+	tlsInvalid := false
+	if report != nil {
+		explanations = report.Explain
+		headers = report.Headers
+		transaction = report.Transaction
+		tlsInvalid = report.TLSInvalid
+		for _, tech := range report.Technologies {
+			technologies[tech.Name] = tech.Version
+			if len(tech.Versions) > 1 {
+				if versions == nil {
+					versions = make(map[string][]string)
+				}
+				versions[tech.Name] = tech.Versions
+			}
+			if len(tech.Hosts) > 0 {
+				if hosts == nil {
+					hosts = make(map[string][]string)
+				}
+				hosts[tech.Name] = tech.Hosts
+			}
+			if len(tech.Metadata) > 0 {
+				if metadata == nil {
+					metadata = make(map[string]map[string]string)
 				}
+				metadata[tech.Name] = tech.Metadata
 			}
 		}
-		fmt.Println()
+	}
+
+	return urlResult{
+		scan: techdetect.ScanResult{
+			URL:          targetURL,
+			Technologies: technologies,
+			Versions:     versions,
+			Mode:         mode,
+			Error:        errorMsg,
+			Explain:      explanations,
+			TLSInvalid:   tlsInvalid,
+			Hosts:        hosts,
+			Metadata:     metadata,
+			Headers:      headers,
+			Transaction:  transaction,
+		},
+		report: report,
+	}
+}
+
+// printStreaming writes a result once in the line-oriented formats; other formats are printed at the end
+func printStreaming(format string, result *urlResult) {
+	if result.printed || result.unchanged {
+		return
+	}
+	result.printed = true
+
+	switch format {
+	case "jsonl":
+		line := result.scan
+		line.SchemaVersion = techdetect.ResultSchemaVersion
+		printJSON(line)
+	case "ndjson-tech":
+		if result.report == nil {
+			fmt.Fprintf(os.Stderr, "%s - Error: %s\n", result.scan.URL, result.scan.Error)
+			return
+		}
+		for _, tech := range result.report.Technologies {
+			source := ""
+			if len(tech.Sources) > 0 {
+				source = tech.Sources[0]
+			}
+			printJSON(techdetect.TechnologyRecord{
+				URL:        result.scan.URL,
+				Technology: tech.Name,
+				Version:    tech.Version,
+				Categories: tech.Categories,
+				Confidence: tech.Confidence,
+				Source:     source,
+				Tags:       tech.Tags,
+				Hosts:      tech.Hosts,
+				Metadata:   tech.Metadata,
+
+				SchemaVersion: techdetect.ResultSchemaVersion,
+			})
+		}
+	}
+}
+
+// printJSON writes a value as a single JSON line
+func printJSON(v interface{}) {
+	output, err := json.Marshal(v)
+	if err != nil {
+		// Should never happen, but handle gracefully
+		return
+	}
+	fmt.Println(string(output))
+}
+
+// runStats prints coverage statistics for the fingerprint database
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fingerprintsDir := fs.String("fingerprints", "./data/fingerprints", "Path to fingerprints directory")
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Parse(args)
+
+	stats, err := techdetect.NewLoader(*fingerprintsDir).Stats()
+	if err != nil {
+		log.Fatalf("Failed to load fingerprints: %v", err)
+	}
+
+	if *format == "json" {
+		output, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal JSON: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	fmt.Printf("Fingerprints:          %d\n", stats.Total)
+	fmt.Printf("With HTTP probes:      %d (%d probes)\n", stats.WithPaths, stats.TotalPathProbes)
+	fmt.Printf("With browser probes:   %d (%d probes)\n", stats.WithBrowser, stats.TotalBrowserProbes)
+	fmt.Printf("With version extract:  %d\n", stats.WithVersion)
+	fmt.Printf("With implies:          %d\n", stats.WithImplies)
+	fmt.Printf("Uncategorized:         %d\n", stats.Uncategorized)
+	fmt.Println()
+	fmt.Println("By category:")
+	for _, cat := range stats.SortedCategories() {
+		name := "unknown"
+		if c, ok := techdetect.CategoryByID(cat); ok {
+			name = c.Name
+		}
+		fmt.Printf("  %4d  %-30s %d\n", cat, name, stats.ByCategory[cat])
 	}
 }
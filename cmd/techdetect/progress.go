@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often the progress line is redrawn
+const progressInterval = time.Second
+
+// progress redraws a "processed/total" line with the scan rate on stderr
+type progress struct {
+	total     int
+	processed atomic.Int64
+	started   time.Time
+
+	stopOnce sync.Once
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// startProgress starts drawing progress on stderr if it is a terminal, and returns nil
+// otherwise. All methods are no-ops on a nil progress.
+func startProgress(total int) *progress {
+	if !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	p := &progress{
+		total:    total,
+		started:  time.Now(),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// run redraws the line until stop is called
+func (p *progress) run() {
+	defer close(p.finished)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.draw()
+		case <-p.done:
+			// Erase the line so it doesn't mix with later output
+			fmt.Fprint(os.Stderr, "\r\033[K")
+			return
+		}
+	}
+}
+
+// draw writes the current state over the previous line
+func (p *progress) draw() {
+	processed := p.processed.Load()
+	rate := float64(processed) / time.Since(p.started).Seconds()
+	fmt.Fprintf(os.Stderr, "\r\033[K[%d/%d] %.1f URLs/s", processed, p.total, rate)
+}
+
+// add counts a processed URL
+func (p *progress) add() {
+	if p != nil {
+		p.processed.Add(1)
+	}
+}
+
+// stop erases the progress line and waits for the drawing goroutine to exit
+func (p *progress) stop() {
+	if p == nil {
+		return
+	}
+	p.stopOnce.Do(func() {
+		close(p.done)
+	})
+	<-p.finished
+}
+
+// isTerminal checks if a file is an interactive terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	techdetect "github.com/X-Cotang/UltraTechDetector"
+)
+
+// textOutput writes the human-readable format. Results go to stdout and diagnostics
+// (scan errors, certificate warnings) to stderr. Quiet mode drops the decoration and
+// writes one tab-separated "target, technology, version" line per technology.
+type textOutput struct {
+	quiet bool
+}
+
+// result writes the technologies detected on one URL
+func (t textOutput) result(scan techdetect.ScanResult) {
+	if scan.Error != "" {
+		t.failure(scan.URL, scan.Error)
+		return
+	}
+
+	if scan.TLSInvalid {
+		fmt.Fprintf(os.Stderr, "⚠ %s - invalid TLS certificate\n", scan.URL)
+	}
+	if !t.quiet {
+		fmt.Printf("\n🔍 %s - Detected %d technologies:\n\n", scan.URL, len(scan.Technologies))
+	}
+	for name, version := range scan.Technologies {
+		t.tech(scan.URL, name, version, scan.Versions[name])
+	}
+	t.diff(scan.Diff)
+	t.explanations(scan.Explain)
+}
+
+// diff writes the -baseline changes below the technologies
+func (t textOutput) diff(diff *techdetect.ScanDiff) {
+	if diff == nil || t.quiet {
+		return
+	}
+	fmt.Println()
+	if diff.New {
+		fmt.Println("  (not in baseline)")
+		return
+	}
+	for _, name := range sortedNames(diff.Added) {
+		fmt.Println(strings.TrimRight("  + "+name+" "+diff.Added[name], " "))
+	}
+	for _, name := range sortedNames(diff.Removed) {
+		fmt.Println(strings.TrimRight("  - "+name+" "+diff.Removed[name], " "))
+	}
+	for _, name := range sortedNames(diff.Changed) {
+		fmt.Printf("  ~ %s %s -> %s\n", name, diff.Changed[name].From, diff.Changed[name].To)
+	}
+}
+
+// sortedNames returns the keys of a map in order
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// host writes the technologies merged across the endpoints of one host
+func (t textOutput) host(host techdetect.HostResults) {
+	if !t.quiet {
+		fmt.Printf("\n🔍 %s - Detected %d technologies across %d endpoints:\n\n", host.Host, len(host.Technologies), len(host.Endpoints))
+	}
+	for name, version := range host.Technologies {
+		t.tech(host.Host, name, version, host.Versions[name])
+	}
+	for _, endpoint := range host.Endpoints {
+		if endpoint.Error != "" {
+			t.failure(endpoint.URL, endpoint.Error)
+		}
+	}
+}
+
+// end finishes the output after the last result
+func (t textOutput) end() {
+	if !t.quiet {
+		fmt.Println()
+	}
+}
+
+// failure reports a target that could not be scanned
+func (t textOutput) failure(target, message string) {
+	if t.quiet {
+		fmt.Fprintf(os.Stderr, "%s - Error: %s\n", target, message)
+	} else {
+		fmt.Fprintf(os.Stderr, "❌ %s - Error: %s\n", target, message)
+	}
+}
+
+// tech writes one detected technology
+func (t textOutput) tech(target, name, version string, versions []string) {
+	if len(versions) > 1 {
+		version = strings.Join(versions, ", ")
+	}
+
+	if t.quiet {
+		fmt.Printf("%s\t%s\t%s\n", target, name, version)
+		return
+	}
+	if len(versions) > 1 {
+		fmt.Printf("  ✓ %s (v%s)\n", name, strings.Join(versions, ", v"))
+	} else if version != "" {
+		fmt.Printf("  ✓ %s (v%s)\n", name, version)
+	} else {
+		fmt.Printf("  ✓ %s\n", name)
+	}
+}
+
+// explanations writes the -explain details, indented below the technologies. Quiet
+// mode leaves them out so stdout only holds technology lines; use -format json for both.
+func (t textOutput) explanations(explanations []techdetect.Explanation) {
+	if len(explanations) == 0 || t.quiet {
+		return
+	}
+	fmt.Println()
+	for _, e := range explanations {
+		fmt.Printf("  %s (%s)\n", e.Technology, e.Source)
+		for _, m := range e.Matches {
+			fmt.Printf("    %s %s %s at %d+%d of %d: %q\n", m.Path, m.Field, m.Operator, m.Offset, m.Length, m.Size, m.Matched)
+			if m.Snippet != "" {
+				fmt.Printf("      %q\n", m.Snippet)
+			}
+		}
+	}
+}
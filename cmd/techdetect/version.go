@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	techdetect "github.com/X-Cotang/UltraTechDetector"
+)
+
+// version is set at release time with -ldflags "-X main.version=v1.2.3"; otherwise
+// the module version and VCS revision recorded in the build info are used
+var version = ""
+
+// buildVersion describes the binary: its version, plus the commit it was built from
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	v := version
+	if v == "" && ok {
+		v = info.Main.Version
+	}
+	if v == "" {
+		v = "(devel)"
+	}
+	if !ok {
+		return v
+	}
+
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision == "" {
+		return v
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += ", modified"
+	}
+	return fmt.Sprintf("%s (commit %s)", v, revision)
+}
+
+// printVersion writes the tool version, Go version and the fingerprint database in use
+func printVersion(fingerprintsDir string) error {
+	loader := techdetect.NewLoader(fingerprintsDir)
+	if _, err := loader.LoadAll(); err != nil {
+		return fmt.Errorf("failed to load fingerprints: %w", err)
+	}
+	db := loader.Info()
+
+	source := "embedded"
+	if fingerprintsDir != "" && fingerprintsDir != "./data/fingerprints" {
+		source = fingerprintsDir
+	}
+
+	fmt.Printf("techdetect %s\n", buildVersion())
+	fmt.Printf("%s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("fingerprints: %d in %d files (%s)\n", db.Fingerprints, db.Files, source)
+	fmt.Printf("database hash: %s\n", db.Hash)
+	if db.Updated != "" {
+		fmt.Printf("database updated: %s\n", db.Updated)
+	}
+	return nil
+}
@@ -1,15 +1,43 @@
 package techdetect
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 )
 
-// Detector is the main detection engine
+// ErrURLDeadline is returned, with the partial results, when a URL exceeds Options.PerURLDeadline
+var ErrURLDeadline = errors.New("per-URL deadline exceeded")
+
+// Detector is the main detection engine. Once constructed, a Detector is safe for
+// concurrent use: the fingerprints and path classifications are only read by scans, and
+// each scan builds its own results, so a service should create one and share it instead
+// of loading the fingerprints per request.
 type Detector struct {
 	httpDetector    *HTTPDetector
 	browserDetector *BrowserDetector
 	fingerprints    map[string]Fingerprint
 	loader          *Loader
+	perURLDeadline  time.Duration
+
+	// browserRequiredOnly limits browser classifications to browser-required technologies
+	browserRequiredOnly bool
+
+	// only limits the probed fingerprints to these technologies, see Options.Only
+	only []string
+
+	// hits counts detections across scans, nil without Options.HitStats
+	hits *hitCounter
+
+	// skippedProbes are the probes Options.ReadOnly keeps from being sent
+	skippedProbes []SkippedProbe
+
+	// Fingerprints grouped by path once, instead of on every scan; see setFingerprints
+	pathClassifications    []PathClassification        // for HTTP scans
+	rootClassifications    []PathClassification        // the plain GET of "/", for DetectRootOnly
+	offlineClassifications []PathClassification        // for replays, including sensitive probes
+	browserClassifications []BrowserPathClassification // for browser scans
 }
 
 // NewDetector creates a new detection engine
@@ -19,58 +47,278 @@ func NewDetector(fingerprintsDir string) (*Detector, error) {
 
 // NewDetectorWithOptions creates a new detection engine with custom options
 func NewDetectorWithOptions(fingerprintsDir string, insecureSkipVerify bool, proxyURL string) (*Detector, error) {
-	loader := NewLoader(fingerprintsDir)
-	fingerprints, err := loader.LoadAll()
+	return NewDetectorWithConfig(fingerprintsDir, Options{
+		InsecureSkipVerify: insecureSkipVerify,
+		ProxyURL:           proxyURL,
+	})
+}
+
+// NewDetectorWithConfig creates a new detection engine from an Options struct
+func NewDetectorWithConfig(fingerprintsDir string, opts Options) (*Detector, error) {
+	return NewDetectorWithLoader(NewLoader(fingerprintsDir), opts)
+}
+
+// NewDetectorWithLoader creates a new detection engine with fingerprints read by loader,
+// e.g. one created with NewLoaderFromFS
+func NewDetectorWithLoader(loader *Loader, opts Options) (*Detector, error) {
+	if err := checkProxyRotation(opts.ProxyRotation); err != nil {
+		return nil, err
+	}
+	var filter FingerprintFilter
+	if len(opts.Categories) > 0 {
+		filter = InCategories(opts.Categories...)
+	}
+	fingerprints, err := loader.LoadFiltered(filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load fingerprints: %w", err)
 	}
+	if duplicates := loader.Duplicates(); opts.StrictFingerprints && len(duplicates) > 0 {
+		msg := duplicates[0].String()
+		if len(duplicates) > 1 {
+			msg += fmt.Sprintf(" (and %d more)", len(duplicates)-1)
+		}
+		return nil, fmt.Errorf("duplicate fingerprint definition: %s", msg)
+	}
+
+	d := &Detector{
+		httpDetector:        NewHTTPDetectorWithConfig(opts),
+		browserDetector:     NewBrowserDetectorWithConfig(opts),
+		loader:              loader,
+		perURLDeadline:      opts.PerURLDeadline,
+		browserRequiredOnly: opts.BrowserRequiredOnly,
+		only:                opts.Only,
+	}
+	if opts.HitStats {
+		d.hits = &hitCounter{}
+	}
+	// One notifier for both stages, so callbacks never overlap
+	if n := d.httpDetector.notifier; n != nil {
+		n.classify = func(tech *Technology) {
+			fp := d.fingerprints[tech.Name]
+			tech.Cats, tech.Tags = fp.Classify(tech.Version)
+		}
+		d.browserDetector.notifier = n
+	}
+	if err := d.setFingerprints(fingerprints); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// setFingerprints replaces the fingerprint set and the path classifications derived from it
+func (d *Detector) setFingerprints(fingerprints map[string]Fingerprint) error {
+	// Every fingerprint stays known for implied technologies and reports; only the
+	// selected ones are probed
+	probed := fingerprints
+	if len(d.only) > 0 {
+		var err error
+		if probed, err = SelectTechnologies(fingerprints, d.only); err != nil {
+			return err
+		}
+	}
+
+	d.fingerprints = fingerprints
+	d.pathClassifications = d.httpDetector.classify(probed)
+	d.skippedProbes = nil
+	if d.httpDetector.readOnly {
+		d.skippedProbes = writeProbes(probed)
+	}
+	d.rootClassifications = nil
+	for _, classification := range d.pathClassifications {
+		// Probes sending a different request to "/" would need another fetch
+		if classification.Path == "/" && requestCacheKey("/", classification.RequestConf) == requestCacheKey("/", nil) {
+			d.rootClassifications = append(d.rootClassifications, classification)
+		}
+	}
+	d.offlineClassifications = OrderByRequirements(withExtraPaths(ClassifyByPath(probed), d.httpDetector.extraPaths))
+	d.browserClassifications = ClassifyBrowserByPath(probed)
+	if d.browserRequiredOnly {
+		browserRequired := make(map[string]Fingerprint)
+		for name, fp := range probed {
+			if fp.NeedsBrowser() {
+				browserRequired[name] = fp
+			}
+		}
+		d.browserClassifications = ClassifyBrowserByPath(browserRequired)
+	}
+	return nil
+}
+
+// Duplicates lists the technologies defined by more than one fingerprint file, see
+// Loader.Duplicates
+func (d *Detector) Duplicates() []DuplicateDefinition {
+	return d.loader.Duplicates()
+}
+
+// DatabaseInfo returns the version, timestamp and content hash of the loaded fingerprints
+func (d *Detector) DatabaseInfo() DatabaseInfo {
+	return d.loader.Info()
+}
+
+// WarmupBrowser launches the browser used by browser scans ahead of the first scan,
+// see BrowserDetector.Warmup. Call Close when done with the detector.
+func (d *Detector) WarmupBrowser(ctx context.Context) error {
+	return d.browserDetector.Warmup(ctx)
+}
+
+// BrowserHealthy reports whether the warmed-up browser is responsive
+func (d *Detector) BrowserHealthy() bool {
+	return d.browserDetector.Healthy()
+}
 
-	return &Detector{
-		httpDetector:    NewHTTPDetectorWithOptions(insecureSkipVerify, proxyURL),
-		browserDetector: NewBrowserDetectorWithOptions(proxyURL),
-		fingerprints:    fingerprints,
-		loader:          loader,
-	}, nil
+// Close releases the browser started by WarmupBrowser
+func (d *Detector) Close() error {
+	return d.browserDetector.Close()
 }
 
 // DetectResult contains detection results
 type DetectResult struct {
 	Technologies []Technology `json:"technologies"`
 	FailedPaths  []string     `json:"failed_paths,omitempty"`
+	Transaction  []HTTPHop    `json:"transaction,omitempty"` // with Options.IncludeTransaction
 }
 
 // Detect performs full detection (HTTP + Browser) on a target URL
 func (d *Detector) Detect(url string, useBrowser bool) (*DetectResult, error) {
+	return d.DetectContext(context.Background(), url, useBrowser)
+}
+
+// DetectContext performs detection on a target URL, honoring cancellation of ctx. When
+// Options.PerURLDeadline is exceeded, the partial results are returned with ErrURLDeadline.
+func (d *Detector) DetectContext(ctx context.Context, url string, useBrowser bool) (*DetectResult, error) {
+	return d.detect(ctx, url, useBrowser, d.pathClassifications)
+}
+
+// DetectRootOnly is a cheap passive scan: it fetches only the target page ("/") once and
+// evaluates the probes of that request, skipping every other path and the browser stage.
+// Technologies whose fingerprints only probe deeper paths are never detected this way.
+func (d *Detector) DetectRootOnly(url string) (*DetectResult, error) {
+	return d.DetectRootOnlyContext(context.Background(), url)
+}
+
+// DetectRootOnlyContext is DetectRootOnly honoring cancellation of ctx
+func (d *Detector) DetectRootOnlyContext(ctx context.Context, url string) (*DetectResult, error) {
+	return d.detect(ctx, url, false, d.rootClassifications)
+}
+
+// detect runs detection over the given path classifications and flattens the results
+func (d *Detector) detect(ctx context.Context, url string, useBrowser bool, classifications []PathClassification) (*DetectResult, error) {
+	run, err := d.run(ctx, url, useBrowser, classifications)
+	if run == nil {
+		return nil, err
+	}
+
+	// Convert map to slice
+	techs := make([]Technology, 0, len(run.results))
+	for _, tech := range run.results {
+		techs = append(techs, *tech)
+	}
+
+	return &DetectResult{
+		Technologies: techs,
+		FailedPaths:  run.failedPaths,
+		Transaction:  run.transaction,
+	}, err
+}
+
+// Detection sources recorded for each technology
+const (
+	SourceHTTP    = "http"
+	SourceBrowser = "browser"
+	SourceImplied = "implied"
+)
+
+// detectRun carries the intermediate data of a single detection run
+type detectRun struct {
+	results     map[string]*Technology
+	sources     map[string][]string // tech name -> stages that contributed
+	failedPaths []string
+	finalURL    string
+	matches     map[string][]Match           // nil unless explaining
+	headers     map[string]map[string]string // probe URL -> response headers, nil unless included
+	tlsInvalid  bool
+	transaction []HTTPHop // nil unless included
+}
+
+// run executes the detection stages and records which stage contributed each technology.
+// Past the per-URL deadline, the remaining stages are skipped and the partial run is
+// returned together with ErrURLDeadline.
+func (d *Detector) run(ctx context.Context, url string, useBrowser bool, classifications []PathClassification) (*detectRun, error) {
+	if d.perURLDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, d.perURLDeadline, ErrURLDeadline)
+		defer cancel()
+	}
+	pastDeadline := func() bool {
+		return errors.Is(context.Cause(ctx), ErrURLDeadline)
+	}
+
+	// Refuse denied targets up front rather than failing every probe path
+	if err := d.httpDetector.hostPolicy.CheckURL(ctx, url); err != nil {
+		return nil, err
+	}
+
 	// Stage 1: HTTP Detection
-	httpResults, failedPaths := d.httpDetector.DetectHTTP(url, d.fingerprints)
+	scan := d.httpDetector.scan(ctx, url, classifications)
+
+	sources := make(map[string][]string)
+	httpVersions := make(map[string]string)
+	for name, tech := range scan.results {
+		sources[name] = []string{SourceHTTP}
+		httpVersions[name] = tech.Version
+	}
 
 	// Stage 2: Browser Detection (optional)
-	var finalResults map[string]*Technology
-	if useBrowser {
-		browserResults, err := d.browserDetector.DetectBrowser(url, d.fingerprints, httpResults)
-		if err != nil {
-			// Browser detection failed, but we still have HTTP results
-			finalResults = httpResults
-		} else {
+	finalResults := scan.results
+	if useBrowser && !pastDeadline() {
+		browserResults, err := d.browserDetector.detect(ctx, url, d.browserClassifications, scan.results)
+		if err == nil {
 			finalResults = browserResults
+			for name, tech := range browserResults {
+				httpVersion, fromHTTP := httpVersions[name]
+				if !fromHTTP || tech.Version != httpVersion {
+					sources[name] = append(sources[name], SourceBrowser)
+				}
+			}
 		}
-	} else {
-		finalResults = httpResults
+		// Browser detection failed, but we still have HTTP results
 	}
 
 	// Add implied technologies
+	notified := seenNames(finalResults)
 	finalResults = d.addImpliedTechnologies(finalResults)
+	d.attachTags(finalResults)
+	d.httpDetector.notifier.notifyNew(url, finalResults, notified)
+	for name := range finalResults {
+		if _, exists := sources[name]; !exists {
+			sources[name] = []string{SourceImplied}
+		}
+	}
+	d.hits.add(sources)
 
-	// Convert map to slice
-	techs := make([]Technology, 0, len(finalResults))
-	for _, tech := range finalResults {
-		techs = append(techs, *tech)
+	run := &detectRun{
+		results:     finalResults,
+		sources:     sources,
+		failedPaths: scan.failedPaths,
+		finalURL:    scan.finalURL,
+		matches:     scan.matches,
+		headers:     scan.headers,
+		tlsInvalid:  scan.tlsInvalid,
+		transaction: scan.transaction,
 	}
+	if pastDeadline() {
+		return run, fmt.Errorf("%w (%s)", ErrURLDeadline, d.perURLDeadline)
+	}
+	return run, nil
+}
 
-	return &DetectResult{
-		Technologies: techs,
-		FailedPaths:  failedPaths,
-	}, nil
+// attachTags copies the fingerprint tags and categories onto detected technologies,
+// applying the version rules to the detected version
+func (d *Detector) attachTags(results map[string]*Technology) {
+	for name, tech := range results {
+		fp := d.fingerprints[name]
+		tech.Cats, tech.Tags = fp.Classify(tech.Version)
+	}
 }
 
 // addImpliedTechnologies adds technologies that are implied by detected technologies
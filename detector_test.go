@@ -0,0 +1,162 @@
+package techdetect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestDetectorConcurrentScans shares one detector, with its request cache, callbacks,
+// hit counts and explanations, across concurrent Detect and Analyze calls; run it with
+// -race to check the shared state
+func TestDetectorConcurrentScans(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Server", "nginx/1.25.3")
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><meta name="generator" content="WordPress 6.4.1"></head></html>`))
+		case "/wp-json/":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"namespaces": ["oembed/1.0", "wp/v2"]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// Calls never overlap, so the callback needs no lock of its own
+	detected := make(map[string]int)
+	d := newTestEngine(t, srv, `{
+		"Nginx": {"cats": [22], "paths": [{"path": "/", "detect": {"headers.server": {"$regex": "nginx/([\\d.]+)\\;version:\\1"}}}]},
+		"WordPress": {"cats": [1], "implies": ["PHP"], "paths": [
+			{"path": "/", "detect": {"body": {"$regex": "WordPress ([\\d.]+)\\;version:\\1"}}},
+			{"path": "/wp-json/", "detect": {"json.namespaces": {"$in": ["wp/v2"]}}}
+		]},
+		"PHP": {"cats": [27]}
+	}`, Options{
+		RequestCache: NewRequestCache(0),
+		OnDetect:     func(url string, tech Technology) { detected[tech.Name]++ },
+		HitStats:     true,
+		Explain:      true,
+	})
+
+	const scans = 32
+	var wg sync.WaitGroup
+	errs := make(chan error, scans)
+	for i := 0; i < scans; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// A few hosts, so scans share cached responses
+			url := fmt.Sprintf("http://site%d.test/", i%4)
+			var names []string
+			if i%2 == 0 {
+				result, err := d.Detect(url, false)
+				if err != nil {
+					errs <- err
+					return
+				}
+				for _, tech := range result.Technologies {
+					names = append(names, tech.Name)
+				}
+			} else {
+				report, err := d.Analyze(context.Background(), url, false)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(report.Explain) != 3 {
+					errs <- fmt.Errorf("%s: %d explanations, want 3", url, len(report.Explain))
+				}
+				for _, tech := range report.Technologies {
+					names = append(names, tech.Name)
+				}
+			}
+			if len(names) != 3 {
+				errs <- fmt.Errorf("%s: detected %v, want Nginx, WordPress and PHP", url, names)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for _, stat := range d.HitStats() {
+		if stat.Detections != scans {
+			t.Errorf("%s detected in %d scans, want %d", stat.Technology, stat.Detections, scans)
+		}
+		if detected[stat.Technology] != scans {
+			t.Errorf("OnDetect reported %s %d times, want %d", stat.Technology, detected[stat.Technology], scans)
+		}
+	}
+}
+
+// BenchmarkDetect scans a local server with the embedded database; the path
+// classifications are built once by the detector and shared by every scan
+func BenchmarkDetect(b *testing.B) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Server", "nginx/1.25.3")
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><meta name="generator" content="WordPress 6.4.1"></head></html>`))
+	}))
+	defer srv.Close()
+
+	d, err := NewDetectorWithConfig("", Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.DetectHTTPOnly(srv.URL); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkClassify measures the classification each scan used to repeat, which
+// the detector now does once when the fingerprints are loaded
+func BenchmarkClassify(b *testing.B) {
+	d, err := NewDetectorWithConfig("", Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.httpDetector.classify(d.fingerprints)
+	}
+}
+
+func TestAnalyzeUnreachableTarget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Drop every connection without a response
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	d := newTestEngine(t, srv, `{
+		"Nginx": {"cats": [22], "paths": [{"path": "/", "detect": {"headers.server": {"$regex": "nginx"}}}]},
+		"WordPress": {"cats": [1], "paths": [{"path": "/wp-json/", "detect": {"json.namespaces": {"$in": ["wp/v2"]}}}]}
+	}`, Options{})
+
+	// Nothing fetched is an empty result, not an error; callers tell from the failed paths
+	report, err := d.Analyze(context.Background(), "http://down.test/", false)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if len(report.Technologies) != 0 || len(report.FailedPaths) != 2 {
+		t.Errorf("technologies %v, failed paths %v, want none and both paths", report.Technologies, report.FailedPaths)
+	}
+}
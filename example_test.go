@@ -0,0 +1,47 @@
+package techdetect_test
+
+import (
+	"encoding/json"
+	"fmt"
+
+	techdetect "github.com/X-Cotang/UltraTechDetector"
+)
+
+// Consumers check the schema_version of each document before relying on its shape.
+// Output written before the field existed has the version 1 shape.
+func ExampleResultSchemaVersion() {
+	documents := []string{
+		`{"results": [{"url": "https://example.com", "technologies": {"React": "18.2.0"}, "mode": "http"}]}`,
+		`{"schema_version": 1, "results": [{"url": "https://example.com", "technologies": {"React": "18.2.0"}, "mode": "http"}]}`,
+		`{"schema_version": 99, "results": []}`,
+	}
+
+	for _, doc := range documents {
+		var batch techdetect.BatchResults
+		if err := json.Unmarshal([]byte(doc), &batch); err != nil {
+			fmt.Println("invalid:", err)
+			continue
+		}
+		if batch.SchemaVersion == 0 {
+			batch.SchemaVersion = 1
+		}
+		if batch.SchemaVersion > techdetect.ResultSchemaVersion {
+			fmt.Printf("version %d: unsupported\n", batch.SchemaVersion)
+			continue
+		}
+		fmt.Printf("version %d: %s uses React %s\n", batch.SchemaVersion, batch.Results[0].URL, batch.Results[0].Technologies["React"])
+	}
+
+	// Nested results don't repeat the version
+	output, _ := json.Marshal(techdetect.BatchResults{
+		SchemaVersion: techdetect.ResultSchemaVersion,
+		Results:       []techdetect.ScanResult{{URL: "https://example.com", Technologies: map[string]string{}, Mode: "http"}},
+	})
+	fmt.Println(string(output))
+
+	// Output:
+	// version 1: https://example.com uses React 18.2.0
+	// version 1: https://example.com uses React 18.2.0
+	// version 99: unsupported
+	// {"schema_version":1,"results":[{"url":"https://example.com","technologies":{},"mode":"http"}]}
+}
@@ -0,0 +1,212 @@
+package techdetect
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Explanation records why a technology was detected
+type Explanation struct {
+	Technology string  `json:"technology"`
+	Source     string  `json:"source"`            // stage that detected it: http, browser, implied, archive
+	Matches    []Match `json:"matches,omitempty"` // conditions that matched, for HTTP and archive detections
+}
+
+// Match is one query condition that matched a probe response
+type Match struct {
+	Path     string `json:"path"`              // probe path
+	Field    string `json:"field"`             // e.g. headers.server, body, json.version
+	Operator string `json:"operator"`          // e.g. $regex, $eq
+	Matched  string `json:"matched,omitempty"` // matched substring for $regex (first one for $count), field value otherwise
+	Version  string `json:"version,omitempty"` // version extracted by the condition
+	Offset   int    `json:"offset"`            // byte offset of the match in the field (0 unless $regex or $count)
+	Length   int    `json:"length"`            // byte length of the match, before truncation of Matched
+	Size     int    `json:"size"`              // byte length of the whole field, e.g. the body
+
+	// Snippet is the match with surrounding text of the field, with Options.SnippetLength.
+	// Empty for a streamed body (Options.StreamBody), whose text isn't kept.
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// maxMatchedLength caps Match.Matched so whole bodies don't end up in explanations
+const maxMatchedLength = 256
+
+// ExplainQuery lists the conditions of a query that match the context. Negated branches
+// ($not, $nor) are skipped, since their match is an absence.
+func (qe *QueryEvaluator) ExplainQuery(query map[string]interface{}, ctx *DetectionContext) []Match {
+	var matches []Match
+
+	var walk func(q map[string]interface{})
+	walk = func(q map[string]interface{}) {
+		keys := make([]string, 0, len(q))
+		for key := range q {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := q[key]
+			switch key {
+			case "$not", "$nor":
+				continue
+			case "$or", "$and":
+				conditions, _ := value.([]interface{})
+				for _, cond := range conditions {
+					if condMap, ok := cond.(map[string]interface{}); ok {
+						walk(condMap)
+					}
+				}
+				continue
+			case "headers":
+				if headers, ok := value.(map[string]interface{}); ok {
+					prefixed := make(map[string]interface{}, len(headers))
+					for name, cond := range headers {
+						prefixed["headers."+strings.ToLower(name)] = cond
+					}
+					walk(prefixed)
+				}
+				continue
+			}
+			matches = append(matches, qe.explainField(key, value, ctx)...)
+		}
+	}
+	walk(query)
+
+	return matches
+}
+
+// explainField lists the operators of a field condition that match on their own
+func (qe *QueryEvaluator) explainField(fieldPath string, condition interface{}, ctx *DetectionContext) []Match {
+	condMap, ok := condition.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	// Explain "any" with the field that satisfied the condition
+	if transforms, ok := isAnyField(fieldPath, ctx); ok {
+		match, _, field := qe.evaluateAny(transforms, condition, ctx)
+		if !match {
+			return nil
+		}
+		fieldPath = field
+	}
+
+	operators := make([]string, 0, len(condMap))
+	for operator := range condMap {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	var matches []Match
+	for _, operator := range operators {
+		if operator == "$not" || operator == "$options" {
+			continue
+		}
+		single := map[string]interface{}{operator: condMap[operator]}
+		if options, ok := condMap["$options"]; ok {
+			single["$options"] = options
+		}
+		match, version := qe.evaluateField(fieldPath, single, ctx)
+		if !match {
+			continue
+		}
+		matched, offset, size := qe.matchedText(fieldPath, operator, condMap[operator], ctx)
+		m := Match{
+			Field:    fieldPath,
+			Operator: operator,
+			Version:  version,
+			Offset:   offset,
+			Length:   len(matched),
+			Size:     size,
+		}
+		m.Matched = truncateRunes(matched, maxMatchedLength)
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// matchedText returns the part of the field a matching operator matched, its byte offset
+// and the size of the whole field
+func (qe *QueryEvaluator) matchedText(fieldPath, operator string, operand interface{}, ctx *DetectionContext) (string, int, int) {
+	text := qe.getFieldValue(fieldPath, ctx)
+	streamed := ctx.streamedBody(fieldPath)
+	size := len(text)
+	if streamed != nil {
+		size = int(streamed.size)
+	}
+	var pattern string
+	switch operator {
+	case "$regex":
+		pattern, _ = operand.(string)
+	case "$count":
+		// The first occurrence stands for the counted ones
+		spec, _ := operand.(map[string]interface{})
+		pattern, _ = spec["pattern"].(string)
+	default:
+		return text, 0, size
+	}
+
+	source := strings.Split(pattern, "\\;version:")[0]
+	re, err := qe.compile(source)
+	if err != nil {
+		return "", 0, size
+	}
+	if streamed != nil {
+		// Only the matches of the pattern were kept, the digest recorded where the first was
+		first := re.FindString(streamed.matches[source])
+		return first, int(streamed.first[source]), size
+	}
+	loc := re.FindStringIndex(text)
+	if loc == nil {
+		return "", 0, size
+	}
+	return text[loc[0]:loc[1]], loc[0], size
+}
+
+// truncateRunes cuts s to at most n bytes without splitting a UTF-8 character
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// matchSnippet returns about width characters of text around the match at offset, like
+// grep context: the match centered in the text before and after it, or the start of
+// the match when it is longer than width
+func matchSnippet(text string, offset, length, width int) string {
+	if width <= 0 || offset < 0 || length < 0 || offset+length > len(text) {
+		return ""
+	}
+	start, end := offset, offset+length
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	offset, length = start, end-start
+
+	context := (width - utf8.RuneCountInString(text[start:end])) / 2
+	if context <= 0 {
+		end = start
+		for i := 0; i < width && end < offset+length; i++ {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			end += size
+		}
+		return text[start:end]
+	}
+
+	for i := 0; i < context && start > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	for i := 0; i < context && end < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	return text[start:end]
+}
@@ -0,0 +1,71 @@
+package techdetect
+
+import "strings"
+
+// MaxExtraPaths caps how many Options.ExtraPaths are probed
+const MaxExtraPaths = 20
+
+// CommonExtraPaths are high-signal paths worth probing beyond the fingerprints' own, a
+// starting point for Options.ExtraPaths
+var CommonExtraPaths = []string{"/robots.txt", "/sitemap.xml", "/favicon.ico", "/.git/HEAD", "/wp-login.php"}
+
+// withExtraPaths evaluates the probes of the target page ("/") against the responses of
+// extra paths too, so markers a fingerprint looks for on the page are also found on,
+// e.g., a login page. A path already probed by a plain GET gets the page probes added to
+// its own; "/" itself and paths beyond MaxExtraPaths are ignored.
+func withExtraPaths(classifications []PathClassification, extraPaths []string) []PathClassification {
+	if len(extraPaths) == 0 {
+		return classifications
+	}
+
+	rootKey := requestCacheKey("/", nil)
+	var rootProbes map[string][]PathProbe
+	byKey := make(map[string]int, len(classifications))
+	for i, pc := range classifications {
+		key := requestCacheKey(pc.Path, pc.RequestConf)
+		byKey[key] = i
+		if key == rootKey {
+			rootProbes = pc.Technologies
+		}
+	}
+	if len(rootProbes) == 0 {
+		return classifications
+	}
+
+	added := 0
+	seen := make(map[string]bool)
+	for _, path := range extraPaths {
+		path = strings.TrimSpace(path)
+		if path == "" || path == "/" || seen[path] {
+			continue
+		}
+		if added == MaxExtraPaths {
+			break
+		}
+		seen[path] = true
+		added++
+
+		techs := make(map[string][]PathProbe, len(rootProbes))
+		key := requestCacheKey(path, nil)
+		i, exists := byKey[key]
+		if exists {
+			for techName, probes := range classifications[i].Technologies {
+				techs[techName] = append(techs[techName], probes...)
+			}
+		}
+		for techName, probes := range rootProbes {
+			for _, probe := range probes {
+				probe.Path = path
+				techs[techName] = append(techs[techName], probe)
+			}
+		}
+
+		if exists {
+			classifications[i].Technologies = techs
+		} else {
+			byKey[key] = len(classifications)
+			classifications = append(classifications, PathClassification{Path: path, Technologies: techs})
+		}
+	}
+	return classifications
+}
@@ -0,0 +1,61 @@
+package techdetect
+
+import (
+	"net/url"
+	"strings"
+)
+
+// GroupByHost nests scan results under their hostname, in order of first appearance,
+// merging the technologies detected on each of the host's endpoints
+func GroupByHost(results []ScanResult) []HostResults {
+	var hosts []HostResults
+	index := make(map[string]int)
+
+	for _, result := range results {
+		host := resultHost(result.URL)
+		i, exists := index[host]
+		if !exists {
+			i = len(hosts)
+			index[host] = i
+			hosts = append(hosts, HostResults{
+				Host:         host,
+				Technologies: make(map[string]string),
+			})
+		}
+		group := &hosts[i]
+		group.Endpoints = append(group.Endpoints, result)
+
+		for name, version := range result.Technologies {
+			tech := Technology{Name: name}
+			if merged, seen := group.Technologies[name]; seen {
+				tech.addVersion(merged)
+				for _, v := range group.Versions[name] {
+					tech.addVersion(v)
+				}
+			}
+			tech.addVersion(version)
+			for _, v := range result.Versions[name] {
+				tech.addVersion(v)
+			}
+
+			group.Technologies[name] = tech.Version
+			if len(tech.Versions) > 1 {
+				if group.Versions == nil {
+					group.Versions = make(map[string][]string)
+				}
+				group.Versions[name] = tech.Versions
+			}
+		}
+	}
+
+	return hosts
+}
+
+// resultHost extracts the lowercase hostname of a scanned URL, or the URL itself if it has none
+func resultHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return rawURL
+	}
+	return strings.ToLower(u.Hostname())
+}
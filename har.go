@@ -0,0 +1,349 @@
+package techdetect
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceArchive marks technologies detected from archived responses
+const SourceArchive = "archive"
+
+// ArchivedResponse is a recorded HTTP exchange used for offline detection
+type ArchivedResponse struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Headers    map[string]string
+	Cookies    map[string]string // from every Set-Cookie header, name -> first value
+	Links      []LinkHeader      // entries of every Link header
+	Body       string
+}
+
+// harFile mirrors the parts of the HAR 1.2 format needed for detection
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				Content struct {
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ParseHAR reads the recorded exchanges of a HAR archive
+func ParseHAR(r io.Reader) ([]ArchivedResponse, error) {
+	var har harFile
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("failed to parse HAR: %w", err)
+	}
+
+	responses := make([]ArchivedResponse, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		headers := make(map[string]string)
+		cookies := make(map[string]string)
+		links := []LinkHeader{}
+		for _, h := range entry.Response.Headers {
+			if strings.EqualFold(h.Name, "Set-Cookie") {
+				addCookie(cookies, h.Value)
+			}
+			if strings.EqualFold(h.Name, "Link") {
+				links = append(links, parseLinkHeader(h.Value)...)
+			}
+			// Keep first occurrence of each header, like live requests
+			name := http.CanonicalHeaderKey(h.Name)
+			if _, exists := headers[name]; !exists {
+				headers[name] = h.Value
+			}
+		}
+
+		body := entry.Response.Content.Text
+		if entry.Response.Content.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode body of %s: %w", entry.Request.URL, err)
+			}
+			body = string(decoded)
+		}
+
+		responses = append(responses, ArchivedResponse{
+			Method:     entry.Request.Method,
+			URL:        entry.Request.URL,
+			StatusCode: entry.Response.Status,
+			Headers:    headers,
+			Cookies:    cookies,
+			Links:      links,
+			Body:       body,
+		})
+	}
+
+	return responses, nil
+}
+
+// AnalyzeHAR runs offline detection on every site recorded in a HAR archive
+func (d *Detector) AnalyzeHAR(r io.Reader) ([]*Report, error) {
+	responses, err := ParseHAR(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.AnalyzeArchived(responses), nil
+}
+
+// AnalyzeArchived evaluates the fingerprints against recorded responses without any
+// network access, producing one report per archived origin
+func (d *Detector) AnalyzeArchived(responses []ArchivedResponse) []*Report {
+	archive := make(map[string]*ArchivedResponse)
+	var urls []string
+
+	for i := range responses {
+		resp := &responses[i]
+		u, err := url.Parse(resp.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		key := archiveKey(resp.Method, u)
+		if _, exists := archive[key]; !exists {
+			archive[key] = resp
+		}
+		urls = append(urls, resp.URL)
+	}
+
+	return d.analyzeOffline(urls, func(method, rawURL string) *DetectionContext {
+		return d.httpDetector.replay(method, rawURL, archive)
+	})
+}
+
+// analyzeOffline runs the HTTP stage for every origin of urls, taking responses from lookup
+func (d *Detector) analyzeOffline(urls []string, lookup func(method, rawURL string) *DetectionContext) []*Report {
+	var origins []string
+	seenOrigins := make(map[string]bool)
+	for _, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		origin := u.Scheme + "://" + u.Host
+		if !seenOrigins[origin] {
+			seenOrigins[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+	sort.Strings(origins)
+	return d.analyzeTargets(origins, lookup)
+}
+
+// analyzeTargets runs the HTTP stage for every target URL, taking responses from lookup
+func (d *Detector) analyzeTargets(targets []string, lookup func(method, rawURL string) *DetectionContext) []*Report {
+	reports := make([]*Report, 0, len(targets))
+	for _, target := range targets {
+		startedAt := time.Now()
+		run := d.runOffline(target, lookup)
+		reports = append(reports, d.buildReport(target, "offline", run, startedAt))
+	}
+	return reports
+}
+
+// runOffline replays the HTTP detection stage for one target URL against recorded responses
+func (d *Detector) runOffline(target string, lookup func(method, rawURL string) *DetectionContext) *detectRun {
+	hd := d.httpDetector
+	results := make(map[string]*Technology)
+	failedPaths := []string{}
+	finalURL := target
+	var matches map[string][]Match
+	if hd.explain {
+		matches = make(map[string][]Match)
+	}
+	var headers map[string]map[string]string
+	if hd.includeHeaders {
+		headers = make(map[string]map[string]string)
+	}
+
+	for _, classification := range d.offlineClassifications {
+		if !classification.hasRunnableProbe(results) {
+			continue
+		}
+
+		fullURL, ok := probeURL(target, classification.Path, hd.allowOffTarget)
+		if !ok {
+			failedPaths = append(failedPaths, classification.Path)
+			continue
+		}
+
+		dctx := lookup(classification.RequestConf.method(), fullURL)
+		if dctx == nil {
+			// Path was not recorded
+			failedPaths = append(failedPaths, classification.Path)
+			continue
+		}
+		if classification.Path == "/" && dctx.URL != "" {
+			finalURL = dctx.URL
+		}
+
+		if headers != nil {
+			if _, exists := headers[fullURL]; !exists {
+				headers[fullURL] = dctx.Headers
+			}
+		}
+
+		var scripts func() *DetectionContext
+		if classification.hasScriptProbe() {
+			scripts = sync.OnceValue(func() *DetectionContext {
+				return hd.scriptsContext(dctx, func(scriptURL string) *DetectionContext {
+					return lookup(http.MethodGet, scriptURL)
+				})
+			})
+		}
+
+		hd.applyPathProbes(classification, dctx, scripts, results, matches)
+	}
+
+	sources := make(map[string][]string)
+	for name := range results {
+		sources[name] = []string{SourceArchive}
+	}
+	results = d.addImpliedTechnologies(results)
+	d.attachTags(results)
+	hd.notifier.notifyNew(target, results, make(map[string]bool))
+	for name := range results {
+		if _, exists := sources[name]; !exists {
+			sources[name] = []string{SourceImplied}
+		}
+	}
+	d.hits.add(sources)
+
+	return &detectRun{
+		results:     results,
+		sources:     sources,
+		failedPaths: failedPaths,
+		finalURL:    finalURL,
+		matches:     matches,
+		headers:     headers,
+	}
+}
+
+// replay rebuilds the detection context for a request from archived responses,
+// following recorded same-domain redirects the way live requests do
+func (hd *HTTPDetector) replay(method, rawURL string, archive map[string]*ArchivedResponse) *DetectionContext {
+	currentURL := rawURL
+	allHeaders := make(map[string]string)
+	var allCookies map[string]string
+	var allLinks []LinkHeader
+	var allBodies []string
+	var finalBody, contentType string
+	var statusCode int
+	found := false
+
+	for redirectCount := 0; ; redirectCount++ {
+		u, err := url.Parse(currentURL)
+		if err != nil {
+			break
+		}
+		resp, ok := archive[archiveKey(method, u)]
+		if !ok {
+			break
+		}
+		found = true
+
+		for k, v := range resp.Headers {
+			if _, exists := allHeaders[k]; !exists {
+				allHeaders[k] = v
+			}
+		}
+		if resp.Cookies != nil {
+			if allCookies == nil {
+				allCookies = make(map[string]string)
+			}
+			for k, v := range resp.Cookies {
+				if _, exists := allCookies[k]; !exists {
+					allCookies[k] = v
+				}
+			}
+		}
+		if resp.Links != nil {
+			if allLinks == nil {
+				allLinks = []LinkHeader{}
+			}
+			allLinks = append(allLinks, resp.Links...)
+		}
+		statusCode = resp.StatusCode
+		contentType = normalizeContentType(resp.Headers["Content-Type"])
+		if hd.combineBodies {
+			if resp.Body != "" {
+				allBodies = append(allBodies, resp.Body)
+			}
+		} else {
+			finalBody = resp.Body
+		}
+
+		location := resp.Headers["Location"]
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" || redirectCount >= MaxRedirects {
+			break
+		}
+		redirectURL, err := resolveURL(currentURL, location)
+		if err != nil {
+			break
+		}
+		currentParsed, err := parseURL(currentURL)
+		if err != nil {
+			break
+		}
+		redirectParsed, err := parseURL(redirectURL)
+		if err != nil || !isSameDomain(currentParsed, redirectParsed) {
+			break
+		}
+		currentURL = redirectURL
+	}
+
+	if !found {
+		return nil
+	}
+	if hd.combineBodies {
+		finalBody = joinBodies(allBodies, hd.bodySeparator, hd.maxCombinedBody)
+	}
+
+	return &DetectionContext{
+		Body:        finalBody,
+		Headers:     allHeaders,
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		URL:         currentURL,
+		Cookies:     allCookies,
+		LinkHeaders: allLinks,
+	}
+}
+
+// archiveKey identifies a recorded exchange by method and URL, ignoring fragments
+// and treating an empty path as the root
+func archiveKey(method string, u *url.URL) string {
+	if method == "" {
+		method = http.MethodGet
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key := strings.ToUpper(method) + " " + u.Scheme + "://" + u.Host + path
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
@@ -0,0 +1,75 @@
+package techdetect
+
+import (
+	"sort"
+	"sync"
+)
+
+// HitStat counts how often a technology was detected by the scans of a detector
+type HitStat struct {
+	Technology string         `json:"technology"`
+	Detections int            `json:"detections"`        // scans that reported it
+	Sources    map[string]int `json:"sources,omitempty"` // stage (SourceHTTP, SourceBrowser, ...) -> detections
+}
+
+// hitCounter accumulates detections across scans, see Options.HitStats
+type hitCounter struct {
+	mu     sync.Mutex
+	counts map[string]*HitStat
+}
+
+// add counts the technologies of one scan, by the stages that found them
+func (c *hitCounter) add(sources map[string][]string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[string]*HitStat)
+	}
+	for name, stages := range sources {
+		stat, exists := c.counts[name]
+		if !exists {
+			stat = &HitStat{Technology: name, Sources: make(map[string]int)}
+			c.counts[name] = stat
+		}
+		stat.Detections++
+		for _, stage := range stages {
+			stat.Sources[stage]++
+		}
+	}
+}
+
+// HitStats returns how often each fingerprint was detected by the scans of the detector
+// so far, most detected first. Fingerprints that never matched are included with zero
+// detections, which makes the stats useful for pruning a database. It is nil without
+// Options.HitStats.
+func (d *Detector) HitStats() []HitStat {
+	if d.hits == nil {
+		return nil
+	}
+	d.hits.mu.Lock()
+	defer d.hits.mu.Unlock()
+
+	stats := make([]HitStat, 0, len(d.fingerprints))
+	for name := range d.fingerprints {
+		stat := HitStat{Technology: name}
+		if counted, ok := d.hits.counts[name]; ok {
+			stat.Detections = counted.Detections
+			stat.Sources = make(map[string]int, len(counted.Sources))
+			for stage, n := range counted.Sources {
+				stat.Sources[stage] = n
+			}
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Detections != stats[j].Detections {
+			return stats[i].Detections > stats[j].Detections
+		}
+		return stats[i].Technology < stats[j].Technology
+	})
+	return stats
+}
@@ -0,0 +1,43 @@
+package techdetect
+
+import (
+	"strings"
+	"sync"
+)
+
+// hostLimiter caps the number of concurrent requests per host using one semaphore per host
+type hostLimiter struct {
+	max  int
+	mu   sync.Mutex
+	sems map[string]chan struct{}
+}
+
+// newHostLimiter creates a limiter allowing max concurrent requests per host (nil if unlimited)
+func newHostLimiter(max int) *hostLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &hostLimiter{
+		max:  max,
+		sems: make(map[string]chan struct{}),
+	}
+}
+
+// acquire blocks until a slot for host is free and returns the matching release function
+func (hl *hostLimiter) acquire(host string) func() {
+	if hl == nil {
+		return func() {}
+	}
+
+	key := strings.ToLower(host)
+	hl.mu.Lock()
+	sem, exists := hl.sems[key]
+	if !exists {
+		sem = make(chan struct{}, hl.max)
+		hl.sems[key] = sem
+	}
+	hl.mu.Unlock()
+
+	sem <- struct{}{}
+	return func() { <-sem }
+}
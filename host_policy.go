@@ -0,0 +1,180 @@
+package techdetect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrHostDenied is returned for requests to hosts or addresses rejected by a HostPolicy
+var ErrHostDenied = errors.New("host denied by policy")
+
+// DefaultDeniedRanges are the address ranges a HostPolicy rejects unless allowed:
+// loopback, private, link-local (including cloud metadata endpoints such as
+// 169.254.169.254), shared, multicast and reserved addresses
+var DefaultDeniedRanges = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+// HostPolicy restricts the hosts scans may contact, guarding services that scan
+// user-supplied URLs against SSRF. Hosts are resolved and every address checked: an
+// address in an allowed range passes, one in a denied range or DefaultDeniedRanges is
+// rejected, anything else passes. A nil policy allows everything.
+type HostPolicy struct {
+	allowHosts    []string
+	denyHosts     []string
+	allowPrefixes []netip.Prefix
+	denyPrefixes  []netip.Prefix
+}
+
+// NewHostPolicy builds a policy from allow and deny entries, each a CIDR range
+// ("10.1.0.0/16"), an address, or a hostname ("*.example.com" matches subdomains).
+// Allowed hostnames are not resolved or checked; allow entries take precedence over deny.
+func NewHostPolicy(allow, deny []string) (*HostPolicy, error) {
+	p := &HostPolicy{}
+	for _, entry := range allow {
+		if err := p.add(entry, &p.allowHosts, &p.allowPrefixes); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range append(append([]string(nil), DefaultDeniedRanges...), deny...) {
+		if err := p.add(entry, &p.denyHosts, &p.denyPrefixes); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// add parses one policy entry into the host or range list
+func (p *HostPolicy) add(entry string, hosts *[]string, prefixes *[]netip.Prefix) error {
+	entry = strings.TrimSpace(entry)
+	switch {
+	case entry == "":
+		return nil
+	case strings.Contains(entry, "/"):
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return fmt.Errorf("invalid host policy range %q: %w", entry, err)
+		}
+		*prefixes = append(*prefixes, prefix.Masked())
+	default:
+		if addr, err := netip.ParseAddr(strings.Trim(entry, "[]")); err == nil {
+			*prefixes = append(*prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else {
+			*hosts = append(*hosts, entry)
+		}
+	}
+	return nil
+}
+
+// AllowedAddr checks an address against the policy
+func (p *HostPolicy) AllowedAddr(addr netip.Addr) bool {
+	if p == nil {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.allowPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	for _, prefix := range p.denyPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL resolves the host of a URL and checks it against the policy, returning an
+// error wrapping ErrHostDenied when it is rejected
+func (p *HostPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	if p == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	_, err = p.resolve(ctx, u.Hostname())
+	return err
+}
+
+// resolve checks a host and returns the addresses to connect to, or nil for a host
+// allowed by name, which is left to the regular resolver
+func (p *HostPolicy) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	if matchesHostList(host, p.allowHosts) {
+		return nil, nil
+	}
+	if matchesHostList(host, p.denyHosts) {
+		return nil, fmt.Errorf("%w: %s", ErrHostDenied, host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !p.AllowedAddr(addr) {
+			return nil, fmt.Errorf("%w: %s", ErrHostDenied, host)
+		}
+		return []netip.Addr{addr}, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if !p.AllowedAddr(addr) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrHostDenied, host, addr.Unmap())
+		}
+	}
+	return addrs, nil
+}
+
+// dialContext dials only checked addresses, so a host can't resolve to a public address
+// for the check and a denied one for the connection
+func (p *HostPolicy) dialContext() func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := p.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if addrs == nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		var lastErr error
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
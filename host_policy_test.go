@@ -0,0 +1,66 @@
+package techdetect
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRedirectToMetadataBlocked(t *testing.T) {
+	var metadataHits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "public.test" {
+			metadataHits.Add(1)
+			w.Write([]byte(`{"Code": "Success", "AccessKeyId": "ASIA..."}`))
+			return
+		}
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/iam/security-credentials/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	policy, err := NewHostPolicy([]string{"public.test"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newTestEngine(t, srv, `{
+		"Metadata": {"paths": [{"path": "/", "detect": {"body": {"$regex": "AccessKeyId"}}}]}
+	}`, Options{HostPolicy: policy})
+
+	result, err := d.DetectHTTPOnly("http://public.test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasTech(result.Technologies, "Metadata") || metadataHits.Load() != 0 {
+		t.Errorf("redirect to the metadata endpoint followed: %d requests, technologies %+v", metadataHits.Load(), result.Technologies)
+	}
+
+	// Scanning it directly is refused before any request
+	if _, err := d.DetectHTTPOnly("http://169.254.169.254/"); !errors.Is(err, ErrHostDenied) {
+		t.Errorf("direct scan: error %v, want ErrHostDenied", err)
+	}
+	if metadataHits.Load() != 0 {
+		t.Errorf("metadata endpoint contacted %d times", metadataHits.Load())
+	}
+}
+
+func TestHostPolicyDenialIsFinal(t *testing.T) {
+	policy, err := NewHostPolicy(nil, []string{"169.254.169.254/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hd := NewHTTPDetectorWithConfig(Options{HostPolicy: policy})
+
+	// Denied requests fail at once, without the retry backoff
+	for _, target := range []string{"http://169.254.169.254/", "http://169.254.169.254:8080/latest/"} {
+		started := time.Now()
+		if _, err := hd.requestWithRetry(t.Context(), target, target, nil, nil); !errors.Is(err, ErrHostDenied) {
+			t.Errorf("%s: error %v, want ErrHostDenied", target, err)
+		}
+		if elapsed := time.Since(started); elapsed >= InitialBackoff {
+			t.Errorf("%s: denied after %s, retried", target, elapsed)
+		}
+	}
+}
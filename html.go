@@ -0,0 +1,244 @@
+package techdetect
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// resourceAttributes lists the attributes referencing links and resources, per element
+var resourceAttributes = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"link":   "href",
+	"script": "src",
+	"img":    "src",
+	"iframe": "src",
+	"source": "src",
+	"form":   "action",
+}
+
+// parsedHTML parses the body as HTML once; ok is false for non-HTML responses
+func (ctx *DetectionContext) parsedHTML() (*html.Node, bool) {
+	ctx.htmlOnce.Do(func() {
+		if ctx.ContentType != "" && ctx.ContentType != "text/html" && ctx.ContentType != "application/xhtml+xml" {
+			return
+		}
+		doc, err := html.Parse(strings.NewReader(ctx.Body))
+		if err == nil {
+			ctx.htmlDoc = doc
+		}
+	})
+	return ctx.htmlDoc, ctx.htmlDoc != nil
+}
+
+// Link is a <link> element of an HTML page
+type Link struct {
+	Rel  string `json:"rel"` // lowercased, may hold several space-separated types
+	Href string `json:"href"`
+}
+
+// Links returns the <link> elements of an HTML body, in document order. It is empty for
+// non-HTML responses.
+func (ctx *DetectionContext) Links() []Link {
+	ctx.linksOnce.Do(func() {
+		doc, ok := ctx.parsedHTML()
+		if !ok {
+			return
+		}
+
+		var walk func(n *html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.Data == "link" {
+				var link Link
+				for _, attr := range n.Attr {
+					switch attr.Key {
+					case "rel":
+						link.Rel = strings.ToLower(strings.Join(strings.Fields(attr.Val), " "))
+					case "href":
+						link.Href = strings.TrimSpace(attr.Val)
+					}
+				}
+				ctx.links = append(ctx.links, link)
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+	})
+	return ctx.links
+}
+
+// linkField resolves the link fields: "link" is the array of {rel, href} objects,
+// "link.rel" every link type (rel="shortcut icon" counts as two) and "link.href" every
+// href, each without duplicates
+func (ctx *DetectionContext) linkField(attribute string) (interface{}, bool) {
+	links := ctx.Links()
+	if len(links) == 0 {
+		return nil, false
+	}
+
+	var values []interface{}
+	seen := make(map[string]bool)
+	add := func(value string) {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+
+	switch attribute {
+	case "":
+		for _, link := range links {
+			values = append(values, map[string]interface{}{"rel": link.Rel, "href": link.Href})
+		}
+	case "rel":
+		for _, link := range links {
+			for _, rel := range strings.Fields(link.Rel) {
+				add(rel)
+			}
+		}
+	case "href":
+		for _, link := range links {
+			add(link.Href)
+		}
+	default:
+		return nil, false
+	}
+
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values, true
+}
+
+// resourceExtensions returns the distinct file extensions (".php") of the site's own
+// links and resources referenced by the HTML body, sorted
+func (ctx *DetectionContext) resourceExtensions() []interface{} {
+	doc, ok := ctx.parsedHTML()
+	if !ok {
+		return nil
+	}
+
+	var pageHost string
+	if u, err := url.Parse(ctx.URL); err == nil {
+		pageHost = u.Hostname()
+	}
+
+	seen := make(map[string]bool)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if attrName, ok := resourceAttributes[n.Data]; ok {
+				for _, attr := range n.Attr {
+					if attr.Key == attrName {
+						if ext := linkExtension(attr.Val, pageHost); ext != "" {
+							seen[ext] = true
+						}
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	exts := make([]string, 0, len(seen))
+	for ext := range seen {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+
+	values := make([]interface{}, len(exts))
+	for i, ext := range exts {
+		values[i] = ext
+	}
+	return values
+}
+
+// linkExtension extracts the lowercase file extension of a link, ignoring links to other
+// sites (pageHost's subdomains count as the same site) and non-HTTP schemes
+func linkExtension(link, pageHost string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	if u.Host != "" && pageHost != "" && !isOnTarget(u.Hostname(), pageHost) {
+		return ""
+	}
+
+	ext := strings.ToLower(path.Ext(u.Path))
+	if len(ext) < 2 || len(ext) > 6 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// DetectFromHTML evaluates the fingerprints against a page the caller already fetched and
+// parsed, without any network access. Probes for "/" and for the page's own path are
+// evaluated. The document is used as-is for HTML-derived fields and rendered once for
+// body patterns, but never re-parsed. Script probes are skipped.
+func (d *Detector) DetectFromHTML(pageURL string, doc *html.Node, headers map[string]string) (*DetectResult, error) {
+	page, err := url.Parse(pageURL)
+	if err != nil || page.Host == "" {
+		return nil, fmt.Errorf("invalid page URL %q", pageURL)
+	}
+
+	var body strings.Builder
+	if err := html.Render(&body, doc); err != nil {
+		return nil, fmt.Errorf("failed to render document: %w", err)
+	}
+
+	dctx := NewDetectionContext(body.String(), headers)
+	dctx.URL = pageURL
+	if dctx.ContentType == "" {
+		dctx.ContentType = "text/html"
+	}
+	dctx.htmlOnce.Do(func() {
+		dctx.htmlDoc = doc
+	})
+
+	origin := page.Scheme + "://" + page.Host
+	pageKey := archiveKey(http.MethodGet, page)
+	results := make(map[string]*Technology)
+
+	for _, classification := range d.offlineClassifications {
+		if classification.RequestConf.method() != http.MethodGet || !classification.hasRunnableProbe(results) {
+			continue
+		}
+		if classification.Path != "/" {
+			probe, ok := probeURL(origin, classification.Path, d.httpDetector.allowOffTarget)
+			if !ok {
+				continue
+			}
+			if u, err := url.Parse(probe); err != nil || archiveKey(http.MethodGet, u) != pageKey {
+				continue
+			}
+		}
+		d.httpDetector.applyPathProbes(classification, dctx, nil, results, nil)
+	}
+
+	results = d.addImpliedTechnologies(results)
+	d.attachTags(results)
+	techs := make([]Technology, 0, len(results))
+	for _, tech := range results {
+		techs = append(techs, *tech)
+	}
+	return &DetectResult{Technologies: techs}, nil
+}
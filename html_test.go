@@ -0,0 +1,69 @@
+package techdetect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// wordPressHead is the REST API discovery a WordPress page advertises, and nothing else
+const wordPressHead = `<!DOCTYPE html><html><head>
+<link rel="https://api.w.org/" href="https://example.com/wp-json/" />
+<link rel="alternate" type="application/json" href="https://example.com/wp-json/wp/v2/pages/2" />
+<link rel="Shortcut Icon" href="/favicon.ico">
+</head><body></body></html>`
+
+func TestEvaluateLinkFields(t *testing.T) {
+	ctx := NewDetectionContext(wordPressHead, map[string]string{"Content-Type": "text/html"})
+
+	tests := []struct {
+		name  string
+		query string
+		match bool
+	}{
+		{"rel $in", `{"link.rel": {"$in": ["https://api.w.org/"]}}`, true},
+		{"rel of several types", `{"link.rel": {"$all": ["shortcut", "icon"]}}`, true},
+		{"rel is lowercased", `{"link.rel": {"$in": ["Shortcut"]}}`, false},
+		{"missing rel", `{"link.rel": {"$in": ["manifest"]}}`, false},
+		{"rel $nin", `{"link.rel": {"$nin": ["manifest", "pingback"]}}`, true},
+		{"href pattern", `{"link.href": {"$elemMatch": {"$regex": "/wp-json/$"}}}`, true},
+		{"href of another link", `{"link.href": {"$in": ["https://example.com/wp-json/wp/v2/pages/2"]}}`, true},
+		{"missing href", `{"link.href": {"$elemMatch": {"$regex": "/xmlrpc\\.php"}}}`, false},
+		{"rel and href on one link", `{"link": {"$elemMatch": {"rel": {"$eq": "https://api.w.org/"}, "href": {"$regex": "/wp-json/$"}}}}`, true},
+		{"rel and href on different links", `{"link": {"$elemMatch": {"rel": {"$eq": "alternate"}, "href": {"$regex": "/wp-json/$"}}}}`, false},
+	}
+
+	qe := NewQueryEvaluator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if match, _ := qe.Evaluate(parseQuery(t, tt.query), ctx); match != tt.match {
+				t.Errorf("Evaluate(%s) = %v, want %v", tt.query, match, tt.match)
+			}
+		})
+	}
+
+	if match, _ := qe.Evaluate(parseQuery(t, `{"link.rel": {"$exists": true}}`), NewDetectionContext("<html></html>", nil)); match {
+		t.Error("link.rel exists on a page without links")
+	}
+}
+
+func TestDetectWordPressRESTLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.Write([]byte(wordPressHead))
+	}))
+	defer srv.Close()
+
+	all, err := NewLoader("").LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ := newTestDetector(t, srv, Options{}).DetectHTTP("http://blog.test/", map[string]Fingerprint{"WordPress": all["WordPress"]})
+	if _, ok := results["WordPress"]; !ok {
+		t.Errorf("WordPress not detected from its REST API link, results %v", results)
+	}
+}
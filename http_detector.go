@@ -1,14 +1,21 @@
 package techdetect
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/proxy"
@@ -19,12 +26,50 @@ const (
 	RequestTimeout = 10 * time.Second
 	MaxRedirects   = 3
 	InitialBackoff = 1 * time.Second
+	MaxBackoff     = 30 * time.Second // cap of the doubling backoff between retries
+
+	DefaultRedirectBodySeparator = "\n"
+	DefaultMaxCombinedBodySize   = 5 * 1024 * 1024
 )
 
 // HTTPDetector performs HTTP-based detection
 type HTTPDetector struct {
 	client    *http.Client
 	evaluator *QueryEvaluator
+	limiter   *hostLimiter
+
+	// Redirect body handling
+	combineBodies   bool
+	bodySeparator   string
+	maxCombinedBody int
+
+	maxScripts      int           // scripts fetched for a page's script probes
+	bodyIdleTimeout time.Duration // longest stall while reading a body, 0 for no limit
+	streamBody      bool          // keep only the regex matches of bodies, see Options.StreamBody
+
+	allowOffTarget bool
+	cache          *RequestCache // shared response cache, nil when disabled
+	cacheScope     string        // settings in the cache keys, see requestCacheScope
+	recorderMu     sync.Mutex    // guards recorder, swapped by RecordTo while scans may run
+	recorder       *recorder     // captures fetched responses, nil unless recording
+	firstMatchOnly bool          // stop at the first matching probe of a tech on each path
+	explain        bool          // record the conditions behind each detection
+	snippetLength  int           // characters of context kept around explained matches
+	includeHeaders bool          // keep the response headers of every fetched path
+	allowSensitive bool          // run probes marked sensitive
+	readOnly       bool          // only send GET and HEAD requests, see Options.ReadOnly
+	fallbackClient *http.Client  // non-verifying client for TLSFallback, nil when disabled
+
+	hostPolicy *HostPolicy // hosts requests may go to, nil when unrestricted
+	notifier   *notifier   // reports detections as they happen, nil without Options.OnDetect
+
+	cookies       map[string]string // sent to the hosts they are scoped to, see Options.Cookies
+	cookieDomains []string          // scope of cookies, the scanned target when empty
+	cookieJar     http.CookieJar    // shared across requests and scans, nil without Options.CookieJar
+
+	includeTransaction bool // keep every request and response of a scan
+
+	extraPaths []string // also evaluated against the probes of "/", see Options.ExtraPaths
 }
 
 // NewHTTPDetector creates a new HTTP detector
@@ -34,11 +79,132 @@ func NewHTTPDetector() *HTTPDetector {
 
 // NewHTTPDetectorWithOptions creates a new HTTP detector with custom options
 func NewHTTPDetectorWithOptions(insecureSkipVerify bool, proxyURL string) *HTTPDetector {
+	return NewHTTPDetectorWithConfig(Options{
+		InsecureSkipVerify: insecureSkipVerify,
+		ProxyURL:           proxyURL,
+	})
+}
+
+// NewHTTPDetectorWithClient creates a new HTTP detector that sends requests through client.
+// See Options.HTTPClient for how the client is used.
+func NewHTTPDetectorWithClient(client *http.Client) *HTTPDetector {
+	return NewHTTPDetectorWithConfig(Options{HTTPClient: client})
+}
+
+// NewHTTPDetectorWithConfig creates a new HTTP detector from an Options struct
+func NewHTTPDetectorWithConfig(opts Options) *HTTPDetector {
+	bodySeparator := opts.RedirectBodySeparator
+	if bodySeparator == "" {
+		bodySeparator = DefaultRedirectBodySeparator
+	}
+	maxCombinedBody := opts.MaxCombinedBodySize
+	if maxCombinedBody <= 0 {
+		maxCombinedBody = DefaultMaxCombinedBodySize
+	}
+	maxScripts := opts.MaxScripts
+	if maxScripts <= 0 {
+		maxScripts = DefaultMaxScripts
+	}
+
+	var fallbackClient *http.Client
+	if opts.TLSFallback && !opts.InsecureSkipVerify && opts.HTTPClient == nil {
+		insecureOpts := opts
+		insecureOpts.InsecureSkipVerify = true
+		fallbackClient = newHTTPClient(insecureOpts)
+	}
+
+	return &HTTPDetector{
+		client:    newHTTPClient(opts),
+		evaluator: NewQueryEvaluator(),
+		limiter:   newHostLimiter(opts.MaxPerHost),
+
+		combineBodies:   opts.CombineRedirectBodies,
+		bodySeparator:   bodySeparator,
+		maxCombinedBody: maxCombinedBody,
+
+		maxScripts:      maxScripts,
+		bodyIdleTimeout: opts.BodyIdleTimeout,
+		streamBody:      opts.StreamBody,
+
+		allowOffTarget: opts.AllowOffTargetTemplates,
+		cache:          opts.RequestCache,
+		cacheScope:     requestCacheScope(opts),
+		firstMatchOnly: opts.FirstMatchOnly,
+		explain:        opts.Explain,
+		snippetLength:  opts.SnippetLength,
+		includeHeaders: opts.IncludeHeaders,
+		allowSensitive: opts.AllowSensitive,
+		readOnly:       opts.ReadOnly,
+		fallbackClient: fallbackClient,
+
+		hostPolicy: opts.HostPolicy,
+		notifier:   newNotifier(opts.OnDetect),
+
+		cookies:       opts.Cookies,
+		cookieDomains: opts.CookieDomains,
+		cookieJar:     opts.CookieJar,
+
+		includeTransaction: opts.IncludeTransaction,
+
+		extraPaths: opts.ExtraPaths,
+	}
+}
+
+// newHTTPClient builds the HTTP client for the options, or adapts the injected one
+func newHTTPClient(opts Options) *http.Client {
+	// Disable automatic redirects - we'll handle them manually
+	noRedirects := func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	if opts.HTTPClient != nil {
+		// Copy so the caller's client keeps its own redirect policy
+		client := *opts.HTTPClient
+		client.CheckRedirect = noRedirects
+		return &client
+	}
+
+	// Apply the TLS policy to the transport of each proxy
+	transportFor := func(proxyURL string) http.RoundTripper {
+		var transport http.RoundTripper = newTransport(proxyURL, opts.InsecureSkipVerify, opts.ResponseHeaderTimeout, opts.HostPolicy)
+		if !opts.InsecureSkipVerify && len(opts.InsecureHosts) > 0 {
+			// Route listed hosts through a second, non-verifying transport
+			transport = &hostTLSTransport{
+				secure:   transport,
+				insecure: newTransport(proxyURL, true, opts.ResponseHeaderTimeout, opts.HostPolicy),
+				hosts:    append([]string(nil), opts.InsecureHosts...),
+			}
+		}
+		return transport
+	}
+
+	var transport http.RoundTripper
+	if len(opts.ProxyURLs) > 0 {
+		transport = newProxyRotator(opts.ProxyURLs, opts.ProxyRotation, transportFor)
+	} else {
+		transport = transportFor(opts.ProxyURL)
+	}
+
+	// No client-wide timeout, each request gets a deadline from its probe (RequestTimeout by default)
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: noRedirects,
+	}
+}
+
+// newTransport creates an HTTP transport with the given proxy and TLS verification settings.
+// Without a proxy, connections are only made to addresses the host policy allows.
+func newTransport(proxyURL string, insecureSkipVerify bool, responseHeaderTimeout time.Duration, hostPolicy *HostPolicy) *http.Transport {
 	// Create custom transport
 	transport := &http.Transport{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: insecureSkipVerify,
 		},
+		ResponseHeaderTimeout: responseHeaderTimeout,
+	}
+	if hostPolicy != nil && proxyURL == "" {
+		// Behind a proxy only the proxy is dialed; targets are checked per request
+		transport.DialContext = hostPolicy.dialContext()
 	}
 
 	// Configure proxy if provided
@@ -72,17 +238,7 @@ func NewHTTPDetectorWithOptions(insecureSkipVerify bool, proxyURL string) *HTTPD
 		}
 	}
 
-	return &HTTPDetector{
-		client: &http.Client{
-			Timeout:   RequestTimeout,
-			Transport: transport,
-			// Disable automatic redirects - we'll handle them manually
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		},
-		evaluator: NewQueryEvaluator(),
-	}
+	return transport
 }
 
 // PathClassification groups fingerprints by path
@@ -90,6 +246,9 @@ type PathClassification struct {
 	Path         string
 	RequestConf  *RequestConfig
 	Technologies map[string][]PathProbe // tech name -> probes
+
+	digest *bodyDigest // streamed body reading, nil to read the full body
+	order  []string    // tech names in evaluation order, see OrderByRequirements
 }
 
 // ClassifyByPath groups all fingerprints by their request paths
@@ -98,7 +257,12 @@ func ClassifyByPath(fingerprints map[string]Fingerprint) []PathClassification {
 
 	for techName, fp := range fingerprints {
 		for _, probe := range fp.Paths {
-			key := probe.Path
+			if probe.Path == "" {
+				// A probe without a path checks the target page
+				probe.Path = "/"
+			}
+			// Probes only share a request if they send the same one
+			key := requestCacheKey(probe.Path, probe.Request)
 			if _, exists := pathMap[key]; !exists {
 				pathMap[key] = &PathClassification{
 					Path:         probe.Path,
@@ -110,35 +274,133 @@ func ClassifyByPath(fingerprints map[string]Fingerprint) []PathClassification {
 		}
 	}
 
-	// Convert map to slice
+	// Convert map to slice, sorted so paths are probed in the same order on every run
+	keys := make([]string, 0, len(pathMap))
+	for key := range pathMap {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := pathMap[keys[i]].Path, pathMap[keys[j]].Path
+		if pi != pj {
+			return pi < pj
+		}
+		// Same path with different requests
+		return keys[i] < keys[j]
+	})
+
 	result := make([]PathClassification, 0, len(pathMap))
-	for _, pc := range pathMap {
-		result = append(result, *pc)
+	for _, key := range keys {
+		result = append(result, *pathMap[key])
 	}
 
 	return result
 }
 
+// withoutSensitive drops the probes marked sensitive, and the paths left without probes
+func withoutSensitive(classifications []PathClassification) []PathClassification {
+	kept := classifications[:0]
+	for _, pc := range classifications {
+		techs := make(map[string][]PathProbe, len(pc.Technologies))
+		for techName, probes := range pc.Technologies {
+			for _, probe := range probes {
+				if !probe.Sensitive {
+					techs[techName] = append(techs[techName], probe)
+				}
+			}
+		}
+		if len(techs) > 0 {
+			pc.Technologies = techs
+			kept = append(kept, pc)
+		}
+	}
+	return kept
+}
+
 // DetectHTTP performs HTTP-based detection on a target URL
 func (hd *HTTPDetector) DetectHTTP(baseURL string, fingerprints map[string]Fingerprint) (map[string]*Technology, []string) {
+	return hd.DetectHTTPContext(context.Background(), baseURL, fingerprints)
+}
+
+// DetectHTTPContext performs HTTP-based detection, aborting outstanding requests when ctx is done
+func (hd *HTTPDetector) DetectHTTPContext(ctx context.Context, baseURL string, fingerprints map[string]Fingerprint) (map[string]*Technology, []string) {
+	scan := hd.scan(ctx, baseURL, hd.classify(fingerprints))
+	return scan.results, scan.failedPaths
+}
+
+// httpScan holds the outcome of an HTTP detection run
+type httpScan struct {
+	results     map[string]*Technology
+	failedPaths []string
+	finalURL    string                       // where the root path ended up after redirects
+	matches     map[string][]Match           // tech name -> conditions that fired, nil unless explaining
+	headers     map[string]map[string]string // probe URL -> response headers, nil unless included
+	tlsInvalid  bool                         // some response was only fetched after certificate verification failed
+	transaction []HTTPHop                    // every request and response, nil unless included
+}
+
+// classify groups fingerprints into the paths a scan probes, prerequisites first and
+// without sensitive probes unless they are allowed
+func (hd *HTTPDetector) classify(fingerprints map[string]Fingerprint) []PathClassification {
+	pathClassifications := ClassifyByPath(fingerprints)
+	if !hd.allowSensitive {
+		pathClassifications = withoutSensitive(pathClassifications)
+	}
+	if hd.readOnly {
+		pathClassifications = withoutWrites(pathClassifications)
+	}
+	pathClassifications = withExtraPaths(pathClassifications, hd.extraPaths)
+	if hd.streamBody {
+		for i := range pathClassifications {
+			pathClassifications[i].digest = hd.newBodyDigest(&pathClassifications[i])
+		}
+	}
+	return OrderByRequirements(pathClassifications)
+}
+
+// scan probes every classified path and evaluates the fingerprints against the responses.
+// The classifications are only read, so one slice can be shared by concurrent scans.
+func (hd *HTTPDetector) scan(ctx context.Context, baseURL string, pathClassifications []PathClassification) *httpScan {
 	results := make(map[string]*Technology)
 	failedPaths := []string{}
+	finalURL := baseURL
+	var matches map[string][]Match
+	if hd.explain {
+		matches = make(map[string][]Match)
+	}
+	var headers map[string]map[string]string
+	if hd.includeHeaders {
+		headers = make(map[string]map[string]string)
+	}
+	tlsInvalid := false
+	notified := make(map[string]bool)
+	var transaction []HTTPHop
 
-	// Classify fingerprints by path
-	pathClassifications := ClassifyByPath(fingerprints)
+	base, _ := url.Parse(baseURL)
 
 	// Process each unique path
 	for _, classification := range pathClassifications {
-		fullURL := strings.TrimSuffix(baseURL, "/") + classification.Path
+		// Skip paths whose probes all wait on technologies that weren't detected
+		if !classification.hasRunnableProbe(results) {
+			continue
+		}
+
+		fullURL, ok := probeURL(baseURL, classification.Path, hd.allowOffTarget)
+		if !ok {
+			// Templated path resolved off-target (or base URL is unusable); report it rather
+			// than dropping the probe silently
+			failedPaths = append(failedPaths, classification.Path)
+			continue
+		}
 
 		// Make HTTP request with retry logic
-		ctx, err := hd.requestWithRetry(fullURL, classification.RequestConf)
+		dctx, err := hd.requestWithRetry(ctx, baseURL, fullURL, classification.RequestConf.withBodyTemplate(base), classification.digest)
 		if err != nil {
 			failedPaths = append(failedPaths, classification.Path)
 
 			// Check for fatal network errors that mean we should stop trying other paths
 			errStr := err.Error()
-			if strings.Contains(errStr, "no such host") ||
+			if ctx.Err() != nil ||
+				strings.Contains(errStr, "no such host") ||
 				strings.Contains(errStr, "network is unreachable") {
 				// Mark all remaining paths as failed and break
 				for _, remainingClass := range pathClassifications {
@@ -158,75 +420,232 @@ func (hd *HTTPDetector) DetectHTTP(baseURL string, fingerprints map[string]Finge
 			continue
 		}
 
-		// Check all technologies for this path
-		for techName, probes := range classification.Technologies {
-			for _, probe := range probes {
-				detected, version := hd.evaluator.Evaluate(probe.Detect, ctx)
-				if detected {
-					// Try to extract version if not already found
-					if version == "" && len(probe.ExtractVersion) > 0 {
-						version = hd.evaluator.ExtractVersion(probe.ExtractVersion, ctx)
+		if dctx.TLSInvalid {
+			tlsInvalid = true
+		}
+		rec := hd.activeRecorder()
+		rec.record(baseURL, classification.RequestConf.method(), fullURL, dctx)
+		if classification.Path == "/" && dctx.URL != "" {
+			finalURL = dctx.URL
+		}
+		if headers != nil {
+			if _, exists := headers[fullURL]; !exists {
+				headers[fullURL] = dctx.Headers
+			}
+		}
+		for _, hop := range dctx.Hops {
+			hop.Probe = classification.Path
+			transaction = append(transaction, hop)
+		}
+
+		var scripts func() *DetectionContext
+		if classification.hasScriptProbe() {
+			scripts = sync.OnceValue(func() *DetectionContext {
+				return hd.scriptsContext(dctx, func(scriptURL string) *DetectionContext {
+					script, err := hd.requestWithRetry(ctx, baseURL, scriptURL, nil, nil)
+					if err != nil {
+						return nil
 					}
+					rec.record(baseURL, http.MethodGet, scriptURL, script)
+					return script
+				})
+			})
+		}
 
-					results[techName] = &Technology{
-						Name:    techName,
-						Version: version,
+		hd.applyPathProbes(classification, dctx, scripts, results, matches)
+		hd.notifier.notifyNew(baseURL, results, notified)
+	}
+
+	return &httpScan{
+		results:     results,
+		matches:     matches,
+		headers:     headers,
+		failedPaths: failedPaths,
+		finalURL:    finalURL,
+		tlsInvalid:  tlsInvalid,
+		transaction: transaction,
+	}
+}
+
+// applyPathProbes evaluates every probe of a path classification against a response,
+// and script probes against the page's combined scripts (skipped when scripts is nil or
+// returns nil), merging detections and versions into results and, when matches is not
+// nil, the conditions that fired into matches. scripts is only called once a script
+// probe's required technologies were detected, so it may fetch them lazily.
+func (hd *HTTPDetector) applyPathProbes(classification PathClassification, page *DetectionContext, scripts func() *DetectionContext, results map[string]*Technology, matches map[string][]Match) {
+	qe := hd.evaluator
+	for _, techName := range classification.evaluationOrder() {
+		for _, probe := range classification.Technologies[techName] {
+			// Skip probes whose required technologies weren't detected
+			if !probe.requirementsMet(results) {
+				continue
+			}
+
+			dctx := page
+			if probe.Scripts {
+				if scripts == nil {
+					continue
+				}
+				if dctx = scripts(); dctx == nil {
+					continue
+				}
+			}
+
+			// Skip probes that don't apply to this response's content type
+			if !probe.AppliesToContentType(dctx.ContentType) {
+				continue
+			}
+
+			detected, version := qe.Evaluate(probe.Detect, dctx)
+			if detected {
+				// Merge with detections from other probes and paths, keeping every distinct version
+				tech, exists := results[techName]
+				if !exists {
+					tech = &Technology{Name: techName}
+					results[techName] = tech
+				}
+				// Every version the probe found, the most specific first; a version that is a
+				// less specific form of another one ("6" next to "6.4.1") is dropped
+				var versions []string
+				if probe.VersionFrom == VersionFromLongest || probe.VersionFrom == VersionFromJoin {
+					// The combined extraction is more specific than the detect capture
+					versions = append(versions, qe.ExtractVersionFrom(probe.ExtractVersion, probe.VersionFrom, dctx))
+				}
+				versions = append(versions, version)
+				versions = append(versions, qe.collectQueryVersions(probe.Detect, dctx)...)
+				if len(probe.ExtractVersion) > 0 && probe.VersionFrom != VersionFromJoin {
+					versions = append(versions, qe.ExtractVersions(probe.ExtractVersion, dctx)...)
+				}
+				for name, value := range qe.ExtractFields(probe.Extract, dctx) {
+					if name == "version" {
+						versions = append(versions, value)
+					} else {
+						tech.addMetadata(name, value)
 					}
+				}
+				for _, v := range dropPrefixVersions(versions) {
+					tech.addVersion(v)
+				}
+				if matches != nil {
+					for _, m := range qe.ExplainQuery(probe.Detect, dctx) {
+						m.Path = classification.Path
+						// A streamed body kept no text around its matches
+						if hd.snippetLength > 0 && dctx.streamedBody(m.Field) == nil {
+							m.Snippet = matchSnippet(qe.getFieldValue(m.Field, dctx), m.Offset, m.Length, hd.snippetLength)
+						}
+						matches[techName] = append(matches[techName], m)
+					}
+				}
+				if hd.firstMatchOnly {
 					break // Found, no need to check other probes for this tech
 				}
 			}
 		}
 	}
+}
 
-	return results, failedPaths
+// requestWithRetry makes an HTTP request for a scan of target with retry logic
+func (hd *HTTPDetector) requestWithRetry(ctx context.Context, target, url string, reqConfig *RequestConfig, digest *bodyDigest) (*DetectionContext, error) {
+	if hd.cache != nil {
+		// A cached response may come from a detector with another policy, or none
+		if err := hd.hostPolicy.CheckURL(ctx, url); err != nil {
+			return nil, err
+		}
+		return hd.cache.fetch(ctx, hd.cacheKey(target, url, reqConfig, digest), func() (*DetectionContext, error) {
+			return hd.fetchWithRetry(ctx, target, url, reqConfig, digest)
+		})
+	}
+	return hd.fetchWithRetry(ctx, target, url, reqConfig, digest)
 }
 
-// requestWithRetry makes an HTTP request with retry logic
-func (hd *HTTPDetector) requestWithRetry(url string, reqConfig *RequestConfig) (*DetectionContext, error) {
+// fetchWithRetry makes the request, retrying with exponential backoff on failure
+func (hd *HTTPDetector) fetchWithRetry(ctx context.Context, target, url string, reqConfig *RequestConfig, digest *bodyDigest) (*DetectionContext, error) {
 	var lastErr error
 
 	for retry := 0; retry <= MaxRetries; retry++ {
-		ctx, err := hd.makeRequest(url, reqConfig)
+		dctx, err := hd.makeRequest(ctx, target, url, reqConfig, digest)
 		if err == nil {
-			return ctx, nil
+			return dctx, nil
 		}
 
 		lastErr = err
+		if errors.Is(err, ErrHostDenied) {
+			// The policy answers the same way every time
+			return nil, err
+		}
 
 		// Don't retry on last attempt
 		if retry < MaxRetries {
 			// Exponential backoff
-			backoff := InitialBackoff * time.Duration(math.Pow(2, float64(retry)))
-			time.Sleep(backoff)
+			backoff := min(InitialBackoff*time.Duration(math.Pow(2, float64(retry))), MaxBackoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
 		}
 	}
 
 	return nil, fmt.Errorf("failed after %d retries: %w", MaxRetries, lastErr)
 }
 
-// makeRequest performs HTTP request with manual redirect handling
-func (hd *HTTPDetector) makeRequest(url string, reqConfig *RequestConfig) (*DetectionContext, error) {
+// makeRequest performs HTTP request with manual redirect handling for a scan of target.
+// With a digest, only the regions of each body its patterns match are kept (Options.StreamBody).
+func (hd *HTTPDetector) makeRequest(ctx context.Context, target, url string, reqConfig *RequestConfig, digest *bodyDigest) (*DetectionContext, error) {
 	currentURL := url
 	redirectCount := 0
 
-	// Accumulate all bodies and headers from redirect chain
+	// Accumulate headers (and optionally bodies) from redirect chain
 	var allBodies []string
+	var finalBody string
+	var streamed *streamedBody
+	var contentType string
+	var statusCode int
 	allHeaders := make(map[string]string)
+	allCookies := make(map[string]string)
+	allLinks := []LinkHeader{}
+	var hops []HTTPHop
+
+	// Cookies set along the chain are sent on the next hops, as a browser would
+	chainJar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Switches to the non-verifying client after a certificate failure, see Options.TLSFallback
+	client := hd.client
+	tlsInvalid := false
+
+	if err := hd.hostPolicy.CheckURL(ctx, url); err != nil {
+		return nil, err
+	}
+
+	method := reqConfig.method()
+	if hd.readOnly && !isReadOnlyMethod(method) {
+		return nil, fmt.Errorf("%s request refused in read-only mode", method)
+	}
+	payload, payloadType, err := reqConfig.encodeBody()
+	if err != nil {
+		return nil, err
+	}
 
 	for {
-		method := "GET"
 		var body io.Reader
-
-		if reqConfig != nil {
-			if reqConfig.Method != "" {
-				method = reqConfig.Method
-			}
+		if payload != nil {
+			body = bytes.NewReader(payload)
 		}
 
-		req, err := http.NewRequest(method, currentURL, body)
+		reqCtx, cancel := context.WithTimeout(ctx, reqConfig.timeout())
+		req, err := http.NewRequestWithContext(reqCtx, method, currentURL, body)
 		if err != nil {
+			cancel()
 			return nil, err
 		}
+		if payload != nil {
+			req.Header.Set("Content-Type", payloadType)
+		}
+
+		hd.setRequestCookies(req, target, chainJar, reqConfig)
 
 		// Add custom headers
 		if reqConfig != nil && reqConfig.Headers != nil {
@@ -235,19 +654,57 @@ func (hd *HTTPDetector) makeRequest(url string, reqConfig *RequestConfig) (*Dete
 			}
 		}
 
-		// Make request
-		resp, err := hd.client.Do(req)
+		// Make request, waiting for a free per-host slot
+		release := hd.limiter.acquire(req.URL.Hostname())
+		resp, err := client.Do(req)
 		if err != nil {
+			release()
+			cancel()
+			if hd.fallbackClient != nil && !tlsInvalid && isCertificateError(err) {
+				// Retry this hop once without verification and flag the result
+				client = hd.fallbackClient
+				tlsInvalid = true
+				continue
+			}
 			return nil, err
 		}
 
-		// Read response body
-		bodyBytes, err := io.ReadAll(resp.Body)
+		// Read response body, or only what the path's regexes match of it
+		var bodyText string
+		var bodyMatches *streamedBody
+		err = consumeBody(resp.Body, hd.bodyIdleTimeout, cancel, func(r io.Reader) error {
+			if digest != nil {
+				var err error
+				bodyMatches, err = digest.read(r)
+				return err
+			}
+			data, err := io.ReadAll(r)
+			bodyText = string(data)
+			return err
+		})
 		resp.Body.Close()
+		release()
+		cancel()
 		if err != nil {
 			return nil, err
 		}
 
+		if hd.includeTransaction {
+			hop := HTTPHop{
+				Method:     method,
+				URL:        currentURL,
+				StatusCode: resp.StatusCode,
+				Location:   resp.Header.Get("Location"),
+				Headers:    make(map[string]string, len(resp.Header)),
+			}
+			for k, v := range resp.Header {
+				if len(v) > 0 {
+					hop.Headers[k] = v[0]
+				}
+			}
+			hops = append(hops, hop)
+		}
+
 		// Collect headers from this response
 		for k, v := range resp.Header {
 			if len(v) > 0 {
@@ -258,13 +715,39 @@ func (hd *HTTPDetector) makeRequest(url string, reqConfig *RequestConfig) (*Dete
 			}
 		}
 
+		for _, setCookie := range resp.Header.Values("Set-Cookie") {
+			addCookie(allCookies, setCookie)
+		}
+		for _, link := range resp.Header.Values("Link") {
+			allLinks = append(allLinks, parseLinkHeader(link)...)
+		}
+		if cookies := resp.Cookies(); len(cookies) > 0 {
+			chainJar.SetCookies(req.URL, cookies)
+			if hd.cookieJar != nil {
+				hd.cookieJar.SetCookies(req.URL, cookies)
+			}
+		}
+
+		// The final response decides the status and content type
+		statusCode = resp.StatusCode
+		contentType = normalizeContentType(resp.Header.Get("Content-Type"))
+
 		// Collect body from this response
-		if len(bodyBytes) > 0 {
-			allBodies = append(allBodies, string(bodyBytes))
+		switch {
+		case bodyMatches != nil && hd.combineBodies && streamed != nil:
+			streamed.merge(bodyMatches, hd.bodySeparator)
+		case bodyMatches != nil:
+			streamed = bodyMatches
+		case hd.combineBodies:
+			if len(bodyText) > 0 {
+				allBodies = append(allBodies, bodyText)
+			}
+		default:
+			finalBody = bodyText
 		}
 
-		// Check if this is a redirect (3xx status code)
-		if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		// Check if this is a redirect (3xx status code) the probe wants followed
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 && reqConfig.followRedirects() {
 			// Get redirect location
 			location := resp.Header.Get("Location")
 			if location == "" {
@@ -301,6 +784,19 @@ func (hd *HTTPDetector) makeRequest(url string, reqConfig *RequestConfig) (*Dete
 				break
 			}
 
+			// The host may resolve elsewhere by now, and behind a proxy nothing else checks it
+			if err := hd.hostPolicy.CheckURL(ctx, redirectURL); err != nil {
+				return nil, fmt.Errorf("redirect to %s: %w", redirectURL, err)
+			}
+
+			// Like browsers, 301/302/303 turn the request into a body-less GET;
+			// 307/308 repeat it as-is
+			if resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusPermanentRedirect &&
+				method != http.MethodGet && method != http.MethodHead {
+				method = http.MethodGet
+				payload = nil
+			}
+
 			// Follow the redirect
 			currentURL = redirectURL
 			redirectCount++
@@ -311,16 +807,117 @@ func (hd *HTTPDetector) makeRequest(url string, reqConfig *RequestConfig) (*Dete
 		break
 	}
 
-	// Combine all bodies (concatenate)
-	combinedBody := strings.Join(allBodies, "\n")
+	// Combine all bodies if requested, otherwise match the final response only
+	if streamed != nil {
+		finalBody = streamed.text()
+	} else if hd.combineBodies {
+		finalBody = joinBodies(allBodies, hd.bodySeparator, hd.maxCombinedBody)
+	}
 
 	return &DetectionContext{
-		Body:       combinedBody,
-		Headers:    allHeaders,
-		StatusCode: 200, // We successfully got responses
+		Body:        finalBody,
+		Headers:     allHeaders,
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		URL:         currentURL,
+		TLSInvalid:  tlsInvalid,
+		Cookies:     allCookies,
+		LinkHeaders: allLinks,
+		Hops:        hops,
+		streamed:    streamed,
 	}, nil
 }
 
+// setRequestCookies sets the Cookie header of a request for a scan of target: the cookies
+// of Options.CookieJar and of the redirect chain, then Options.Cookies scoped to the
+// request's host and the probe's own, each replacing earlier cookies of the same name
+func (hd *HTTPDetector) setRequestCookies(req *http.Request, target string, chainJar http.CookieJar, reqConfig *RequestConfig) {
+	var names []string
+	values := make(map[string]string)
+	add := func(name, value string) {
+		if _, exists := values[name]; !exists {
+			names = append(names, name)
+		}
+		values[name] = value
+	}
+
+	if hd.cookieJar != nil {
+		for _, cookie := range hd.cookieJar.Cookies(req.URL) {
+			add(cookie.Name, cookie.Value)
+		}
+	}
+	for _, cookie := range chainJar.Cookies(req.URL) {
+		add(cookie.Name, cookie.Value)
+	}
+	cookies := hd.scopedCookies(target, req.URL)
+	for _, name := range sortedKeys(cookies) {
+		add(name, cookies[name])
+	}
+	if reqConfig != nil {
+		for _, name := range sortedKeys(reqConfig.Cookies) {
+			add(name, reqConfig.Cookies[name])
+		}
+	}
+
+	for _, name := range names {
+		req.AddCookie(&http.Cookie{Name: name, Value: values[name]})
+	}
+}
+
+// scopedCookies returns the Options.Cookies sent with a request to u: all of them when
+// its host is one of Options.CookieDomains or a subdomain, or without CookieDomains, the
+// host of the scanned target or a subdomain; otherwise none
+func (hd *HTTPDetector) scopedCookies(target string, u *url.URL) map[string]string {
+	if len(hd.cookies) == 0 {
+		return nil
+	}
+	domains := hd.cookieDomains
+	if len(domains) == 0 {
+		base, err := url.Parse(target)
+		if err != nil || base.Hostname() == "" {
+			return nil
+		}
+		domains = []string{base.Hostname()}
+	}
+	for _, domain := range domains {
+		if isOnTarget(u.Hostname(), strings.TrimPrefix(domain, ".")) {
+			return hd.cookies
+		}
+	}
+	return nil
+}
+
+// isCertificateError checks if a request failed because the server certificate did not verify
+func isCertificateError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return errors.As(err, &verifyErr) ||
+		errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &invalid)
+}
+
+// joinBodies concatenates redirect bodies with sep, truncating the result to max bytes
+func joinBodies(bodies []string, sep string, max int) string {
+	var sb strings.Builder
+	for i, body := range bodies {
+		if i > 0 {
+			body = sep + body
+		}
+		remaining := max - sb.Len()
+		if remaining <= 0 {
+			break
+		}
+		if len(body) > remaining {
+			body = body[:remaining]
+		}
+		sb.WriteString(body)
+	}
+	return sb.String()
+}
+
 // Helper functions for URL parsing and comparison
 
 func parseURL(urlStr string) (map[string]string, error) {
@@ -0,0 +1,603 @@
+package techdetect
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// testClient returns a client whose requests all reach srv, whatever host the URL names,
+// so tests can use several domains ("http://target.test/") on one server
+func testClient(t *testing.T, srv *httptest.Server) *http.Client {
+	t.Helper()
+	addr := srv.Listener.Addr().String()
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	return &http.Client{Transport: transport}
+}
+
+// newTestDetector returns an HTTP detector sending its requests to srv, see testClient
+func newTestDetector(t *testing.T, srv *httptest.Server, opts Options) *HTTPDetector {
+	t.Helper()
+	opts.HTTPClient = testClient(t, srv)
+	return NewHTTPDetectorWithConfig(opts)
+}
+
+// newTestEngine returns a Detector loading the fingerprint database apps (JSON) and
+// sending its requests to srv, see testClient
+func newTestEngine(t *testing.T, srv *httptest.Server, apps string, opts Options) *Detector {
+	t.Helper()
+	opts.HTTPClient = testClient(t, srv)
+	loader := NewLoaderFromFS(fstest.MapFS{"fp.json": {Data: []byte(`{"apps": ` + apps + `}`)}}, ".")
+	d, err := NewDetectorWithLoader(loader, opts)
+	if err != nil {
+		t.Fatalf("NewDetectorWithLoader: %v", err)
+	}
+	return d
+}
+
+// fingerprint builds a fingerprint with a single probe of path
+func fingerprint(path string, detect map[string]interface{}) Fingerprint {
+	return Fingerprint{Paths: []PathProbe{{Path: path, Detect: detect}}}
+}
+
+// regex is the condition {"$regex": pattern}
+func regex(pattern string) map[string]interface{} {
+	return map[string]interface{}{"$regex": pattern}
+}
+
+func TestDetectHTTPHeaderMatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25.3")
+		w.Write([]byte("<html></html>"))
+	}))
+	defer srv.Close()
+
+	hd := newTestDetector(t, srv, Options{})
+	results, failed := hd.DetectHTTP("http://target.test/", map[string]Fingerprint{
+		"Nginx":  fingerprint("/", map[string]interface{}{"headers.server": regex(`nginx/([\d.]+)\;version:\1`)}),
+		"Apache": fingerprint("/", map[string]interface{}{"headers.server": regex("Apache")}),
+	})
+
+	if len(failed) > 0 {
+		t.Fatalf("failed paths %v", failed)
+	}
+	if tech, ok := results["Nginx"]; !ok || tech.Version != "1.25.3" {
+		t.Errorf("Nginx = %+v, want version 1.25.3", tech)
+	}
+	if _, ok := results["Apache"]; ok {
+		t.Error("Apache detected")
+	}
+}
+
+func TestDetectHTTPBodyRegex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<meta name="generator" content="WordPress 6.4.1">`))
+	}))
+	defer srv.Close()
+
+	hd := newTestDetector(t, srv, Options{})
+	results, _ := hd.DetectHTTP("http://target.test/", map[string]Fingerprint{
+		"WordPress": fingerprint("/", map[string]interface{}{"body": regex(`WordPress ([\d.]+)\;version:\1`)}),
+	})
+
+	if tech, ok := results["WordPress"]; !ok || tech.Version != "6.4.1" {
+		t.Errorf("WordPress = %+v, want version 6.4.1", tech)
+	}
+}
+
+func TestDetectHTTPSameDomainRedirect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("X-Hop", "first")
+			http.Redirect(w, r, "/login", http.StatusFound)
+		case "/login":
+			http.Redirect(w, r, "http://target.test/home", http.StatusMovedPermanently)
+		case "/home":
+			w.Write([]byte("welcome home"))
+		}
+	}))
+	defer srv.Close()
+
+	hd := newTestDetector(t, srv, Options{})
+	results, failed := hd.DetectHTTP("http://target.test/", map[string]Fingerprint{
+		"Home":     fingerprint("/", map[string]interface{}{"body": regex("welcome home")}),
+		"FirstHop": fingerprint("/", map[string]interface{}{"headers.x-hop": regex("first")}),
+	})
+
+	if len(failed) > 0 {
+		t.Fatalf("failed paths %v", failed)
+	}
+	if _, ok := results["Home"]; !ok {
+		t.Error("final response of the redirect chain not matched")
+	}
+	if _, ok := results["FirstHop"]; !ok {
+		t.Error("headers of the first hop not collected")
+	}
+}
+
+func TestDetectHTTPCrossDomainRedirect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "other.test" {
+			w.Write([]byte("other site"))
+			return
+		}
+		w.Header().Set("Location", "http://other.test/")
+		w.WriteHeader(http.StatusFound)
+		w.Write([]byte("redirect stub"))
+	}))
+	defer srv.Close()
+
+	hd := newTestDetector(t, srv, Options{})
+	results, failed := hd.DetectHTTP("http://target.test/", map[string]Fingerprint{
+		"Stub":  fingerprint("/", map[string]interface{}{"body": regex("redirect stub")}),
+		"Other": fingerprint("/", map[string]interface{}{"body": regex("other site")}),
+	})
+
+	if len(failed) > 0 {
+		t.Fatalf("failed paths %v", failed)
+	}
+	if _, ok := results["Stub"]; !ok {
+		t.Error("redirect response not matched")
+	}
+	if _, ok := results["Other"]; ok {
+		t.Error("cross-domain redirect followed")
+	}
+}
+
+func TestDetectHTTPNotFoundAndFailedPaths(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte("home"))
+		case "/broken":
+			// Drop the connection without a response
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	hd := newTestDetector(t, srv, Options{})
+	results, failed := hd.DetectHTTP("http://target.test/", map[string]Fingerprint{
+		"Home":   fingerprint("/", map[string]interface{}{"body": regex("home")}),
+		"Admin":  fingerprint("/admin/", map[string]interface{}{"body": regex("Admin Console")}),
+		"Broken": fingerprint("/broken", map[string]interface{}{"body": regex(".")}),
+	})
+
+	if _, ok := results["Home"]; !ok {
+		t.Error("Home not detected")
+	}
+	if _, ok := results["Admin"]; ok {
+		t.Error("Admin detected on a 404 page")
+	}
+	// A 404 is a response; only paths that could not be fetched fail
+	if !slices.Equal(failed, []string{"/broken"}) {
+		t.Errorf("failed paths = %v, want [/broken]", failed)
+	}
+}
+
+func TestDetectHTTPGzipBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`<script src="/static/jquery-3.7.1.min.js"></script>`))
+		gz.Close()
+	}))
+	defer srv.Close()
+
+	hd := newTestDetector(t, srv, Options{})
+	results, _ := hd.DetectHTTP("http://target.test/", map[string]Fingerprint{
+		"jQuery": fingerprint("/", map[string]interface{}{"body": regex(`jquery-([\d.]+)\.min\.js\;version:\1`)}),
+	})
+
+	if tech, ok := results["jQuery"]; !ok || tech.Version != "3.7.1" {
+		t.Errorf("jQuery = %+v, want version 3.7.1 from the decompressed body", tech)
+	}
+}
+
+func TestDetectHTTPErrorPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		if r.URL.Path == "/" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		w.Write([]byte("<h1>Request blocked by the firewall</h1>"))
+	}))
+	defer srv.Close()
+
+	waf := `{"status": {"$in": [403, 406]}, "body": {"$regex": "Request blocked by the firewall"}}`
+	hd := newTestDetector(t, srv, Options{})
+	results, failed := hd.DetectHTTP("http://target.test/", map[string]Fingerprint{
+		"WAF":        fingerprint("/", parseQuery(t, waf)),
+		"WAF (200)":  fingerprint("/ok", parseQuery(t, waf)),
+		"Nginx":      fingerprint("/", map[string]interface{}{"headers.server": regex("nginx")}),
+		"Status 200": fingerprint("/", parseQuery(t, `{"status": {"$eq": "200"}}`)),
+	})
+
+	if len(failed) > 0 {
+		t.Fatalf("failed paths %v", failed)
+	}
+	if _, ok := results["WAF"]; !ok {
+		t.Error("WAF block page (403) not detected")
+	}
+	if _, ok := results["WAF (200)"]; ok {
+		t.Error("block page text on a 200 detected as the WAF")
+	}
+	if _, ok := results["Nginx"]; !ok {
+		t.Error("headers of the 403 response not evaluated")
+	}
+	if _, ok := results["Status 200"]; ok {
+		t.Error("403 reported as 200")
+	}
+}
+
+func TestDetectHTTPJSONRPC(t *testing.T) {
+	var posts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call struct {
+			Method string `json:"method"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&call) != nil || call.Method != "web3_clientVersion" {
+			w.Write([]byte("<html></html>"))
+			return
+		}
+		posts++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"Geth/v1.13.14-stable/linux-amd64/go1.21.7"}`))
+	}))
+	defer srv.Close()
+
+	all, err := NewLoader("").LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprints := map[string]Fingerprint{"Geth": all["Geth"]}
+
+	// The probe POSTs to the node, so it is only sent when sensitive probes are allowed
+	results, _ := newTestDetector(t, srv, Options{}).DetectHTTP("http://node.test/", fingerprints)
+	if _, ok := results["Geth"]; ok || posts != 0 {
+		t.Fatalf("sensitive probe sent by default: %d posts, results %v", posts, results)
+	}
+
+	results, failed := newTestDetector(t, srv, Options{AllowSensitive: true}).DetectHTTP("http://node.test/", fingerprints)
+	if len(failed) > 0 {
+		t.Fatalf("failed paths %v", failed)
+	}
+	if tech, ok := results["Geth"]; !ok || tech.Version != "1.13.14" {
+		t.Errorf("Geth = %+v, want version 1.13.14", tech)
+	}
+	if posts != 1 {
+		t.Errorf("%d JSON-RPC calls, want 1", posts)
+	}
+}
+
+func TestDetectHTTPVersionFromURLAndCookie(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.SetCookie(w, &http.Cookie{Name: "acme_build", Value: "acme-2.3.7"})
+			http.Redirect(w, r, "/home?lang=en&ver=6.4.1", http.StatusFound)
+		case "/home":
+			w.Write([]byte("<html>Acme</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	hd := newTestDetector(t, srv, Options{})
+	results, _ := hd.DetectHTTP("http://target.test/", map[string]Fingerprint{
+		"Acme CMS": {Paths: []PathProbe{{
+			Path:           "/",
+			Detect:         map[string]interface{}{"url": regex(`/home\?`)},
+			ExtractVersion: []map[string]string{{"url": `[?&]ver=([\d.]+)`}},
+		}}},
+		"Acme Build": {Paths: []PathProbe{{
+			Path:           "/",
+			Detect:         map[string]interface{}{"cookies.ACME_BUILD": map[string]interface{}{"$exists": true}},
+			ExtractVersion: []map[string]string{{"cookies.acme_build": `^acme-([\d.]+)$`}},
+		}}},
+	})
+
+	if tech, ok := results["Acme CMS"]; !ok || tech.Version != "6.4.1" {
+		t.Errorf("Acme CMS = %+v, want version 6.4.1 from the final URL", tech)
+	}
+	if tech, ok := results["Acme Build"]; !ok || tech.Version != "2.3.7" {
+		t.Errorf("Acme Build = %+v, want version 2.3.7 from the redirect's cookie", tech)
+	}
+}
+
+func TestDetectHTTPBlockPages(t *testing.T) {
+	pages := map[string]struct {
+		status int
+		body   string
+	}{
+		"aws.test":        {403, "<h1>403 ERROR</h1><h2>The request could not be satisfied.</h2>Request blocked.\nWe can't connect to the server.<hr>Generated by cloudfront (CloudFront)"},
+		"cloudflare.test": {403, "<title>Attention Required! | Cloudflare</title><h1>Sorry, you have been blocked</h1>"},
+		"modsec.test":     {406, "<h1>Not Acceptable</h1><p>An appropriate representation was not found. This error was generated by Mod_Security.</p>"},
+		"ok-status.test":  {200, "<p>Our blog post: Sorry, you have been blocked, mod_security and Generated by cloudfront explained</p>"},
+		"plain-403.test":  {403, "<h1>Forbidden</h1>"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := pages[r.Host]
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(page.status)
+		w.Write([]byte(page.body))
+	}))
+	defer srv.Close()
+
+	all, err := NewLoader("").LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprints := make(map[string]Fingerprint)
+	for _, name := range []string{"AWS WAF", "Cloudflare Block Page", "ModSecurity"} {
+		fingerprints[name] = all[name]
+	}
+
+	tests := []struct {
+		host string
+		want string // "" when nothing is detected
+	}{
+		{"aws.test", "AWS WAF"},
+		{"cloudflare.test", "Cloudflare Block Page"},
+		{"modsec.test", "ModSecurity"},
+		{"ok-status.test", ""},
+		{"plain-403.test", ""},
+	}
+
+	hd := newTestDetector(t, srv, Options{})
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			results, _ := hd.DetectHTTP("http://"+tt.host+"/", fingerprints)
+			var detected []string
+			for name := range results {
+				detected = append(detected, name)
+			}
+			if tt.want == "" && len(detected) > 0 || tt.want != "" && (len(detected) != 1 || detected[0] != tt.want) {
+				t.Errorf("detected %v, want %q", detected, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectHTTPCookieScope(t *testing.T) {
+	var mu sync.Mutex
+	sent := make(map[string]string) // host -> session cookie received
+	var appRequests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Host == "app.target.test" {
+			appRequests++
+		}
+		if c, err := r.Cookie("session"); err == nil {
+			sent[r.Host] = c.Value
+		}
+		w.Write([]byte("<html></html>"))
+	}))
+	defer srv.Close()
+
+	fingerprints := map[string]Fingerprint{
+		"Root":   fingerprint("/", map[string]interface{}{"body": regex(`root`)}),
+		"Status": fingerprint("http://vendor.test/status/{host}", map[string]interface{}{"body": regex(`status`)}),
+		"App":    fingerprint("http://app.target.test/", map[string]interface{}{"body": regex(`app`)}),
+	}
+	scan := func(opts Options, url string) map[string]string {
+		t.Helper()
+		mu.Lock()
+		clear(sent)
+		mu.Unlock()
+		opts.AllowOffTargetTemplates = true
+		opts.Cookies = map[string]string{"session": "secret"}
+		newTestDetector(t, srv, opts).DetectHTTP(url, fingerprints)
+		mu.Lock()
+		defer mu.Unlock()
+		return maps.Clone(sent)
+	}
+
+	// By default only the target and its subdomains get the cookies
+	got := scan(Options{}, "http://target.test/")
+	if want := map[string]string{"target.test": "secret", "app.target.test": "secret"}; !maps.Equal(got, want) {
+		t.Errorf("cookies sent %v, want %v", got, want)
+	}
+
+	// CookieDomains replace the target
+	got = scan(Options{CookieDomains: []string{"app.target.test", "vendor.test"}}, "http://target.test/")
+	if want := map[string]string{"app.target.test": "secret", "vendor.test": "secret"}; !maps.Equal(got, want) {
+		t.Errorf("cookies sent with CookieDomains %v, want %v", got, want)
+	}
+
+	// A response cached for a request with the cookies isn't reused for one without
+	cache := NewRequestCache(0)
+	scan(Options{RequestCache: cache}, "http://target.test/")
+	appRequests = 0
+	got = scan(Options{RequestCache: cache}, "http://vendor.test/")
+	if _, ok := got["app.target.test"]; ok || appRequests != 1 {
+		t.Errorf("app.target.test got cookies %v in %d requests, want one request without them", got, appRequests)
+	}
+}
+
+func TestDetectPathlessProbe(t *testing.T) {
+	var rootRequests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		rootRequests++
+		w.Header().Set("X-Powered-By", "Acme/3.2")
+		w.Write([]byte(`<html><div id="acme-root"></div></html>`))
+	}))
+	defer srv.Close()
+
+	d := newTestEngine(t, srv, `{
+		"Acme": {"paths": [{"detect": {"headers.x-powered-by": {"$regex": "^Acme/([\\d.]+)\\;version:\\1"}}}]},
+		"Acme Widgets": {"paths": [{"path": "/", "detect": {"body": {"$regex": "acme-root"}}}]}
+	}`, Options{})
+
+	// The probe without a path joins the target page's request
+	for _, c := range d.pathClassifications {
+		if c.Path != "/" {
+			t.Errorf("classified under path %q, want /", c.Path)
+		}
+	}
+
+	for _, scan := range []struct {
+		name   string
+		detect func(string) (*DetectResult, error)
+	}{
+		{"full", func(url string) (*DetectResult, error) { return d.Detect(url, false) }},
+		{"root only", d.DetectRootOnly},
+	} {
+		rootRequests = 0
+		result, err := scan.detect("http://target.test/")
+		if err != nil {
+			t.Fatalf("%s scan: %v", scan.name, err)
+		}
+		if !hasTech(result.Technologies, "Acme") || !hasTech(result.Technologies, "Acme Widgets") {
+			t.Errorf("%s scan detected %+v, want Acme and Acme Widgets", scan.name, result.Technologies)
+		}
+		if rootRequests != 1 {
+			t.Errorf("%s scan fetched the root %d times, want once", scan.name, rootRequests)
+		}
+	}
+}
+
+func TestDetectHTTPTemplatedBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/site-info":
+			var payload struct {
+				Site string `json:"site"`
+				Page string `json:"page"`
+			}
+			if json.NewDecoder(r.Body).Decode(&payload) != nil || r.Header.Get("Content-Type") != "application/json" {
+				http.Error(w, "bad payload", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"platform": "acme", "site": payload.Site, "page": payload.Page})
+		case "/lookup":
+			// The query of the target URL stays inside its form field
+			if r.FormValue("page") != "http://target.test/shop/?lang=en&ref=x" || r.FormValue("ref") != "" {
+				http.Error(w, "bad form", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte("lookup ok for " + r.FormValue("site")))
+		}
+	}))
+	defer srv.Close()
+
+	post := func(path string, body interface{}, headers map[string]string, detect map[string]interface{}) Fingerprint {
+		return Fingerprint{Paths: []PathProbe{{
+			Path:    path,
+			Request: &RequestConfig{Method: http.MethodPost, Headers: headers, Body: body},
+			Detect:  detect,
+		}}}
+	}
+	results, failed := newTestDetector(t, srv, Options{}).DetectHTTP("http://target.test/shop/?lang=en&ref=x", map[string]Fingerprint{
+		"Acme": post("/api/site-info", map[string]interface{}{"site": "{host}", "page": "{url}"}, nil, map[string]interface{}{
+			"json.site": map[string]interface{}{"$eq": "target.test"},
+			"json.page": map[string]interface{}{"$eq": "http://target.test/shop/?lang=en&ref=x"},
+		}),
+		"Lookup": post("/lookup", "site={host}&page={url}",
+			map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			map[string]interface{}{"body": regex(`^lookup ok for target\.test$`)}),
+	})
+	if len(failed) > 0 {
+		t.Errorf("failed paths %v", failed)
+	}
+	for _, name := range []string{"Acme", "Lookup"} {
+		if _, ok := results[name]; !ok {
+			t.Errorf("%s not detected, the templated body wasn't sent as expected", name)
+		}
+	}
+}
+
+func TestDetectHTTPBodyExists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/content":
+			w.Write([]byte("<html>ok</html>"))
+		case "/newlines":
+			w.Write([]byte("\n\n"))
+		case "/empty":
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+		case "/stub":
+			w.Header().Set("Location", "/content")
+			w.WriteHeader(http.StatusFound)
+		case "/redirect-page":
+			http.Redirect(w, r, "/content", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	noFollow := false
+	tests := []struct {
+		path    string
+		request *RequestConfig
+		want    bool // whether the body exists
+	}{
+		{"/content", nil, true},
+		{"/newlines", nil, true},
+		{"/empty", nil, false},
+		{"/no-content", nil, false},
+		{"/content", &RequestConfig{Method: http.MethodHead}, false},
+		{"/stub", &RequestConfig{FollowRedirects: &noFollow}, false},
+		// A redirect with a page of its own has a body
+		{"/redirect-page", &RequestConfig{FollowRedirects: &noFollow}, true},
+	}
+
+	for _, stream := range []bool{false, true} {
+		hd := newTestDetector(t, srv, Options{StreamBody: stream})
+		for _, tt := range tests {
+			probe := func(exists bool) Fingerprint {
+				return Fingerprint{Paths: []PathProbe{{
+					Path:    tt.path,
+					Request: tt.request,
+					Detect:  map[string]interface{}{"body": map[string]interface{}{"$exists": exists}},
+				}}}
+			}
+			results, failed := hd.DetectHTTP("http://target.test/", map[string]Fingerprint{
+				"Content": probe(true),
+				"Empty":   probe(false),
+			})
+			if len(failed) > 0 {
+				t.Errorf("%s %s (streamed %v): failed paths %v", tt.request.method(), tt.path, stream, failed)
+			}
+			_, content := results["Content"]
+			_, empty := results["Empty"]
+			if content != tt.want || empty == tt.want {
+				t.Errorf("%s %s (streamed %v): body exists %v, not exists %v; want %v",
+					tt.request.method(), tt.path, stream, content, empty, tt.want)
+			}
+		}
+	}
+}
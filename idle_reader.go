@@ -0,0 +1,62 @@
+package techdetect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrResponseStalled is returned when a response body stops arriving for longer than
+// Options.BodyIdleTimeout, e.g. a server dripping bytes to hold the connection open
+var ErrResponseStalled = errors.New("response body stalled")
+
+// idleReader cancels the request when no data arrives within the idle timeout
+type idleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+	stalled atomic.Bool
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 {
+		ir.timer.Reset(ir.timeout)
+	}
+	return n, err
+}
+
+// readBody reads a response body, cancelling the request through cancel when it stalls
+// for longer than the idle timeout (no limit when timeout <= 0)
+func readBody(body io.Reader, timeout time.Duration, cancel context.CancelFunc) ([]byte, error) {
+	var data []byte
+	err := consumeBody(body, timeout, cancel, func(r io.Reader) error {
+		var err error
+		data, err = io.ReadAll(r)
+		return err
+	})
+	return data, err
+}
+
+// consumeBody hands a response body to consume, with the idle timeout of readBody
+func consumeBody(body io.Reader, timeout time.Duration, cancel context.CancelFunc, consume func(io.Reader) error) error {
+	if timeout <= 0 {
+		return consume(body)
+	}
+
+	ir := &idleReader{r: body, timeout: timeout}
+	ir.timer = time.AfterFunc(timeout, func() {
+		ir.stalled.Store(true)
+		cancel()
+	})
+	defer ir.timer.Stop()
+
+	err := consume(ir)
+	if err != nil && ir.stalled.Load() {
+		return fmt.Errorf("%w: no data for %s", ErrResponseStalled, timeout)
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package techdetect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReadBodyIdleTimeout(t *testing.T) {
+	// A body that sends a little, then stalls for stall before finishing
+	drip := func(stall time.Duration) *io.PipeReader {
+		r, w := io.Pipe()
+		go func() {
+			w.Write([]byte("<html>"))
+			time.Sleep(stall)
+			w.Write([]byte("</html>"))
+			w.Close()
+		}()
+		return r
+	}
+
+	// Cancelling the request aborts its body, as closing the pipe does here
+	body := drip(time.Second)
+	cancel := func() { body.CloseWithError(context.Canceled) }
+	if _, err := readBody(body, 50*time.Millisecond, cancel); !errors.Is(err, ErrResponseStalled) {
+		t.Errorf("stalled body: error %v, want ErrResponseStalled", err)
+	}
+
+	// Off by default: only the request timeout applies
+	data, err := readBody(drip(100*time.Millisecond), 0, func() {})
+	if err != nil || string(data) != "<html></html>" {
+		t.Errorf("without idle timeout: %q, %v", data, err)
+	}
+	if NewHTTPDetectorWithConfig(Options{}).bodyIdleTimeout != 0 {
+		t.Error("body idle timeout enabled by default")
+	}
+}
@@ -0,0 +1,69 @@
+package techdetect
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// parsedJSON returns the response body decoded as JSON, parsing it at most once per context
+func (ctx *DetectionContext) parsedJSON() (interface{}, bool) {
+	ctx.jsonOnce.Do(func() {
+		body := strings.TrimSpace(ctx.Body)
+		if body == "" || (body[0] != '{' && body[0] != '[') {
+			return
+		}
+		if err := json.Unmarshal([]byte(body), &ctx.jsonValue); err == nil {
+			ctx.jsonValid = true
+		}
+	})
+	return ctx.jsonValue, ctx.jsonValid
+}
+
+// lookupJSONPath walks a decoded JSON value using dot notation (array elements by index)
+func lookupJSONPath(value interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return value, true
+	}
+
+	current := value
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, exists := node[part]
+			if !exists {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			current = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// stringifyValue converts a structured field value to the string form used by string operators
+func stringifyValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
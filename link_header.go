@@ -0,0 +1,122 @@
+package techdetect
+
+import "strings"
+
+// LinkHeader is one entry of a Link response header (RFC 8288), such as a preload hint
+type LinkHeader struct {
+	URL string `json:"url"` // target as written, without the angle brackets
+	Rel string `json:"rel"` // lowercased, may hold several space-separated types
+}
+
+// parseLinkHeader splits a Link header value into its entries. Commas and semicolons
+// inside the <target> or quoted parameter values don't separate anything; entries
+// without a target are skipped.
+func parseLinkHeader(value string) []LinkHeader {
+	var links []LinkHeader
+	for _, entry := range splitLinkHeader(value, ',') {
+		params := splitLinkHeader(entry, ';')
+		target := strings.TrimSpace(params[0])
+		if len(target) < 2 || target[0] != '<' || target[len(target)-1] != '>' {
+			continue
+		}
+
+		link := LinkHeader{URL: strings.TrimSpace(target[1 : len(target)-1])}
+		for _, param := range params[1:] {
+			name, val, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "rel") {
+				continue
+			}
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+			link.Rel = strings.ToLower(strings.Join(strings.Fields(val), " "))
+			// Only the first rel parameter counts
+			break
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// splitLinkHeader splits s at sep, except inside <...> and quoted strings
+func splitLinkHeader(s string, sep byte) []string {
+	var parts []string
+	inTarget, inQuotes := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inQuotes:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuotes = false
+			}
+		case c == '"':
+			inQuotes = true
+		case c == '<':
+			inTarget = true
+		case c == '>':
+			inTarget = false
+		case c == sep && !inTarget:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// linkHeaders returns the Link header entries of the response; when LinkHeaders is nil,
+// they are read from the Link header
+func (ctx *DetectionContext) linkHeaders() []LinkHeader {
+	if ctx.LinkHeaders != nil {
+		return ctx.LinkHeaders
+	}
+	var links []LinkHeader
+	for k, v := range ctx.Headers {
+		if strings.EqualFold(k, "Link") {
+			links = append(links, parseLinkHeader(v)...)
+		}
+	}
+	return links
+}
+
+// linkHeaderField resolves the linkheader fields: "linkheader" is the array of {url, rel}
+// objects, "linkheader.rel" every link type and "linkheader.url" every target, each
+// without duplicates
+func (ctx *DetectionContext) linkHeaderField(attribute string) (interface{}, bool) {
+	links := ctx.linkHeaders()
+	if len(links) == 0 {
+		return nil, false
+	}
+
+	var values []interface{}
+	seen := make(map[string]bool)
+	add := func(value string) {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+
+	switch attribute {
+	case "":
+		for _, link := range links {
+			values = append(values, map[string]interface{}{"url": link.URL, "rel": link.Rel})
+		}
+	case "rel":
+		for _, link := range links {
+			for _, rel := range strings.Fields(link.Rel) {
+				add(rel)
+			}
+		}
+	case "url":
+		for _, link := range links {
+			add(link.URL)
+		}
+	default:
+		return nil, false
+	}
+
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values, true
+}
@@ -0,0 +1,301 @@
+package techdetect
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Severities of lint issues
+const (
+	LintError   = "error"   // the rule can't work as written
+	LintWarning = "warning" // the rule works, but is likely a mistake
+)
+
+// LintIssue is a problem found in a fingerprint by Lint
+type LintIssue struct {
+	Technology string `json:"technology"`
+	Severity   string `json:"severity"`           // LintError or LintWarning
+	Location   string `json:"location,omitempty"` // e.g. paths[0].detect.$or[1].body
+	Message    string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	location := i.Technology
+	if i.Location != "" {
+		location += " " + i.Location
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, location, i.Message)
+}
+
+// broadSamples are unrelated values a specific pattern should not match all of
+var broadSamples = []string{"a", "Z", "0", " ", "<", "/"}
+
+// knownOperators are the field operators the query evaluator understands
+var knownOperators = map[string]bool{
+	"$regex": true, "$options": true, "$eq": true, "$ne": true, "$exists": true,
+	"$in": true, "$nin": true, "$elemMatch": true, "$all": true, "$size": true,
+	"$contains_token": true, "$count": true, "$not": true,
+}
+
+// Lint checks a fingerprint database more thoroughly than loading does, which accepts
+// any well-formed JSON: regexes that don't compile, operators the evaluator ignores,
+// $or branches that can never be the one to match, patterns matching almost anything,
+// implies and requires naming unknown technologies, and fingerprints without probes.
+// Issues are sorted by technology.
+func Lint(fingerprints map[string]Fingerprint) []LintIssue {
+	names := make([]string, 0, len(fingerprints))
+	for name := range fingerprints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var issues []LintIssue
+	for _, name := range names {
+		l := &linter{tech: name, fingerprints: fingerprints}
+		l.fingerprint(fingerprints[name])
+		issues = append(issues, l.issues...)
+	}
+	return issues
+}
+
+// linter collects the issues of one fingerprint
+type linter struct {
+	tech         string
+	fingerprints map[string]Fingerprint
+	issues       []LintIssue
+}
+
+func (l *linter) report(severity, location, format string, args ...interface{}) {
+	l.issues = append(l.issues, LintIssue{
+		Technology: l.tech,
+		Severity:   severity,
+		Location:   location,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+// fingerprint checks the references and probes of a fingerprint
+func (l *linter) fingerprint(fp Fingerprint) {
+	if len(fp.Paths) == 0 && len(fp.Browser) == 0 {
+		l.report(LintWarning, "", "no probes, only detected when implied by another technology")
+	}
+	for i, implied := range fp.Implies {
+		if _, exists := l.fingerprints[implied]; !exists {
+			hint := ""
+			if strings.Contains(implied, "\\;") {
+				hint = " (\\;confidence: and \\;version: suffixes are not supported in implies)"
+			}
+			l.report(LintError, fmt.Sprintf("implies[%d]", i), "implies unknown technology %q%s", implied, hint)
+		}
+	}
+	for i, rule := range fp.VersionRules {
+		if strings.TrimSpace(rule.Range) == "" {
+			l.report(LintError, fmt.Sprintf("version_rules[%d]", i), "empty version_range")
+		}
+	}
+
+	for i, probe := range fp.Paths {
+		location := fmt.Sprintf("paths[%d]", i)
+		for j, required := range probe.Requires {
+			if _, exists := l.fingerprints[required]; !exists {
+				l.report(LintError, fmt.Sprintf("%s.requires[%d]", location, j), "requires unknown technology %q", required)
+			}
+		}
+		if probe.Detect == nil {
+			l.report(LintError, location+".detect", "missing detect query, the probe never matches")
+		} else {
+			l.query(location+".detect", probe.Detect, false)
+		}
+		l.rules(location+".extract_version", probe.ExtractVersion)
+		for name, rules := range probe.Extract {
+			l.rules(location+".extract."+name, rules)
+		}
+	}
+	for i, probe := range fp.Browser {
+		if strings.TrimSpace(probe.Detection) == "" && strings.TrimSpace(probe.Version) == "" {
+			l.report(LintError, fmt.Sprintf("browser[%d]", i), "neither detection nor version script")
+		}
+	}
+}
+
+// query checks a query object. In an $elemMatch sub-query, element is true and operator
+// keys apply to the array element itself.
+func (l *linter) query(location string, query map[string]interface{}, element bool) {
+	if len(query) == 0 {
+		l.report(LintError, location, "empty query never matches")
+		return
+	}
+
+	for _, key := range sortedKeys(query) {
+		value := query[key]
+		switch {
+		case key == "$or" || key == "$and" || key == "$nor":
+			l.logical(location+"."+key, key, value, element)
+		case key == "$not":
+			condMap, ok := value.(map[string]interface{})
+			if !ok {
+				l.report(LintError, location+".$not", "$not takes a query object")
+				continue
+			}
+			l.query(location+".$not", condMap, element)
+		case key == "headers":
+			headers, ok := value.(map[string]interface{})
+			if !ok || len(headers) == 0 {
+				l.report(LintError, location+".headers", "headers takes an object of header conditions")
+				continue
+			}
+			for _, name := range sortedKeys(headers) {
+				l.field(location+".headers."+name, headers[name])
+			}
+		case strings.HasPrefix(key, "$"):
+			if !element {
+				l.report(LintError, location+"."+key, "unknown logical operator, the query never matches")
+				continue
+			}
+			l.field(location, map[string]interface{}{key: value})
+		default:
+			l.field(location+"."+key, value)
+		}
+	}
+}
+
+// logical checks the conditions of $or, $and or $nor
+func (l *linter) logical(location, operator string, value interface{}, element bool) {
+	conditions, ok := value.([]interface{})
+	if !ok || len(conditions) == 0 {
+		l.report(LintError, location, "%s takes a non-empty array of queries", operator)
+		return
+	}
+
+	for i, cond := range conditions {
+		branch := fmt.Sprintf("%s[%d]", location, i)
+		condMap, ok := cond.(map[string]interface{})
+		if !ok {
+			l.report(LintError, branch, "not a query object, ignored")
+			continue
+		}
+		if operator == "$or" {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(cond, conditions[j]) {
+					l.report(LintWarning, branch, "unreachable, same as %s[%d]", location, j)
+					break
+				}
+			}
+		}
+		l.query(branch, condMap, element)
+	}
+}
+
+// field checks the operators of a field condition
+func (l *linter) field(location string, condition interface{}) {
+	condMap, ok := condition.(map[string]interface{})
+	if !ok {
+		l.report(LintError, location, "field condition must be an object of operators, never matches")
+		return
+	}
+	if len(condMap) == 0 {
+		l.report(LintError, location, "no operators, never matches")
+		return
+	}
+
+	for _, operator := range sortedKeys(condMap) {
+		operand := condMap[operator]
+		opLocation := location + "." + operator
+		if !knownOperators[operator] {
+			l.report(LintError, opLocation, "unknown operator, ignored")
+			continue
+		}
+
+		switch operator {
+		case "$regex":
+			pattern, ok := operand.(string)
+			if !ok {
+				l.report(LintError, opLocation, "$regex takes a string")
+				continue
+			}
+			// A pattern capturing a version may match any value on purpose, e.g. "^(.+)$"
+			parts := strings.Split(pattern, "\\;version:")
+			if re := l.pattern(opLocation, parts[0], len(parts) == 1); re != nil && len(parts) > 1 && re.NumSubexp() == 0 {
+				l.report(LintError, opLocation, "\\;version: without a capture group never yields a version")
+			}
+		case "$count":
+			spec, _ := operand.(map[string]interface{})
+			pattern, ok := spec["pattern"].(string)
+			if !ok {
+				l.report(LintError, opLocation, "$count takes an object with a string pattern")
+				continue
+			}
+			l.pattern(opLocation+".pattern", pattern, true)
+		case "$not":
+			l.field(opLocation, operand)
+		case "$elemMatch":
+			subQuery, ok := operand.(map[string]interface{})
+			if !ok {
+				l.report(LintError, opLocation, "$elemMatch takes a query object")
+				continue
+			}
+			l.query(opLocation, subQuery, true)
+		case "$in", "$nin", "$all":
+			if values, ok := operand.([]interface{}); !ok || len(values) == 0 {
+				l.report(LintError, opLocation, "%s takes a non-empty array", operator)
+			}
+		case "$exists":
+			if _, ok := operand.(bool); !ok {
+				l.report(LintError, opLocation, "$exists takes true or false")
+			}
+		}
+	}
+	if len(condMap) == 1 && condMap["$options"] != nil {
+		l.report(LintError, location, "only $options, never matches")
+	}
+}
+
+// rules checks extraction rules, whose first capture group is the extracted value
+func (l *linter) rules(location string, rules []map[string]string) {
+	for i, rule := range rules {
+		for _, field := range sortedKeys(rule) {
+			ruleLocation := fmt.Sprintf("%s[%d].%s", location, i, field)
+			if re := l.pattern(ruleLocation, rule[field], false); re != nil && re.NumSubexp() == 0 {
+				l.report(LintError, ruleLocation, "no capture group, never extracts a value")
+			}
+		}
+	}
+}
+
+// pattern compiles a regex, reporting it when it doesn't compile or, with checkBroad,
+// matches almost anything
+func (l *linter) pattern(location, pattern string, checkBroad bool) *regexp.Regexp {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		l.report(LintError, location, "invalid regex: %v", err)
+		return nil
+	}
+	if !checkBroad {
+		return re
+	}
+
+	if re.MatchString("") {
+		l.report(LintWarning, location, "regex %q matches any value, use $exists to test presence", pattern)
+		return re
+	}
+	for _, sample := range broadSamples {
+		if !re.MatchString(sample) {
+			return re
+		}
+	}
+	l.report(LintWarning, location, "regex %q matches almost any value, use $exists to test for a non-empty one", pattern)
+	return re
+}
+
+// sortedKeys returns the keys of a map in order, for stable reports
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,105 +1,248 @@
 package techdetect
 
 import (
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io/fs"
 	"os"
-	"path/filepath"
+	"path"
+	"sort"
+	"strconv"
+	"time"
 )
 
 //go:embed data/fingerprints/*.json
 var embeddedFingerprints embed.FS
 
-// Loader handles loading fingerprints from disk or embedded FS
+// Loader handles loading fingerprints from disk, the embedded set or any fs.FS
 type Loader struct {
-	fingerprintsDir string
-	useEmbedded     bool
+	fsys fs.FS
+	dir  string // directory within fsys holding the *.json files
+	info DatabaseInfo
+
+	// Technologies defined by more than one file, found by the last load
+	duplicates []DuplicateDefinition
+}
+
+// DuplicateDefinition is a technology defined in two fingerprint files; the later file's
+// definition replaced the earlier one
+type DuplicateDefinition struct {
+	Name       string `json:"name"`
+	File       string `json:"file"`       // file whose definition was kept
+	Overridden string `json:"overridden"` // file whose definition was replaced
+}
+
+// String describes the duplicate for warnings
+func (d DuplicateDefinition) String() string {
+	return fmt.Sprintf("%q in %s overrides the definition in %s", d.Name, d.File, d.Overridden)
+}
+
+// DatabaseInfo identifies the fingerprint rule set that produced a detection
+type DatabaseInfo struct {
+	Hash         string            `json:"hash"`              // SHA-256 over all fingerprint files in load order
+	Updated      string            `json:"updated,omitempty"` // newest "updated" timestamp declared by any file
+	Files        int               `json:"files"`
+	Fingerprints int               `json:"fingerprints"`
+	Versions     map[string]string `json:"versions,omitempty"` // file name -> declared version
 }
 
-// NewLoader creates a new fingerprint loader that uses embedded fingerprints
+// NewLoader creates a new fingerprint loader that reads the *.json files of a directory,
+// or uses the embedded fingerprints if fingerprintsDir is empty or the default
 func NewLoader(fingerprintsDir string) *Loader {
 	// If fingerprintsDir is empty or default, use embedded
-	useEmbedded := fingerprintsDir == "" || fingerprintsDir == "./data/fingerprints"
+	if fingerprintsDir == "" || fingerprintsDir == "./data/fingerprints" {
+		return NewLoaderFromFS(embeddedFingerprints, "data/fingerprints")
+	}
+	return NewLoaderFromFS(os.DirFS(fingerprintsDir), ".")
+}
+
+// NewLoaderFromFS creates a fingerprint loader that reads the *.json files of dir within
+// fsys, e.g. an application's own embed.FS or a zip archive (zip.Reader)
+func NewLoaderFromFS(fsys fs.FS, dir string) *Loader {
 	return &Loader{
-		fingerprintsDir: fingerprintsDir,
-		useEmbedded:     useEmbedded,
+		fsys: fsys,
+		dir:  dir,
 	}
 }
 
-// LoadAll loads all fingerprints from either embedded FS or external directory
+// FingerprintFilter selects the fingerprints a Loader keeps
+type FingerprintFilter func(name string, fp *Fingerprint) bool
+
+// InCategories keeps fingerprints belonging to at least one of the categories, for any
+// version (see Fingerprint.VersionRules)
+func InCategories(cats ...int) FingerprintFilter {
+	wanted := make(map[int]bool, len(cats))
+	for _, cat := range cats {
+		wanted[cat] = true
+	}
+	return func(name string, fp *Fingerprint) bool {
+		for _, cat := range fp.Cats {
+			if wanted[cat] {
+				return true
+			}
+		}
+		for _, rule := range fp.VersionRules {
+			for _, cat := range rule.Cats {
+				if wanted[cat] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// LoadAll loads all fingerprints
 func (l *Loader) LoadAll() (map[string]Fingerprint, error) {
+	return l.LoadFiltered(nil)
+}
+
+// LoadFiltered loads only the fingerprints accepted by filter (all if nil). Files are
+// decoded one at a time and rejected fingerprints dropped right away, so memory use is
+// bounded by the kept subset plus the largest file. The database info still covers
+// every file.
+func (l *Loader) LoadFiltered(filter FingerprintFilter) (map[string]Fingerprint, error) {
 	allFingerprints := make(map[string]Fingerprint)
+	origins := make(map[string]string) // tech name -> file that defined it
+	l.duplicates = nil
+	hasher := sha256.New()
+	info := DatabaseInfo{}
+	var newest time.Time
+
+	files, err := fs.Glob(l.fsys, path.Join(l.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fingerprint files: %w", err)
+	}
+	sortFingerprintFiles(files)
 
-	if l.useEmbedded {
-		// Load from embedded filesystem
-		pattern := "data/fingerprints/*.json"
-		files, err := fs.Glob(embeddedFingerprints, pattern)
+	for _, file := range files {
+		db, data, err := l.loadFile(file)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list embedded fingerprint files: %w", err)
+			return nil, fmt.Errorf("failed to load %s: %w", file, err)
 		}
 
-		for _, file := range files {
-			fingerprints, err := l.loadEmbeddedFile(file)
-			if err != nil {
-				return nil, fmt.Errorf("failed to load embedded %s: %w", file, err)
-			}
+		// Merge fingerprints
+		l.merge(allFingerprints, db, filter, file, data, hasher, &info, &newest)
+		l.trackOrigins(origins, db, file)
+	}
 
-			// Merge fingerprints
-			for name, fp := range fingerprints {
-				allFingerprints[name] = fp
-			}
-		}
-	} else {
-		// Load from external directory
-		files, err := filepath.Glob(filepath.Join(l.fingerprintsDir, "*.json"))
-		if err != nil {
-			return nil, fmt.Errorf("failed to list fingerprint files: %w", err)
+	info.Hash = hex.EncodeToString(hasher.Sum(nil))
+	info.Fingerprints = len(allFingerprints) // loaded, i.e. after filtering
+	l.info = info
+
+	return allFingerprints, nil
+}
+
+// sortFingerprintFiles puts files in load order: by numeric file name prefix ("20-" before
+// "100-", no prefix counts as 0), then by name. Files loaded later override fingerprints of
+// the same name from earlier files.
+func sortFingerprintFiles(files []string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		pi, pj := filePrecedence(files[i]), filePrecedence(files[j])
+		if pi != pj {
+			return pi < pj
 		}
+		return path.Base(files[i]) < path.Base(files[j])
+	})
+}
 
-		for _, file := range files {
-			fingerprints, err := l.loadExternalFile(file)
-			if err != nil {
-				return nil, fmt.Errorf("failed to load %s: %w", file, err)
-			}
+// filePrecedence parses the numeric prefix of a fingerprint file name
+func filePrecedence(file string) int {
+	name := path.Base(file)
+	digits := 0
+	for digits < len(name) && name[digits] >= '0' && name[digits] <= '9' {
+		digits++
+	}
+	n, err := strconv.Atoi(name[:digits])
+	if err != nil {
+		return 0
+	}
+	return n
+}
 
-			// Merge fingerprints
-			for name, fp := range fingerprints {
-				allFingerprints[name] = fp
-			}
+// trackOrigins records which file defines each technology, noting duplicates
+func (l *Loader) trackOrigins(origins map[string]string, db *FingerprintDB, file string) {
+	names := make([]string, 0, len(db.Apps))
+	for name := range db.Apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if previous, exists := origins[name]; exists {
+			l.duplicates = append(l.duplicates, DuplicateDefinition{Name: name, File: file, Overridden: previous})
 		}
+		origins[name] = file
 	}
+}
 
-	return allFingerprints, nil
+// Duplicates lists the technologies defined by more than one file in the last load, in
+// load order. Overrides by a later file are intended when layering fingerprint sets, but
+// can also clobber a good definition by accident.
+func (l *Loader) Duplicates() []DuplicateDefinition {
+	return l.duplicates
 }
 
-// loadEmbeddedFile loads fingerprints from an embedded JSON file
-func (l *Loader) loadEmbeddedFile(path string) (map[string]Fingerprint, error) {
-	data, err := embeddedFingerprints.ReadFile(path)
-	if err != nil {
-		return nil, err
+// merge adds the fingerprints of one file and folds the file into the database metadata
+func (l *Loader) merge(all map[string]Fingerprint, db *FingerprintDB, filter FingerprintFilter, file string, data []byte, hasher hash.Hash, info *DatabaseInfo, newest *time.Time) {
+	for name, fp := range db.Apps {
+		if filter == nil || filter(name, &fp) {
+			all[name] = fp
+		} else {
+			// A rejected later definition still overrides an earlier accepted one
+			delete(all, name)
+		}
 	}
 
-	var db FingerprintDB
-	if err := json.Unmarshal(data, &db); err != nil {
-		return nil, err
+	hasher.Write(data)
+	info.Files++
+
+	if db.Version != "" {
+		if info.Versions == nil {
+			info.Versions = make(map[string]string)
+		}
+		info.Versions[path.Base(file)] = db.Version
+	}
+
+	if updated, ok := parseUpdated(db.Updated); ok && updated.After(*newest) {
+		*newest = updated
+		info.Updated = db.Updated
+	}
+}
+
+// parseUpdated parses an "updated" timestamp given as RFC 3339 or a plain date
+func parseUpdated(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
 	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
 
-	return db.Apps, nil
+// Info returns metadata about the database read by the last LoadAll call
+func (l *Loader) Info() DatabaseInfo {
+	return l.info
 }
 
-// loadExternalFile loads fingerprints from an external JSON file
-func (l *Loader) loadExternalFile(path string) (map[string]Fingerprint, error) {
-	data, err := os.ReadFile(path)
+// loadFile loads fingerprints from a JSON file
+func (l *Loader) loadFile(name string) (*FingerprintDB, []byte, error) {
+	data, err := fs.ReadFile(l.fsys, name)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var db FingerprintDB
 	if err := json.Unmarshal(data, &db); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return db.Apps, nil
+	return &db, data, nil
 }
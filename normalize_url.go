@@ -0,0 +1,57 @@
+package techdetect
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// NormalizeURL turns a scan input into an absolute http(s) URL. Inputs without a scheme,
+// such as a bare domain ("example.com"), a host and port ("example.com:8443", "[::1]:8080")
+// or a host followed by a path ("example.com/blog?p=1"), get the given scheme ("http" or
+// "https"); "//example.com" style inputs too. Inputs with a scheme are returned as-is
+// once they parse. An empty scheme leaves scheme-less inputs an error.
+func NormalizeURL(raw, scheme string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("empty URL")
+	}
+
+	if !hasScheme(raw) {
+		switch strings.ToLower(scheme) {
+		case "http", "https":
+		case "":
+			return "", fmt.Errorf("invalid URL %q: no scheme", raw)
+		default:
+			return "", fmt.Errorf("unsupported scheme %q", scheme)
+		}
+		raw = strings.ToLower(scheme) + "://" + strings.TrimPrefix(raw, "//")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q: no host", raw)
+	}
+	return raw, nil
+}
+
+// hasScheme checks if a URL starts with "scheme://", so a URL in the query or path of a
+// scheme-less input ("example.com/?next=http://x") doesn't count
+func hasScheme(raw string) bool {
+	scheme, _, ok := strings.Cut(raw, "://")
+	if !ok || scheme == "" {
+		return false
+	}
+	for i, c := range scheme {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
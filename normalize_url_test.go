@@ -0,0 +1,35 @@
+package techdetect
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		scheme  string
+		want    string
+		wantErr bool
+	}{
+		{"example.com", "https", "https://example.com", false},
+		{"  example.com:8443 ", "http", "http://example.com:8443", false},
+		{"[::1]:8080", "http", "http://[::1]:8080", false},
+		{"example.com/blog?p=1", "HTTPS", "https://example.com/blog?p=1", false},
+		{"//example.com/", "https", "https://example.com/", false},
+		{"example.com/?next=http://other.test/", "https", "https://example.com/?next=http://other.test/", false},
+		{"example.com/redirect/https://other.test", "http", "http://example.com/redirect/https://other.test", false},
+		{"http://example.com/", "https", "http://example.com/", false},
+		{"HTTPS://example.com", "", "HTTPS://example.com", false},
+		{"svn+ssh://example.com", "https", "svn+ssh://example.com", false},
+		{"example.com", "", "", true},
+		{"example.com", "ftp", "", true},
+		{"", "https", "", true},
+		{"http://", "https", "", true},
+		{"1http://example.com", "", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeURL(tt.raw, tt.scheme)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeURL(%q, %q) = %q, %v; want %q (error %v)", tt.raw, tt.scheme, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package techdetect
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// notifier reports technologies to Options.OnDetect as stages detect them, one call at
+// a time across concurrent scans. A nil notifier does nothing.
+type notifier struct {
+	mu       sync.Mutex
+	onDetect func(url string, tech Technology)
+
+	// classify sets the categories and tags of a reported copy, which stages only
+	// attach at the end; nil leaves them as they are
+	classify func(tech *Technology)
+}
+
+// newNotifier returns a notifier for the callback, or nil without one
+func newNotifier(onDetect func(url string, tech Technology)) *notifier {
+	if onDetect == nil {
+		return nil
+	}
+	return &notifier{onDetect: onDetect}
+}
+
+// notifyNew reports the technologies of results not yet in seen, by name, and adds them
+// to seen. The callback gets a copy, so later stages can keep merging into results.
+func (n *notifier) notifyNew(url string, results map[string]*Technology, seen map[string]bool) {
+	if n == nil {
+		return
+	}
+
+	var names []string
+	for name := range results {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, name := range names {
+		tech := *results[name]
+		tech.Versions = slices.Clone(tech.Versions)
+		tech.Tags = slices.Clone(tech.Tags)
+		tech.Cats = slices.Clone(tech.Cats)
+		tech.Metadata = maps.Clone(tech.Metadata)
+		if n.classify != nil {
+			n.classify(&tech)
+		}
+		n.onDetect(url, tech)
+	}
+}
+
+// seenNames returns the set of technology names already in results
+func seenNames(results map[string]*Technology) map[string]bool {
+	seen := make(map[string]bool, len(results))
+	for name := range results {
+		seen[name] = true
+	}
+	return seen
+}
@@ -0,0 +1,65 @@
+package techdetect
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SelectTechnologies returns the fingerprints needed to detect the named technologies
+// (case-insensitive): their own, plus those of every technology their probes require,
+// transitively. Unknown names are an error.
+func SelectTechnologies(fingerprints map[string]Fingerprint, names []string) (map[string]Fingerprint, error) {
+	byLower := make(map[string]string, len(fingerprints))
+	for name := range fingerprints {
+		byLower[strings.ToLower(name)] = name
+	}
+
+	selected := make(map[string]Fingerprint)
+	var add func(name string)
+	add = func(name string) {
+		if _, done := selected[name]; done {
+			return
+		}
+		fp, exists := fingerprints[name]
+		if !exists {
+			// A requirement outside the set can never be met; its probes just won't run
+			return
+		}
+		selected[name] = fp
+		for _, probe := range fp.Paths {
+			for _, required := range probe.Requires {
+				add(required)
+			}
+		}
+	}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		canonical, ok := byLower[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown technology %q", name)
+		}
+		add(canonical)
+	}
+	return selected, nil
+}
+
+// DetectOnly runs the HTTP probes of the named technologies only (and of the ones they
+// require), answering "is this WordPress?" with a fraction of the requests of a full scan.
+// Implied technologies are still reported.
+func (d *Detector) DetectOnly(url string, techs []string) (*DetectResult, error) {
+	return d.DetectOnlyContext(context.Background(), url, techs)
+}
+
+// DetectOnlyContext is DetectOnly honoring cancellation of ctx
+func (d *Detector) DetectOnlyContext(ctx context.Context, url string, techs []string) (*DetectResult, error) {
+	selected, err := SelectTechnologies(d.fingerprints, techs)
+	if err != nil {
+		return nil, err
+	}
+	return d.detect(ctx, url, false, d.httpDetector.classify(selected))
+}
@@ -0,0 +1,202 @@
+package techdetect
+
+import (
+	"net/http"
+	"time"
+)
+
+// Options configures the detector and its HTTP/browser stages
+type Options struct {
+	// HTTPClient sends all HTTP stage requests when set, e.g. an instrumented client
+	// or one pointed at a test server. InsecureSkipVerify, InsecureHosts and the proxy
+	// settings are then left to the client's transport. The detector works on a copy
+	// whose CheckRedirect is replaced, because redirects are followed manually.
+	HTTPClient *http.Client
+
+	// InsecureSkipVerify disables TLS certificate verification for every host
+	InsecureSkipVerify bool
+
+	// TLSFallback verifies certificates but, when verification fails, retries the request
+	// once without verification and flags the result as TLS-invalid. Has no effect with
+	// InsecureSkipVerify or a custom HTTPClient.
+	TLSFallback bool
+
+	// InsecureHosts disables TLS certificate verification only for these hosts
+	// ("*.internal.example.com" matches subdomains); all other hosts are verified.
+	// Applies to the HTTP stage only.
+	InsecureHosts []string
+
+	// ProxyURL routes requests through an HTTP(S) or SOCKS5 proxy
+	ProxyURL string
+
+	// ProxyURLs rotates requests over several proxies, overriding ProxyURL. Each
+	// request, including every redirect hop, picks the next proxy per ProxyRotation.
+	// The browser stage uses the first proxy for the whole session.
+	ProxyURLs []string
+
+	// ProxyRotation is ProxyRotationRoundRobin (default) or ProxyRotationRandom; any other
+	// value fails detector creation
+	ProxyRotation string
+
+	// ResponseHeaderTimeout fails a request whose response headers don't arrive within
+	// this time after the request was sent (0 = only the request timeout applies).
+	// Left to the client's transport with a custom HTTPClient.
+	ResponseHeaderTimeout time.Duration
+
+	// BodyIdleTimeout fails a request whose body stops arriving for this long, so servers
+	// dripping a response fail fast instead of holding a worker until the request
+	// timeout (0 = only the request timeout applies)
+	BodyIdleTimeout time.Duration
+
+	// HostPolicy restricts the hosts and addresses scans may contact, e.g. to keep a
+	// service scanning user-supplied URLs away from internal and cloud metadata
+	// endpoints (nil = unrestricted). See NewHostPolicy. The browser stage checks each
+	// request too, but can't pin the checked addresses like the HTTP stage does.
+	HostPolicy *HostPolicy
+
+	// Cookies are sent with HTTP requests to CookieDomains, e.g. a session cookie to
+	// detect what only logged-in users see or to get past a cookie wall. A probe's
+	// request.cookies replace them by name. The browser stage doesn't send them.
+	Cookies map[string]string
+
+	// CookieDomains are the hosts Cookies are sent to, each with its subdomains (e.g.
+	// "example.com" covers "app.example.com"). When empty, Cookies go to the host of the
+	// scanned URL and its subdomains, so a batch of targets gets them all; templated
+	// probes of other hosts never do.
+	CookieDomains []string
+
+	// CookieJar, when set, supplies cookies to every HTTP request and stores the ones
+	// responses set, so a session persists across probes and scans (e.g. a
+	// net/http/cookiejar prepared by logging in). Cookies set along one redirect chain
+	// are always sent on its later hops, with or without a jar.
+	CookieJar http.CookieJar
+
+	// MaxPerHost caps simultaneous HTTP requests to any single host (0 = unlimited).
+	// The cap is shared by all concurrent Detect calls on the same detector.
+	MaxPerHost int
+
+	// CombineRedirectBodies matches against the bodies of every hop in a same-domain
+	// redirect chain joined together, instead of only the final response body.
+	CombineRedirectBodies bool
+
+	// RedirectBodySeparator joins combined redirect bodies (default "\n")
+	RedirectBodySeparator string
+
+	// MaxCombinedBodySize caps the combined body in bytes (default DefaultMaxCombinedBodySize)
+	MaxCombinedBodySize int
+
+	// StreamBody reads the bodies of paths whose probes only run regexes ($regex, $count,
+	// extract_version) against the body, or test it with $exists, in chunks, keeping just
+	// the matched regions, so huge pages are never held in memory whole. Paths needing the
+	// full body (other body operators, regexes with anchors or word boundaries, json,
+	// link, extensions, transforms, scripts) read it as usual. Matches longer than 8 KiB
+	// may be cut at chunk boundaries, and explanations and recordings see the matched
+	// regions instead of the body, without snippets. Each regex only sees its own matches,
+	// and $count the exact number of them.
+	StreamBody bool
+
+	// MaxScripts caps how many same-origin scripts are fetched for a page's "scripts"
+	// probes (default DefaultMaxScripts)
+	MaxScripts int
+
+	// AllowOffTargetTemplates lets templated probe paths (e.g. "https://status.vendor.com/{host}")
+	// request hosts other than the target and its subdomains. Without it such paths are
+	// skipped and listed in the failed paths.
+	AllowOffTargetTemplates bool
+
+	// RequestCache reuses responses of identical requests (same method, URL, headers and
+	// body), e.g. shared redirect targets or vendor endpoints across a batch. Create one
+	// with NewRequestCache per batch run; it may be shared by several detectors, which only
+	// share the responses of requests their settings (TLS, proxies, redirect bodies) make
+	// alike. Each detector's HostPolicy is checked before the cache is consulted.
+	RequestCache *RequestCache
+
+	// Categories loads only fingerprints in these category IDs, keeping memory low and
+	// scans short when only some kinds of technology matter. Probes requiring a
+	// technology outside the categories never run.
+	Categories []int
+
+	// Only probes just these technologies (case-insensitive names) and the ones their
+	// probes require, for targeted scans; implied technologies are still reported. It
+	// combines with Categories, and naming a technology not loaded is an error.
+	Only []string
+
+	// FirstMatchOnly stops evaluating a technology's probes on a path once one matches.
+	// By default every probe is evaluated and their versions merged, so a versionless
+	// match listed first does not hide a version found by a later probe.
+	FirstMatchOnly bool
+
+	// OnDetect is called with the scanned URL and a copy of each technology when a stage
+	// first detects it (per path in the HTTP and browser stages, then for implied ones),
+	// for progressive display. Calls never overlap, even across concurrent scans; versions
+	// found later only appear in the final result. Offline scans report once at the end.
+	OnDetect func(url string, tech Technology)
+
+	// Explain records the conditions behind each detection in Report.Explain
+	Explain bool
+
+	// SnippetLength, with Explain, adds about this many characters of the matched field
+	// around each match to Match.Snippet (e.g. 120), to check a detection by eye
+	SnippetLength int
+
+	// IncludeHeaders keeps the response headers detection ran against in Report.Headers
+	IncludeHeaders bool
+
+	// IncludeTransaction keeps every request of the HTTP stage, redirect hops included,
+	// with its status and response headers in Report.Transaction
+	IncludeTransaction bool
+
+	// AllowSensitive runs probes marked "sensitive" by their fingerprint, such as admin
+	// API endpoints. By default they are skipped, and so is their path when no other
+	// probe needs it.
+	AllowSensitive bool
+
+	// ExtraPaths are fetched besides the fingerprints' own paths, and the probes of the
+	// target page ("/") are evaluated against them too, so page markers are also found
+	// on, e.g., /wp-login.php (see CommonExtraPaths). Paths some fingerprint already
+	// probes are fetched once; at most MaxExtraPaths are used.
+	ExtraPaths []string
+
+	// ReadOnly guarantees the HTTP stage only sends GET and HEAD requests: probes whose
+	// request method is anything else are skipped (see Detector.SkippedProbes), and
+	// requests with other methods are refused. Redirects never turn a request into a
+	// write, since they only repeat the method or downgrade to GET. The browser stage is not
+	// covered: pages send requests of their own, so don't combine it with ReadOnly.
+	ReadOnly bool
+
+	// StrictFingerprints fails detector creation when a technology is defined by more
+	// than one fingerprint file, instead of letting the later file override it
+	StrictFingerprints bool
+
+	// BrowserRequiredOnly limits the browser stage to the probes of browser-required
+	// technologies (see Fingerprint.NeedsBrowser), leaving the rest to the HTTP stage
+	BrowserRequiredOnly bool
+
+	// VersionPolicy decides which version wins when the HTTP and browser stages find
+	// different ones: VersionPreferHTTP (default), VersionPreferBrowser, whose live
+	// runtime value beats stale headers, or VersionPreferSpecific. With the latter two,
+	// Versions lists both.
+	VersionPolicy string
+
+	// BrowserProfile selects the Chrome flags of the browser stage: BrowserProfileDefault
+	// (also when empty), BrowserProfileMinimal to leave Chrome's automation flag visible
+	// too, or BrowserProfilePermissive to also disable web security (CORS, mixed content)
+	BrowserProfile string
+
+	// BrowserFlags are extra Chrome command-line flags, applied after the profile so they
+	// can override it, e.g. "--lang=de", "--window-size=1280,800" or
+	// "--remote-debugging-port=9222"
+	BrowserFlags []string
+
+	// BrowserHeadful shows the browser window instead of running headless, for debugging
+	BrowserHeadful bool
+
+	// PerURLDeadline caps the wall-clock time of one Detect/Analyze call, HTTP and browser
+	// stages included (0 = no cap). Past it, outstanding requests are cancelled and the
+	// technologies found so far are returned together with ErrURLDeadline.
+	PerURLDeadline time.Duration
+
+	// HitStats counts, across every scan of the detector, how often each technology is
+	// detected and by which stage, for Detector.HitStats
+	HitStats bool
+}
@@ -0,0 +1,199 @@
+package techdetect
+
+import (
+	"encoding/json"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// Placeholders supported in PathProbe.Path and request bodies
+const (
+	placeholderScheme = "{scheme}"
+	placeholderHost   = "{host}"
+	placeholderPort   = "{port}"
+)
+
+// placeholderURL is the target URL, supported in request bodies only
+const placeholderURL = "{url}"
+
+// isTemplatedPath checks if a probe path contains host placeholders
+func isTemplatedPath(path string) bool {
+	return strings.Contains(path, placeholderScheme) ||
+		strings.Contains(path, placeholderHost) ||
+		strings.Contains(path, placeholderPort)
+}
+
+// expandPathTemplate substitutes {scheme}, {host} and {port} with values from the base URL
+func expandPathTemplate(path string, base *url.URL) string {
+	return strings.NewReplacer(
+		placeholderScheme, base.Scheme,
+		placeholderHost, base.Hostname(),
+		placeholderPort, defaultPort(base),
+	).Replace(path)
+}
+
+// defaultPort returns the port of a URL, or the default port of its scheme
+func defaultPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// withBodyTemplate returns the request config with {scheme}, {host}, {port} and {url} in
+// its body substituted from the target URL, or rc itself when there is nothing to
+// substitute. In a JSON body only string values are substituted, before encoding, and a
+// string body gets the values escaped for its Content-Type (see bodyEscaper), so a target
+// URL can't change the structure of the payload. rc is never modified, since concurrent
+// scans share it.
+func (rc *RequestConfig) withBodyTemplate(base *url.URL) *RequestConfig {
+	if rc == nil || rc.Body == nil || base == nil {
+		return rc
+	}
+
+	escape := func(value string) string { return value }
+	if _, isString := rc.Body.(string); isString {
+		var ok bool
+		if escape, ok = bodyEscaper(rc.contentType()); !ok {
+			return rc
+		}
+	}
+	target := *base
+	target.Fragment = ""
+	replacer := strings.NewReplacer(
+		placeholderScheme, escape(base.Scheme),
+		placeholderHost, escape(base.Hostname()),
+		placeholderPort, escape(defaultPort(base)),
+		placeholderURL, escape(target.String()),
+	)
+
+	changed := false
+	var expand func(value interface{}) interface{}
+	expand = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			if expanded := replacer.Replace(v); expanded != v {
+				changed = true
+				return expanded
+			}
+			return v
+		case map[string]interface{}:
+			copied := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				copied[key] = expand(item)
+			}
+			return copied
+		case []interface{}:
+			copied := make([]interface{}, len(v))
+			for i, item := range v {
+				copied[i] = expand(item)
+			}
+			return copied
+		}
+		return value
+	}
+
+	body := expand(rc.Body)
+	if !changed {
+		return rc
+	}
+	expanded := *rc
+	expanded.Body = body
+	return &expanded
+}
+
+// bodyEscaper returns how values substituted into a string body of a media type are
+// escaped: form bodies are URL-encoded, JSON bodies get JSON string escapes, XML and HTML
+// bodies entities, and plain text nothing. Other types have no known syntax to escape
+// for, so their placeholders are left alone (ok=false).
+func bodyEscaper(contentType string) (escape func(string) string, ok bool) {
+	switch mediaType := normalizeContentType(contentType); {
+	case mediaType == "application/x-www-form-urlencoded":
+		return url.QueryEscape, true
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return func(value string) string {
+			quoted, _ := json.Marshal(value)
+			return string(quoted[1 : len(quoted)-1])
+		}, true
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "text/html":
+		return html.EscapeString, true
+	case mediaType == "text/plain":
+		return func(value string) string { return value }, true
+	}
+	return nil, false
+}
+
+// isOnTarget checks if host is the target host or one of its subdomains
+func isOnTarget(host, targetHost string) bool {
+	host = strings.ToLower(host)
+	targetHost = strings.ToLower(targetHost)
+	return host == targetHost || strings.HasSuffix(host, "."+targetHost)
+}
+
+// probeURL builds the URL requested for a probe path. Templated paths that expand to an
+// absolute URL are used as-is; they are rejected (ok=false) when they point off-target
+// and allowOffTarget is not set. So are "//host/..." paths, which name a host of their own.
+func probeURL(baseURL, path string, allowOffTarget bool) (string, bool) {
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Host == "" {
+		if isTemplatedPath(path) {
+			return "", false
+		}
+		// Let the request itself report the unusable URL
+		return strings.TrimSuffix(baseURL, "/") + path, true
+	}
+
+	if isTemplatedPath(path) {
+		path = expandPathTemplate(path, base)
+	}
+	if !hasScheme(path) {
+		joined := joinProbePath(base, path)
+		resolved, err := url.Parse(joined)
+		if err != nil || !allowOffTarget && !isOnTarget(resolved.Hostname(), base.Hostname()) {
+			return "", false
+		}
+		return joined, true
+	}
+
+	target, err := url.Parse(path)
+	if err != nil || target.Host == "" {
+		return "", false
+	}
+	if !allowOffTarget && !isOnTarget(target.Hostname(), base.Hostname()) {
+		return "", false
+	}
+	return path, true
+}
+
+// joinProbePath resolves a probe path against the target URL: "/" is the target page itself,
+// other paths starting with "/" are taken from the host root, and relative paths from the
+// target's directory (the target path is treated as a directory)
+func joinProbePath(base *url.URL, path string) string {
+	if path == "/" || path == "" {
+		target := *base
+		target.Fragment = ""
+		if target.Path == "" {
+			target.Path = "/"
+		}
+		return target.String()
+	}
+
+	dir := *base
+	dir.RawQuery = ""
+	dir.Fragment = ""
+	if !strings.HasSuffix(dir.Path, "/") {
+		dir.Path += "/"
+		dir.RawPath = ""
+	}
+
+	ref, err := url.Parse(path)
+	if err != nil {
+		return strings.TrimSuffix(dir.String(), "/") + "/" + strings.TrimPrefix(path, "/")
+	}
+	return dir.ResolveReference(ref).String()
+}
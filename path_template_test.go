@@ -0,0 +1,73 @@
+package techdetect
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestProbeURLJoin(t *testing.T) {
+	tests := []struct {
+		base string
+		path string
+		want string
+	}{
+		{"https://site.com", "/", "https://site.com/"},
+		{"https://site.com", "readme.html", "https://site.com/readme.html"},
+		{"https://site.com/", "/wp-login.php", "https://site.com/wp-login.php"},
+		{"https://site.com/app/", "/", "https://site.com/app/"},
+		{"https://site.com/app/", "/wp-login.php", "https://site.com/wp-login.php"},
+		{"https://site.com/app/", "readme.html", "https://site.com/app/readme.html"},
+		{"https://site.com/app", "readme.html", "https://site.com/app/readme.html"},
+		{"https://site.com/app", "/", "https://site.com/app"},
+		{"https://site.com/app/", "static/js/main.js", "https://site.com/app/static/js/main.js"},
+		{"https://site.com/app/", "../api/health", "https://site.com/api/health"},
+		{"https://site.com/app/?lang=en", "readme.html", "https://site.com/app/readme.html"},
+		{"https://site.com/app/?lang=en#top", "/", "https://site.com/app/?lang=en"},
+		{"https://site.com/app/", "api?format=json", "https://site.com/app/api?format=json"},
+		{"https://site.com/", "/login?next=https://evil.test/", "https://site.com/login?next=https://evil.test/"},
+		// Protocol-relative paths name their own host, which must be on target
+		{"https://site.com/app/", "//evil.example/x", ""},
+		{"https://site.com/app/", "//{host}.attacker.net/x", ""},
+		{"https://site.com/app/", "//cdn.site.com/x", "https://cdn.site.com/x"},
+	}
+
+	for _, tt := range tests {
+		got, ok := probeURL(tt.base, tt.path, false)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("probeURL(%q, %q) = %q, %v; want %q", tt.base, tt.path, got, ok, tt.want)
+		}
+	}
+}
+
+func TestWithBodyTemplateEscapes(t *testing.T) {
+	base, err := url.Parse(`http://target.test:8080/app/?q="<x>"&y=1#top`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		contentType string // "" for the default
+		body        interface{}
+		want        interface{}
+	}{
+		{"", "site={host} port={port} page={url}", `site=target.test port=8080 page=http://target.test:8080/app/?q="<x>"&y=1`},
+		{"application/x-www-form-urlencoded", "site={host}&page={url}", "site=target.test&page=http%3A%2F%2Ftarget.test%3A8080%2Fapp%2F%3Fq%3D%22%3Cx%3E%22%26y%3D1"},
+		{"application/json; charset=utf-8", `{"page": "{url}"}`, `{"page": "http://target.test:8080/app/?q=\"\u003cx\u003e\"\u0026y=1"}`},
+		{"text/xml", "<site page='{url}'/>", "<site page='http://target.test:8080/app/?q=&#34;&lt;x&gt;&#34;&amp;y=1'/>"},
+		// No known syntax, so nothing is substituted
+		{"application/graphql", `{ site(url: "{url}") { id } }`, `{ site(url: "{url}") { id } }`},
+		// Structured bodies are encoded after substitution
+		{"", map[string]interface{}{"page": "{url}", "ports": []interface{}{"{port}", 443.0}},
+			map[string]interface{}{"page": `http://target.test:8080/app/?q="<x>"&y=1`, "ports": []interface{}{"8080", 443.0}}},
+	}
+
+	for _, tt := range tests {
+		rc := &RequestConfig{Method: "POST", Body: tt.body}
+		if tt.contentType != "" {
+			rc.Headers = map[string]string{"content-type": tt.contentType}
+		}
+		if got := rc.withBodyTemplate(base).Body; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q body %v = %v, want %v", tt.contentType, tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package techdetect
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// Proxy rotation strategies for Options.ProxyRotation
+const (
+	ProxyRotationRoundRobin = "round-robin"
+	ProxyRotationRandom     = "random"
+)
+
+// ValidateProxyURL checks that a proxy URL has a supported scheme (http, https or
+// socks5) and a host, since an unusable proxy would otherwise be skipped silently
+func ValidateProxyURL(proxyURL string) error {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL %q: %w", proxyURL, err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q in %q (use http, https or socks5)", parsed.Scheme, proxyURL)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("proxy URL %q has no host", proxyURL)
+	}
+	return nil
+}
+
+// checkProxyRotation rejects an unknown Options.ProxyRotation instead of silently
+// rotating round-robin
+func checkProxyRotation(strategy string) error {
+	switch strategy {
+	case "", ProxyRotationRoundRobin, ProxyRotationRandom:
+		return nil
+	}
+	return fmt.Errorf("unknown proxy rotation %q (use %s or %s)", strategy, ProxyRotationRoundRobin, ProxyRotationRandom)
+}
+
+// proxyRotator sends each request through the next proxy's transport
+type proxyRotator struct {
+	transports []http.RoundTripper
+	random     bool
+	next       uint32
+}
+
+// newProxyRotator builds one transport per proxy with the given constructor
+func newProxyRotator(proxyURLs []string, strategy string, transportFor func(proxyURL string) http.RoundTripper) *proxyRotator {
+	rotator := &proxyRotator{
+		transports: make([]http.RoundTripper, 0, len(proxyURLs)),
+		random:     strategy == ProxyRotationRandom,
+	}
+	for _, proxyURL := range proxyURLs {
+		rotator.transports = append(rotator.transports, transportFor(proxyURL))
+	}
+	return rotator
+}
+
+// RoundTrip picks a proxy for this request and forwards it
+func (r *proxyRotator) RoundTrip(req *http.Request) (*http.Response, error) {
+	var i int
+	if r.random {
+		i = rand.Intn(len(r.transports))
+	} else {
+		i = int((atomic.AddUint32(&r.next, 1) - 1) % uint32(len(r.transports)))
+	}
+	return r.transports[i].RoundTrip(req)
+}
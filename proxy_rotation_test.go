@@ -0,0 +1,18 @@
+package techdetect
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestProxyRotationStrategy(t *testing.T) {
+	loader := NewLoaderFromFS(fstest.MapFS{"fp.json": {Data: []byte(`{"apps": {}}`)}}, ".")
+	for _, strategy := range []string{"", ProxyRotationRoundRobin, ProxyRotationRandom} {
+		if _, err := NewDetectorWithLoader(loader, Options{ProxyRotation: strategy}); err != nil {
+			t.Errorf("ProxyRotation %q: %v", strategy, err)
+		}
+	}
+	if _, err := NewDetectorWithLoader(loader, Options{ProxyRotation: "roundrobin"}); err == nil {
+		t.Error("unknown ProxyRotation accepted")
+	}
+}
@@ -1,41 +1,88 @@
 package techdetect
 
 import (
+	"net/url"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode"
 )
 
-// QueryEvaluator evaluates MongoDB-style queries against a context
-type QueryEvaluator struct{}
+// QueryEvaluator evaluates MongoDB-style queries against a context.
+// It is part of the public API and can be used standalone with NewDetectionContext.
+// An evaluator is safe for concurrent use and is meant to be shared: it caches every
+// regex it compiles, keyed by pattern, for its lifetime.
+type QueryEvaluator struct {
+	regexes sync.Map // pattern -> compiledRegex
+}
+
+// compiledRegex is a cached compilation result, failures included
+type compiledRegex struct {
+	re  *regexp.Regexp
+	err error
+}
+
+// compile returns the compiled regex for a pattern, compiling it on first use
+func (qe *QueryEvaluator) compile(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := qe.regexes.Load(pattern); ok {
+		c := cached.(compiledRegex)
+		return c.re, c.err
+	}
+	re, err := regexp.Compile(pattern)
+	qe.regexes.Store(pattern, compiledRegex{re: re, err: err})
+	return re, err
+}
 
 // NewQueryEvaluator creates a new query evaluator
 func NewQueryEvaluator() *QueryEvaluator {
 	return &QueryEvaluator{}
 }
 
-// Evaluate evaluates a query against the detection context
+// Evaluate evaluates a query against the detection context.
+// It returns whether the query matched and the version extracted by any
+// \;version: regex, or an empty string.
 func (qe *QueryEvaluator) Evaluate(query map[string]interface{}, ctx *DetectionContext) (bool, string) {
 	return qe.evaluateQuery(query, ctx)
 }
 
-// evaluateQuery recursively evaluates query conditions
+// evaluateQuery recursively evaluates query conditions. Multiple keys in one
+// query object must all match, as in MongoDB. As everywhere in a query, the version
+// comes from the first condition that extracted one, with keys taken in sorted order.
 func (qe *QueryEvaluator) evaluateQuery(query map[string]interface{}, ctx *DetectionContext) (bool, string) {
-	for key, value := range query {
+	if len(query) == 0 {
+		return false, ""
+	}
+
+	version := ""
+	for _, key := range sortedKeys(query) {
+		value := query[key]
+		var match bool
+		var v string
 		switch key {
 		case "$or":
-			return qe.evaluateOr(value, ctx)
+			match, v = qe.evaluateOr(value, ctx)
 		case "$and":
-			return qe.evaluateAnd(value, ctx)
+			match, v = qe.evaluateAnd(value, ctx)
 		case "$not":
-			return qe.evaluateNot(value, ctx)
+			match, v = qe.evaluateNot(value, ctx)
 		case "$nor":
-			return qe.evaluateNor(value, ctx)
+			match, v = qe.evaluateNor(value, ctx)
+		case "headers":
+			match, v = qe.evaluateHeaders(value, ctx)
 		default:
 			// Field-level query
-			return qe.evaluateField(key, value, ctx)
+			match, v = qe.evaluateField(key, value, ctx)
+		}
+		if !match {
+			return false, ""
+		}
+		if version == "" {
+			version = v
 		}
 	}
-	return false, ""
+	return true, version
 }
 
 // evaluateOr evaluates $or operator (match ANY)
@@ -74,7 +121,7 @@ func (qe *QueryEvaluator) evaluateAnd(value interface{}, ctx *DetectionContext)
 		if !match {
 			return false, ""
 		}
-		if v != "" {
+		if version == "" {
 			version = v
 		}
 	}
@@ -110,46 +157,301 @@ func (qe *QueryEvaluator) evaluateNor(value interface{}, ctx *DetectionContext)
 	return true, ""
 }
 
-// evaluateField evaluates a field-level condition
-func (qe *QueryEvaluator) evaluateField(fieldPath string, condition interface{}, ctx *DetectionContext) (bool, string) {
-	// Get field value from context
-	fieldValue := qe.getFieldValue(fieldPath, ctx)
-	if fieldValue == "" {
+// evaluateHeaders evaluates the object form {"headers": {"Server": {...}, "X-Powered-By": {...}}}
+// where every named header condition must match
+func (qe *QueryEvaluator) evaluateHeaders(value interface{}, ctx *DetectionContext) (bool, string) {
+	headers, ok := value.(map[string]interface{})
+	if !ok || len(headers) == 0 {
 		return false, ""
 	}
 
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	version := ""
+	for _, name := range names {
+		match, v := qe.evaluateField("headers."+name, headers[name], ctx)
+		if !match {
+			return false, ""
+		}
+		if version == "" {
+			version = v
+		}
+	}
+	return true, version
+}
+
+// evaluateField evaluates a field-level condition. Every operator in the
+// condition must match; the version comes from the first operator (in sorted
+// order) that extracted one. On "any", the first field satisfying the whole
+// condition decides.
+func (qe *QueryEvaluator) evaluateField(fieldPath string, condition interface{}, ctx *DetectionContext) (bool, string) {
+	if transforms, ok := isAnyField(fieldPath, ctx); ok {
+		match, version, _ := qe.evaluateAny(transforms, condition, ctx)
+		return match, version
+	}
+
+	// Get field value from context
+	rawValue, _ := qe.resolveField(fieldPath, ctx)
+	fieldValue := stringifyValue(rawValue)
+
 	// Evaluate condition
 	condMap, ok := condition.(map[string]interface{})
 	if !ok {
 		return false, ""
 	}
 
-	for operator, operand := range condMap {
+	// Missing (or empty) fields only satisfy absence-style operators. The body is present
+	// when the response had one, even if a streamed digest kept none of it.
+	present := fieldValue != ""
+	if streamed := ctx.streamedBody(fieldPath); streamed != nil {
+		present = streamed.size > 0
+	}
+	if !present {
+		return qe.evaluateMissing(condMap)
+	}
+
+	operators := make([]string, 0, len(condMap))
+	for operator := range condMap {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	// {"$options": "i"} compares $eq, $ne, $in, $nin and $all case-insensitively,
+	// ignoring surrounding whitespace
+	options, _ := condMap["$options"].(string)
+	fold := strings.Contains(options, "i")
+	foldedValue, foldedRaw := fieldValue, rawValue
+	if fold {
+		foldedValue = foldCase(fieldValue).(string)
+		foldedRaw = foldCase(rawValue)
+	}
+
+	recognized := false
+	version := ""
+	for _, operator := range operators {
+		operand := condMap[operator]
+		compared := operand // operand of the equality operators, folded with $options "i"
+		if fold {
+			compared = foldCase(operand)
+		}
+
+		var match bool
+		var v string
 		switch operator {
+		case "$not":
+			match, v = qe.evaluateFieldNot(fieldPath, operand, ctx)
 		case "$regex":
-			return qe.evaluateRegex(fieldValue, operand)
+			pattern, _ := operand.(string)
+			source := strings.Split(pattern, "\\;version:")[0]
+			match, v = qe.evaluateRegex(patternInput(fieldPath, fieldValue, source, ctx), operand)
 		case "$eq":
-			return qe.evaluateEquals(fieldValue, operand)
+			match, v = qe.evaluateEquals(foldedValue, compared)
 		case "$ne":
-			return qe.evaluateNotEquals(fieldValue, operand)
+			match, v = qe.evaluateNotEquals(foldedValue, compared)
 		case "$exists":
-			return qe.evaluateExists(fieldValue, operand)
+			match, v = qe.evaluateExists(present, operand)
 		case "$in":
-			return qe.evaluateIn(fieldValue, operand)
+			if elements, isArray := foldedRaw.([]interface{}); isArray {
+				match, v = qe.evaluateArrayIn(elements, compared)
+			} else {
+				match, v = qe.evaluateIn(foldedValue, compared)
+			}
 		case "$nin":
-			return qe.evaluateNotIn(fieldValue, operand)
+			if elements, isArray := foldedRaw.([]interface{}); isArray {
+				match, v = qe.evaluateArrayNotIn(elements, compared)
+			} else {
+				match, v = qe.evaluateNotIn(foldedValue, compared)
+			}
+		case "$elemMatch":
+			match, v = qe.evaluateElemMatch(rawValue, operand)
+		case "$all":
+			match, v = qe.evaluateAll(foldedRaw, compared)
+		case "$size":
+			match, v = qe.evaluateSize(rawValue, operand)
+		case "$contains_token":
+			match, v = qe.evaluateContainsToken(fieldValue, operand)
+		case "$count":
+			match, v = qe.evaluateCount(fieldValue, operand, ctx.streamedBody(fieldPath))
+		default:
+			// Unknown operators are ignored
+			continue
+		}
+
+		recognized = true
+		if !match {
+			return false, ""
+		}
+		if version == "" {
+			version = v
 		}
 	}
 
-	return false, ""
+	return recognized, version
+}
+
+// evaluateMissing evaluates a field condition for a field that is absent or empty:
+// {"$exists": false}, $ne and $nin match, everything else does not. All
+// recognized operators must match.
+func (qe *QueryEvaluator) evaluateMissing(condMap map[string]interface{}) (bool, string) {
+	recognized := false
+	for operator, operand := range condMap {
+		var match bool
+		switch operator {
+		case "$exists":
+			match, _ = qe.evaluateExists(false, operand)
+		case "$ne", "$nin":
+			match = true
+		case "$not":
+			subCond, ok := operand.(map[string]interface{})
+			if !ok {
+				return false, ""
+			}
+			subMatch, _ := qe.evaluateMissing(subCond)
+			match = !subMatch
+		case "$count":
+			// No occurrences, which {"$lt": 1} accepts
+			match, _ = qe.evaluateCount("", operand, nil)
+		case "$regex", "$eq", "$in", "$elemMatch", "$all", "$size", "$contains_token":
+			match = false
+		default:
+			continue
+		}
+
+		recognized = true
+		if !match {
+			return false, ""
+		}
+	}
+	return recognized, ""
+}
+
+// evaluateFieldNot evaluates field-level $not, e.g. {"headers.server": {"$not": {"$regex": "nginx"}}}
+func (qe *QueryEvaluator) evaluateFieldNot(fieldPath string, operand interface{}, ctx *DetectionContext) (bool, string) {
+	subCond, ok := operand.(map[string]interface{})
+	if !ok {
+		return false, ""
+	}
+	match, _ := qe.evaluateField(fieldPath, subCond, ctx)
+	return !match, ""
+}
+
+// patternInput returns what a pattern of a field condition or extraction rule is matched
+// against: the field value, or for a streamed body only the excerpts kept for the pattern
+func patternInput(fieldPath, fieldValue, pattern string, ctx *DetectionContext) string {
+	if streamed := ctx.streamedBody(fieldPath); streamed != nil {
+		return streamed.matches[pattern]
+	}
+	return fieldValue
 }
 
 // getFieldValue retrieves field value from context using dot notation
 func (qe *QueryEvaluator) getFieldValue(fieldPath string, ctx *DetectionContext) string {
+	value, _ := qe.resolveField(fieldPath, ctx)
+	return stringifyValue(value)
+}
+
+// resolveField retrieves the raw (possibly structured) field value from context, applying
+// the "|" transforms of the path in order (see applyTransform)
+func (qe *QueryEvaluator) resolveField(fieldPath string, ctx *DetectionContext) (interface{}, bool) {
+	fieldPath, transforms := splitTransforms(fieldPath)
+	value, ok := qe.resolvePlainField(fieldPath, ctx)
+	for _, transform := range transforms {
+		if !ok {
+			return nil, false
+		}
+		value, ok = applyTransform(transform, stringifyValue(value))
+	}
+	return value, ok
+}
+
+// resolvePlainField retrieves a field value without transforms
+func (qe *QueryEvaluator) resolvePlainField(fieldPath string, ctx *DetectionContext) (interface{}, bool) {
+	// Inside $elemMatch every path is relative to the array element
+	if ctx.inElement {
+		return lookupJSONPath(ctx.element, fieldPath)
+	}
+
 	parts := strings.Split(fieldPath, ".")
 
 	if parts[0] == "body" {
-		return ctx.Body
+		return ctx.Body, true
+	}
+
+	if fieldPath == AnyField {
+		return qe.anyHaystack(ctx)
+	}
+
+	if parts[0] == "contenttype" {
+		return ctx.ContentType, true
+	}
+
+	if parts[0] == "url" {
+		if ctx.URL == "" {
+			return nil, false
+		}
+		return ctx.URL, true
+	}
+
+	if parts[0] == "etld1" {
+		domain, ok := registrableDomain(ctx.URL)
+		if !ok {
+			return nil, false
+		}
+		return domain, true
+	}
+
+	if parts[0] == "cookies" && len(parts) > 1 {
+		value, ok := ctx.cookie(strings.Join(parts[1:], "."))
+		if !ok {
+			return nil, false
+		}
+		return value, true
+	}
+
+	if parts[0] == "extensions" {
+		exts := ctx.resourceExtensions()
+		if len(exts) == 0 {
+			return nil, false
+		}
+		return exts, true
+	}
+
+	if parts[0] == "link" {
+		return ctx.linkField(strings.Join(parts[1:], "."))
+	}
+
+	if parts[0] == "linkheader" {
+		return ctx.linkHeaderField(strings.Join(parts[1:], "."))
+	}
+
+	if parts[0] == "headernames" {
+		if len(ctx.Headers) == 0 {
+			return nil, false
+		}
+		return headerNames(ctx.Headers), true
+	}
+
+	if parts[0] == "altsvc" {
+		for k, v := range ctx.Headers {
+			if strings.EqualFold(k, "Alt-Svc") {
+				if protocols := altSvcProtocols(v); len(protocols) > 0 {
+					return protocols, true
+				}
+			}
+		}
+		return nil, false
+	}
+
+	if parts[0] == "status" {
+		if ctx.StatusCode == 0 {
+			// Not known, e.g. a context built from a body only
+			return nil, false
+		}
+		return strconv.Itoa(ctx.StatusCode), true
 	}
 
 	if parts[0] == "headers" && len(parts) > 1 {
@@ -157,13 +459,67 @@ func (qe *QueryEvaluator) getFieldValue(fieldPath string, ctx *DetectionContext)
 		// Case-insensitive header lookup
 		for k, v := range ctx.Headers {
 			if strings.EqualFold(k, headerName) {
-				return v
+				return v, true
 			}
 		}
-		return ""
+		return nil, false
 	}
 
-	return ""
+	if parts[0] == "json" {
+		doc, ok := ctx.parsedJSON()
+		if !ok {
+			return nil, false
+		}
+		return lookupJSONPath(doc, strings.Join(parts[1:], "."))
+	}
+
+	return nil, false
+}
+
+// evaluateElemMatch evaluates $elemMatch operator: true if any array element matches the sub-query
+func (qe *QueryEvaluator) evaluateElemMatch(value interface{}, operand interface{}) (bool, string) {
+	elements, ok := value.([]interface{})
+	if !ok {
+		return false, ""
+	}
+	subQuery, ok := operand.(map[string]interface{})
+	if !ok || len(subQuery) == 0 {
+		return false, ""
+	}
+
+	for _, elem := range elements {
+		elemCtx := &DetectionContext{element: elem, inElement: true}
+		if match, version := qe.evaluateElement(subQuery, elemCtx); match {
+			return true, version
+		}
+	}
+	return false, ""
+}
+
+// evaluateElement checks one array element against all conditions of an $elemMatch sub-query.
+// Operator keys ($regex, $eq, ...) apply to the element itself; other keys are field paths.
+func (qe *QueryEvaluator) evaluateElement(subQuery map[string]interface{}, elemCtx *DetectionContext) (bool, string) {
+	version := ""
+	for _, key := range sortedKeys(subQuery) {
+		cond := subQuery[key]
+		var match bool
+		var v string
+		switch {
+		case key == "$or" || key == "$and" || key == "$not" || key == "$nor":
+			match, v = qe.evaluateQuery(map[string]interface{}{key: cond}, elemCtx)
+		case strings.HasPrefix(key, "$"):
+			match, v = qe.evaluateField("", map[string]interface{}{key: cond}, elemCtx)
+		default:
+			match, v = qe.evaluateField(key, cond, elemCtx)
+		}
+		if !match {
+			return false, ""
+		}
+		if version == "" {
+			version = v
+		}
+	}
+	return true, version
 }
 
 // evaluateRegex evaluates $regex operator
@@ -177,7 +533,7 @@ func (qe *QueryEvaluator) evaluateRegex(fieldValue string, pattern interface{})
 	parts := strings.Split(patternStr, "\\;version:")
 	actualPattern := parts[0]
 
-	re, err := regexp.Compile(actualPattern)
+	re, err := qe.compile(actualPattern)
 	if err != nil {
 		return false, ""
 	}
@@ -200,32 +556,39 @@ func (qe *QueryEvaluator) evaluateRegex(fieldValue string, pattern interface{})
 
 // evaluateEquals evaluates $eq operator
 func (qe *QueryEvaluator) evaluateEquals(fieldValue string, operand interface{}) (bool, string) {
-	expectedValue, ok := operand.(string)
-	if !ok {
-		return false, ""
-	}
-	return fieldValue == expectedValue, ""
+	return fieldValue == stringifyValue(operand), ""
 }
 
 // evaluateNotEquals evaluates $ne operator
 func (qe *QueryEvaluator) evaluateNotEquals(fieldValue string, operand interface{}) (bool, string) {
-	expectedValue, ok := operand.(string)
-	if !ok {
-		return false, ""
-	}
-	return fieldValue != expectedValue, ""
+	return fieldValue != stringifyValue(operand), ""
 }
 
 // evaluateExists evaluates $exists operator
-func (qe *QueryEvaluator) evaluateExists(fieldValue string, operand interface{}) (bool, string) {
+func (qe *QueryEvaluator) evaluateExists(exists bool, operand interface{}) (bool, string) {
 	shouldExist, ok := operand.(bool)
 	if !ok {
 		return false, ""
 	}
-	exists := fieldValue != ""
 	return exists == shouldExist, ""
 }
 
+// foldCase lowercases and trims a string, or the strings of an array, for $options "i"
+func foldCase(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.ToLower(strings.TrimSpace(v))
+	case []interface{}:
+		folded := make([]interface{}, len(v))
+		for i, item := range v {
+			folded[i] = foldCase(item)
+		}
+		return folded
+	default:
+		return value
+	}
+}
+
 // evaluateIn evaluates $in operator
 func (qe *QueryEvaluator) evaluateIn(fieldValue string, operand interface{}) (bool, string) {
 	values, ok := operand.([]interface{})
@@ -234,8 +597,7 @@ func (qe *QueryEvaluator) evaluateIn(fieldValue string, operand interface{}) (bo
 	}
 
 	for _, v := range values {
-		strValue, ok := v.(string)
-		if ok && fieldValue == strValue {
+		if fieldValue == stringifyValue(v) {
 			return true, ""
 		}
 	}
@@ -250,24 +612,343 @@ func (qe *QueryEvaluator) evaluateNotIn(fieldValue string, operand interface{})
 	}
 
 	for _, v := range values {
-		strValue, ok := v.(string)
-		if ok && fieldValue == strValue {
+		if fieldValue == stringifyValue(v) {
+			return false, ""
+		}
+	}
+	return true, ""
+}
+
+// evaluateArrayIn evaluates $in on an array field: true if any element is one of the values
+func (qe *QueryEvaluator) evaluateArrayIn(elements []interface{}, operand interface{}) (bool, string) {
+	for _, elem := range elements {
+		if match, _ := qe.evaluateIn(stringifyValue(elem), operand); match {
+			return true, ""
+		}
+	}
+	return false, ""
+}
+
+// evaluateArrayNotIn evaluates $nin on an array field: true if no element is one of the values
+func (qe *QueryEvaluator) evaluateArrayNotIn(elements []interface{}, operand interface{}) (bool, string) {
+	if _, ok := operand.([]interface{}); !ok {
+		return false, ""
+	}
+	match, _ := qe.evaluateArrayIn(elements, operand)
+	return !match, ""
+}
+
+// evaluateAll evaluates $all on an array field: true if every value is one of the elements
+func (qe *QueryEvaluator) evaluateAll(fieldValue interface{}, operand interface{}) (bool, string) {
+	elements, ok := fieldValue.([]interface{})
+	if !ok {
+		return false, ""
+	}
+	values, ok := operand.([]interface{})
+	if !ok {
+		return false, ""
+	}
+
+	for _, v := range values {
+		if match, _ := qe.evaluateArrayIn(elements, []interface{}{v}); !match {
 			return false, ""
 		}
 	}
 	return true, ""
 }
 
+// evaluateSize evaluates $size on an array field: true if it has exactly operand elements
+func (qe *QueryEvaluator) evaluateSize(fieldValue interface{}, operand interface{}) (bool, string) {
+	elements, ok := fieldValue.([]interface{})
+	if !ok {
+		return false, ""
+	}
+	size, ok := operand.(float64)
+	if !ok {
+		return false, ""
+	}
+	return float64(len(elements)) == size, ""
+}
+
+// evaluateCount evaluates $count: the number of non-overlapping matches of a regex,
+// compared with $eq, $gt, $gte, $lt and $lte, e.g. {"pattern": "adsbygoogle", "$gte": 3}.
+// All comparisons must hold, and at least one is required. A streamed body has the
+// number of matches counted while it was read.
+func (qe *QueryEvaluator) evaluateCount(fieldValue string, operand interface{}, streamed *streamedBody) (bool, string) {
+	spec, ok := operand.(map[string]interface{})
+	if !ok {
+		return false, ""
+	}
+	pattern, ok := spec["pattern"].(string)
+	if !ok || pattern == "" {
+		return false, ""
+	}
+	re, err := qe.compile(pattern)
+	if err != nil {
+		return false, ""
+	}
+	var count float64
+	if streamed != nil {
+		count = float64(streamed.counts[pattern])
+	} else {
+		count = float64(len(re.FindAllStringIndex(fieldValue, -1)))
+	}
+
+	compared := false
+	for operator, value := range spec {
+		if operator == "pattern" {
+			continue
+		}
+		n, ok := value.(float64)
+		if !ok {
+			return false, ""
+		}
+		var match bool
+		switch operator {
+		case "$eq":
+			match = count == n
+		case "$gt":
+			match = count > n
+		case "$gte":
+			match = count >= n
+		case "$lt":
+			match = count < n
+		case "$lte":
+			match = count <= n
+		default:
+			return false, ""
+		}
+		if !match {
+			return false, ""
+		}
+		compared = true
+	}
+	return compared, ""
+}
+
+// altSvcProtocols returns the lowercased protocol IDs an Alt-Svc header advertises
+// (h3, h3-29, h2, ...), in header order and without duplicates; "clear" yields none
+func altSvcProtocols(header string) []interface{} {
+	var protocols []interface{}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(header, ",") {
+		alternative, _, _ := strings.Cut(entry, ";")
+		id, _, ok := strings.Cut(strings.TrimSpace(alternative), "=")
+		if !ok {
+			// "clear" or malformed
+			continue
+		}
+		if unescaped, err := url.PathUnescape(id); err == nil {
+			id = unescaped
+		}
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id != "" && !seen[id] {
+			seen[id] = true
+			protocols = append(protocols, id)
+		}
+	}
+	return protocols
+}
+
+// headerNames returns the lowercased names of the response headers, sorted
+func headerNames(headers map[string]string) []interface{} {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = name
+	}
+	return values
+}
+
+// evaluateContainsToken evaluates $contains_token operator: the field is split into tokens on
+// commas and whitespace, and matches if any token equals the operand (or one of an array of
+// operands), case-insensitively
+func (qe *QueryEvaluator) evaluateContainsToken(fieldValue string, operand interface{}) (bool, string) {
+	var wanted []string
+	switch v := operand.(type) {
+	case string:
+		wanted = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				wanted = append(wanted, str)
+			}
+		}
+	default:
+		return false, ""
+	}
+
+	tokens := strings.FieldsFunc(fieldValue, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, token := range tokens {
+		for _, w := range wanted {
+			if strings.EqualFold(token, w) {
+				return true, ""
+			}
+		}
+	}
+	return false, ""
+}
+
+// ExtractVersions returns every distinct version captured by the extraction rules,
+// considering all matches of each pattern rather than only the first
+func (qe *QueryEvaluator) ExtractVersions(rules []map[string]string, ctx *DetectionContext) []string {
+	var versions []string
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		for field, pattern := range rule {
+			fieldValue := patternInput(field, qe.getFieldValue(field, ctx), pattern, ctx)
+			if fieldValue == "" {
+				continue
+			}
+
+			re, err := qe.compile(pattern)
+			if err != nil {
+				continue
+			}
+
+			for _, matches := range re.FindAllStringSubmatch(fieldValue, -1) {
+				if len(matches) > 1 && matches[1] != "" && !seen[matches[1]] {
+					seen[matches[1]] = true
+					versions = append(versions, matches[1])
+				}
+			}
+		}
+	}
+	return versions
+}
+
+// collectQueryVersions returns every distinct version captured by the \;version: regexes
+// of a matched query, using all matches of each pattern. Negated branches ($not, $nor)
+// and $or branches that did not match are skipped, and versions that are a prefix of
+// another one ("6" next to "6.4.1") are dropped.
+func (qe *QueryEvaluator) collectQueryVersions(query map[string]interface{}, ctx *DetectionContext) []string {
+	var versions []string
+	seen := make(map[string]bool)
+
+	var walk func(q map[string]interface{})
+	walk = func(q map[string]interface{}) {
+		for key, value := range q {
+			switch key {
+			case "$not", "$nor":
+				continue
+			case "$or", "$and":
+				conditions, _ := value.([]interface{})
+				for _, cond := range conditions {
+					condMap, ok := cond.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					// Every $and condition of a matched query holds, $or ones need checking
+					if key == "$or" {
+						if match, _ := qe.evaluateQuery(condMap, ctx); !match {
+							continue
+						}
+					}
+					walk(condMap)
+				}
+				continue
+			}
+
+			condMap, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			pattern, ok := condMap["$regex"].(string)
+			if !ok || !strings.Contains(pattern, "\\;version:") {
+				continue
+			}
+			source := strings.Split(pattern, "\\;version:")[0]
+			re, err := qe.compile(source)
+			if err != nil {
+				continue
+			}
+			fieldValue := patternInput(key, qe.getFieldValue(key, ctx), source, ctx)
+			for _, matches := range re.FindAllStringSubmatch(fieldValue, -1) {
+				if len(matches) > 1 && matches[1] != "" && !seen[matches[1]] {
+					seen[matches[1]] = true
+					versions = append(versions, matches[1])
+				}
+			}
+		}
+	}
+	walk(query)
+
+	return dropPrefixVersions(versions)
+}
+
+// dropPrefixVersions removes the versions that are a less specific form of another one
+// in the list: "6" and "6.4" go when "6.4.1" is there. The order is kept.
+func dropPrefixVersions(versions []string) []string {
+	kept := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if !hasMoreSpecificVersion(v, versions) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// hasMoreSpecificVersion checks if one of versions extends v by more components
+func hasMoreSpecificVersion(v string, versions []string) bool {
+	for _, other := range versions {
+		if strings.HasPrefix(other, v+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractVersionFrom extracts a version combining the rules per strategy (a VersionFrom* constant)
+func (qe *QueryEvaluator) ExtractVersionFrom(rules []map[string]string, strategy string, ctx *DetectionContext) string {
+	switch strategy {
+	case VersionFromLongest:
+		best := ""
+		for _, v := range qe.ExtractVersions(rules, ctx) {
+			if moreSpecificVersion(v, best) {
+				best = v
+			}
+		}
+		return best
+
+	case VersionFromJoin:
+		var parts []string
+		for _, rule := range rules {
+			if v := qe.ExtractVersion([]map[string]string{rule}, ctx); v != "" {
+				parts = append(parts, v)
+			}
+		}
+		return strings.Join(parts, ".")
+
+	default:
+		return qe.ExtractVersion(rules, ctx)
+	}
+}
+
+// moreSpecificVersion reports whether version a has more components than b, or is longer
+func moreSpecificVersion(a, b string) bool {
+	if ca, cb := strings.Count(a, "."), strings.Count(b, "."); ca != cb {
+		return ca > cb
+	}
+	return len(a) > len(b)
+}
+
 // ExtractVersion attempts to extract version from context using extraction rules
 func (qe *QueryEvaluator) ExtractVersion(rules []map[string]string, ctx *DetectionContext) string {
 	for _, rule := range rules {
 		for field, pattern := range rule {
-			fieldValue := qe.getFieldValue(field, ctx)
+			fieldValue := patternInput(field, qe.getFieldValue(field, ctx), pattern, ctx)
 			if fieldValue == "" {
 				continue
 			}
 
-			re, err := regexp.Compile(pattern)
+			re, err := qe.compile(pattern)
 			if err != nil {
 				continue
 			}
@@ -280,3 +961,18 @@ func (qe *QueryEvaluator) ExtractVersion(rules []map[string]string, ctx *Detecti
 	}
 	return ""
 }
+
+// ExtractFields extracts named values, each with the first capture of the first matching
+// of its rules (as ExtractVersion does). Names without a match are left out.
+func (qe *QueryEvaluator) ExtractFields(extract map[string][]map[string]string, ctx *DetectionContext) map[string]string {
+	if len(extract) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(extract))
+	for name, rules := range extract {
+		if value := qe.ExtractVersion(rules, ctx); value != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
@@ -0,0 +1,392 @@
+package techdetect
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// parseQuery decodes a query written as fingerprint JSON
+func parseQuery(t *testing.T, query string) map[string]interface{} {
+	t.Helper()
+	var q map[string]interface{}
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		t.Fatalf("invalid query %s: %v", query, err)
+	}
+	return q
+}
+
+func TestEvaluateStandalone(t *testing.T) {
+	ctx := NewDetectionContext(
+		`<html><meta name="generator" content="WordPress 6.4.1"></html>`,
+		map[string]string{"server": "nginx/1.25.3", "Content-Type": "text/html; charset=utf-8"},
+	)
+
+	tests := []struct {
+		name    string
+		query   string
+		match   bool
+		version string
+	}{
+		{"header regex with version", `{"headers.server": {"$regex": "nginx/([\\d.]+)\\;version:\\1"}}`, true, "1.25.3"},
+		{"header name is case-insensitive", `{"headers.Server": {"$exists": true}}`, true, ""},
+		{"body regex with version", `{"body": {"$regex": "WordPress ([\\d.]+)\\;version:\\1"}}`, true, "6.4.1"},
+		{"content type without parameters", `{"contenttype": {"$eq": "text/html"}}`, true, ""},
+		{"missing header", `{"headers.x-powered-by": {"$exists": true}}`, false, ""},
+		{"non-matching body", `{"body": {"$regex": "Drupal"}}`, false, ""},
+		{"$or", `{"$or": [{"body": {"$regex": "Drupal"}}, {"headers.server": {"$regex": "nginx"}}]}`, true, ""},
+		{"$and", `{"$and": [{"body": {"$regex": "WordPress"}}, {"headers.server": {"$regex": "apache"}}]}`, false, ""},
+		{"status unknown without a response", `{"status": {"$exists": true}}`, false, ""},
+		{"empty query", `{}`, false, ""},
+	}
+
+	qe := NewQueryEvaluator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, version := qe.Evaluate(parseQuery(t, tt.query), ctx)
+			if match != tt.match || version != tt.version {
+				t.Errorf("Evaluate(%s) = %v, %q; want %v, %q", tt.query, match, version, tt.match, tt.version)
+			}
+		})
+	}
+}
+
+func TestNewDetectionContextNilHeaders(t *testing.T) {
+	ctx := NewDetectionContext("<html>", nil)
+	if ctx.Headers == nil {
+		t.Fatal("Headers is nil")
+	}
+	match, _ := NewQueryEvaluator().Evaluate(parseQuery(t, `{"headers.server": {"$exists": false}}`), ctx)
+	if !match {
+		t.Error("a missing header does not satisfy $exists false")
+	}
+}
+
+func TestEvaluateAbsence(t *testing.T) {
+	fork := NewDetectionContext("", map[string]string{"X-Generator": "Forum", "X-Fork": "1"})
+	original := NewDetectionContext("", map[string]string{"X-Generator": "Forum"})
+
+	tests := []struct {
+		name        string
+		query       string
+		forkMatch   bool
+		originMatch bool
+	}{
+		{
+			"$not on a query",
+			`{"headers.x-generator": {"$exists": true}, "$not": {"headers.x-fork": {"$exists": true}}}`,
+			false, true,
+		},
+		{
+			"$nor",
+			`{"headers.x-generator": {"$exists": true}, "$nor": [{"headers.x-fork": {"$exists": true}}, {"body": {"$regex": "fork"}}]}`,
+			false, true,
+		},
+		{
+			"$exists false",
+			`{"headers.x-generator": {"$exists": true}, "headers.x-fork": {"$exists": false}}`,
+			false, true,
+		},
+		{
+			"field-level $not on a missing field",
+			`{"headers.x-generator": {"$exists": true}, "headers.x-fork": {"$not": {"$regex": "1"}}}`,
+			false, true,
+		},
+		{
+			"$not inside $and",
+			`{"$and": [{"headers.x-generator": {"$eq": "Forum"}}, {"$not": {"headers.x-fork": {"$eq": "1"}}}]}`,
+			false, true,
+		},
+		{
+			"presence of the marker",
+			`{"headers.x-generator": {"$exists": true}, "headers.x-fork": {"$exists": true}}`,
+			true, false,
+		},
+	}
+
+	qe := NewQueryEvaluator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := parseQuery(t, tt.query)
+			if match, _ := qe.Evaluate(query, fork); match != tt.forkMatch {
+				t.Errorf("fork: match = %v, want %v", match, tt.forkMatch)
+			}
+			if match, _ := qe.Evaluate(query, original); match != tt.originMatch {
+				t.Errorf("original: match = %v, want %v", match, tt.originMatch)
+			}
+		})
+	}
+}
+
+func TestEvaluateNotKeepsVersion(t *testing.T) {
+	ctx := NewDetectionContext("", map[string]string{"Server": "Apache/2.4.58"})
+	query := parseQuery(t, `{"headers.server": {"$regex": "Apache/([\\d.]+)\\;version:\\1"}, "$not": {"headers.x-powered-by": {"$exists": true}}}`)
+	if match, version := NewQueryEvaluator().Evaluate(query, ctx); !match || version != "2.4.58" {
+		t.Errorf("Evaluate = %v, %q; want true, \"2.4.58\"", match, version)
+	}
+}
+
+func TestEvaluateVersionIsDeterministic(t *testing.T) {
+	ctx := NewDetectionContext("jquery-3.7.1.js", map[string]string{"X-Version": "3.7"})
+	query := parseQuery(t, `{
+		"headers.x-version": {"$regex": "([\\d.]+)\\;version:\\1"},
+		"body": {"$regex": "jquery-([\\d.]+)\\.js\\;version:\\1"},
+		"$and": [{"headers.x-version": {"$regex": "(\\d+)\\;version:\\1"}}]
+	}`)
+
+	// The first key in sorted order that extracted a version decides
+	qe := NewQueryEvaluator()
+	for i := 0; i < 50; i++ {
+		if _, version := qe.Evaluate(query, ctx); version != "3" {
+			t.Fatalf("run %d: version %q, want \"3\" from $and", i, version)
+		}
+	}
+}
+
+func TestEvaluateFieldAllOperators(t *testing.T) {
+	ctx := NewDetectionContext(`<link href="/wp-content/themes/x.css">`, map[string]string{
+		"X-Powered-By": "PHP/8.2.1",
+	})
+
+	tests := []struct {
+		name    string
+		query   string
+		match   bool
+		version string
+	}{
+		{"$regex and $ne both hold", `{"body": {"$regex": "wp-", "$ne": "x"}}`, true, ""},
+		{"$ne fails", `{"headers.x-powered-by": {"$regex": "PHP", "$ne": "PHP/8.2.1"}}`, false, ""},
+		{"$regex fails", `{"headers.x-powered-by": {"$regex": "ASP", "$exists": true}}`, false, ""},
+		{"$nin fails", `{"headers.x-powered-by": {"$regex": "PHP", "$nin": ["PHP/8.2.1"]}}`, false, ""},
+		{"version with another operator", `{"headers.x-powered-by": {"$regex": "PHP/([\\d.]+)\\;version:\\1", "$exists": true}}`, true, "8.2.1"},
+		{"$not next to $regex", `{"headers.x-powered-by": {"$regex": "PHP", "$not": {"$regex": "PHP/7"}}}`, true, ""},
+		{"unknown operators are ignored", `{"body": {"$regex": "wp-", "$bogus": 1}}`, true, ""},
+		{"only unknown operators", `{"body": {"$bogus": 1}}`, false, ""},
+	}
+
+	qe := NewQueryEvaluator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, version := qe.Evaluate(parseQuery(t, tt.query), ctx)
+			if match != tt.match || version != tt.version {
+				t.Errorf("Evaluate(%s) = %v, %q; want %v, %q", tt.query, match, version, tt.match, tt.version)
+			}
+		})
+	}
+}
+
+func TestCollectQueryVersions(t *testing.T) {
+	ctx := NewDetectionContext(`<meta name="generator" content="WordPress 6.4.1">`, map[string]string{
+		"X-Generator": "WP 6",
+		"X-Build":     "9",
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			"prefix versions collapse",
+			`{"$or": [{"headers.x-generator": {"$regex": "WP (\\d+)\\;version:\\1"}}, {"body": {"$regex": "WordPress ([\\d.]+)\\;version:\\1"}}]}`,
+			[]string{"6.4.1"},
+		},
+		{
+			"non-matching $or branch",
+			`{"$or": [{"body": {"$regex": "Drupal"}, "headers.x-build": {"$regex": "(\\d+)\\;version:\\1"}}, {"body": {"$regex": "WordPress ([\\d.]+)\\;version:\\1"}}]}`,
+			[]string{"6.4.1"},
+		},
+		{
+			"negated branch",
+			`{"body": {"$regex": "WordPress"}, "$nor": [{"headers.x-build": {"$regex": "(\\d+)\\;version:\\1"}}]}`,
+			nil,
+		},
+		{
+			"different versions are kept",
+			`{"$and": [{"headers.x-build": {"$regex": "(\\d+)\\;version:\\1"}}, {"body": {"$regex": "WordPress ([\\d.]+)\\;version:\\1"}}]}`,
+			[]string{"9", "6.4.1"},
+		},
+	}
+
+	qe := NewQueryEvaluator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := qe.collectQueryVersions(parseQuery(t, tt.query), ctx)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("collectQueryVersions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropPrefixVersions(t *testing.T) {
+	got := dropPrefixVersions([]string{"6", "6.4.1", "6.4", "5.9", "61"})
+	if want := []string{"6.4.1", "5.9", "61"}; !slices.Equal(got, want) {
+		t.Errorf("dropPrefixVersions = %v, want %v", got, want)
+	}
+}
+
+func TestExtractVersionFrom(t *testing.T) {
+	ctx := NewDetectionContext(`<script src="/js/app-5.js"></script><script src="/js/app-5.2.10.js"></script>`, map[string]string{
+		"X-App-Major": "5",
+		"X-App-Minor": "2",
+	})
+	rules := []map[string]string{
+		{"headers.x-app-major": `(\d+)`},
+		{"body": `app-([\d.]+)\.js`},
+		{"headers.x-app-minor": `(\d+)`},
+	}
+
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{VersionFromFirst, "5"},
+		{"", "5"},
+		{VersionFromLongest, "5.2.10"},
+		{VersionFromJoin, "5.5.2"},
+	}
+
+	qe := NewQueryEvaluator()
+	for _, tt := range tests {
+		if got := qe.ExtractVersionFrom(rules, tt.strategy, ctx); got != tt.want {
+			t.Errorf("ExtractVersionFrom(%q) = %q, want %q", tt.strategy, got, tt.want)
+		}
+	}
+	if got, want := qe.ExtractVersions(rules, ctx), []string{"5", "5.2.10", "2"}; !slices.Equal(got, want) {
+		t.Errorf("ExtractVersions = %v, want %v", got, want)
+	}
+}
+
+func TestEvaluateCaseInsensitiveOptions(t *testing.T) {
+	ctx := NewDetectionContext("", map[string]string{
+		"Server":       " Apache ",
+		"X-Powered-By": "PHP/8.2",
+		"Via":          "1.1 Varnish",
+	})
+	ctx.StatusCode = 200
+
+	tests := []struct {
+		name  string
+		query string
+		match bool
+	}{
+		{"$eq is exact by default", `{"headers.server": {"$eq": "apache"}}`, false},
+		{"$eq with i", `{"headers.server": {"$eq": "apache", "$options": "i"}}`, true},
+		{"mixed-case operand", `{"headers.server": {"$eq": "APACHE", "$options": "i"}}`, true},
+		{"mixed-case header name", `{"headers.SERVER": {"$eq": "aPaChE", "$options": "i"}}`, true},
+		{"$ne with i", `{"headers.server": {"$ne": "apache", "$options": "i"}}`, false},
+		{"$ne with i on another value", `{"headers.server": {"$ne": "nginx", "$options": "i"}}`, true},
+		{"$in with i", `{"headers.x-powered-by": {"$in": ["php/8.1", "php/8.2"], "$options": "i"}}`, true},
+		{"$in is exact by default", `{"headers.x-powered-by": {"$in": ["php/8.2"]}}`, false},
+		{"$nin with i", `{"headers.x-powered-by": {"$nin": ["php/8.2"], "$options": "i"}}`, false},
+		{"inner whitespace is kept", `{"headers.via": {"$eq": "1.1  varnish", "$options": "i"}}`, false},
+		{"other options are ignored", `{"headers.server": {"$eq": "apache", "$options": "x"}}`, false},
+		{"missing header", `{"headers.x-generator": {"$eq": "apache", "$options": "i"}}`, false},
+		{"numbers are unaffected", `{"status": {"$eq": 200, "$options": "i"}}`, true},
+	}
+
+	qe := NewQueryEvaluator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if match, _ := qe.Evaluate(parseQuery(t, tt.query), ctx); match != tt.match {
+				t.Errorf("Evaluate(%s) = %v, want %v", tt.query, match, tt.match)
+			}
+		})
+	}
+}
+
+func TestEvaluateConcurrently(t *testing.T) {
+	// Shared contexts also exercise their lazily parsed JSON, HTML and links
+	contexts := []*DetectionContext{
+		NewDetectionContext(`<html><link rel="https://api.w.org/" href="/wp-json/"><meta name="generator" content="WordPress 6.4.1"></html>`,
+			map[string]string{"Server": "nginx/1.25.3", "Content-Type": "text/html"}),
+		NewDetectionContext(`{"result": "Geth/v1.13.14-stable", "plugins": [{"name": "akismet"}]}`,
+			map[string]string{"Content-Type": "application/json"}),
+	}
+	queries := []map[string]interface{}{
+		parseQuery(t, `{"body": {"$regex": "WordPress ([\\d.]+)\\;version:\\1"}}`),
+		parseQuery(t, `{"headers.server": {"$regex": "nginx/([\\d.]+)\\;version:\\1"}}`),
+		parseQuery(t, `{"json.result": {"$regex": "^Geth/v([\\d.]+)\\;version:\\1"}}`),
+		parseQuery(t, `{"json.plugins": {"$elemMatch": {"name": {"$regex": "^akis"}}}}`),
+		parseQuery(t, `{"link.rel": {"$in": ["https://api.w.org/"]}}`),
+		parseQuery(t, `{"body": {"$count": {"pattern": "[a-z]+", "$gte": 3}}}`),
+		parseQuery(t, `{"$or": [{"headers.x-powered-by": {"$regex": "PHP"}}, {"body|base64decode": {"$regex": "x"}}]}`),
+	}
+
+	// Results from a single goroutine, to compare against
+	qe := NewQueryEvaluator()
+	type outcome struct {
+		match   bool
+		version string
+	}
+	want := make([][]outcome, len(contexts))
+	for i, ctx := range contexts {
+		for _, q := range queries {
+			match, version := NewQueryEvaluator().Evaluate(q, NewDetectionContext(ctx.Body, ctx.Headers))
+			want[i] = append(want[i], outcome{match, version})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				for i, ctx := range contexts {
+					// A fresh pattern per iteration keeps the regex cache growing
+					qe.Evaluate(map[string]interface{}{"body": regex(fmt.Sprintf("g%d-%d", g, n))}, ctx)
+					for j, q := range queries {
+						if match, version := qe.Evaluate(q, ctx); match != want[i][j].match || version != want[i][j].version {
+							t.Errorf("context %d query %d: got %v, %q; want %v, %q", i, j, match, version, want[i][j].match, want[i][j].version)
+							return
+						}
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestEvaluateCount(t *testing.T) {
+	ad := `<ins class="adsbygoogle"></ins>`
+	ctx := NewDetectionContext("<html>"+ad+ad+ad+"</html>", map[string]string{"X-Cache": "HIT, HIT"})
+
+	tests := []struct {
+		name  string
+		query string
+		match bool
+	}{
+		{"$gte met", `{"body": {"$count": {"pattern": "adsbygoogle", "$gte": 3}}}`, true},
+		{"$gte not met", `{"body": {"$count": {"pattern": "adsbygoogle", "$gte": 4}}}`, false},
+		{"$gt", `{"body": {"$count": {"pattern": "adsbygoogle", "$gt": 2}}}`, true},
+		{"$eq", `{"body": {"$count": {"pattern": "<ins ", "$eq": 3}}}`, true},
+		{"$lt", `{"body": {"$count": {"pattern": "adsbygoogle", "$lt": 3}}}`, false},
+		{"$lte", `{"body": {"$count": {"pattern": "adsbygoogle", "$lte": 3}}}`, true},
+		{"combined bounds inside", `{"body": {"$count": {"pattern": "adsbygoogle", "$gte": 2, "$lte": 5}}}`, true},
+		{"combined bounds below", `{"body": {"$count": {"pattern": "adsbygoogle", "$gt": 3, "$lt": 10}}}`, false},
+		{"combined bounds above", `{"body": {"$count": {"pattern": "adsbygoogle", "$gte": 1, "$lt": 3}}}`, false},
+		{"no match counts zero", `{"body": {"$count": {"pattern": "doubleclick", "$eq": 0}}}`, true},
+		{"header field", `{"headers.x-cache": {"$count": {"pattern": "HIT", "$eq": 2}}}`, true},
+		{"$lt against a missing field", `{"headers.x-missing": {"$count": {"pattern": "HIT", "$lt": 1}}}`, true},
+		{"$gte against a missing field", `{"headers.x-missing": {"$count": {"pattern": "HIT", "$gte": 1}}}`, false},
+		{"$eq 0 against a missing field", `{"headers.x-missing": {"$count": {"pattern": "HIT", "$eq": 0}}}`, true},
+		{"no comparison", `{"body": {"$count": {"pattern": "adsbygoogle"}}}`, false},
+		{"unknown comparison", `{"body": {"$count": {"pattern": "adsbygoogle", "$ne": 1}}}`, false},
+		{"non-numeric bound", `{"body": {"$count": {"pattern": "adsbygoogle", "$gte": "3"}}}`, false},
+		{"invalid pattern", `{"body": {"$count": {"pattern": "(", "$gte": 0}}}`, false},
+	}
+
+	qe := NewQueryEvaluator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if match, _ := qe.Evaluate(parseQuery(t, tt.query), ctx); match != tt.match {
+				t.Errorf("Evaluate(%s) = %v, want %v", tt.query, match, tt.match)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package techdetect
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// SkippedProbe is a probe Options.ReadOnly keeps from being sent
+type SkippedProbe struct {
+	Technology string `json:"technology"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+}
+
+// isReadOnlyMethod checks if a request method only reads
+func isReadOnlyMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	return false
+}
+
+// withoutWrites drops the paths probed with a method other than GET or HEAD
+func withoutWrites(classifications []PathClassification) []PathClassification {
+	kept := classifications[:0]
+	for _, pc := range classifications {
+		if isReadOnlyMethod(pc.RequestConf.method()) {
+			kept = append(kept, pc)
+		}
+	}
+	return kept
+}
+
+// writeProbes lists the probes of the fingerprints sent with a method other than GET or
+// HEAD, sorted by technology
+func writeProbes(fingerprints map[string]Fingerprint) []SkippedProbe {
+	var skipped []SkippedProbe
+	for name, fp := range fingerprints {
+		for _, probe := range fp.Paths {
+			if method := probe.Request.method(); !isReadOnlyMethod(method) {
+				skipped = append(skipped, SkippedProbe{Technology: name, Method: method, Path: probe.Path})
+			}
+		}
+	}
+	sort.Slice(skipped, func(i, j int) bool {
+		if skipped[i].Technology != skipped[j].Technology {
+			return skipped[i].Technology < skipped[j].Technology
+		}
+		return skipped[i].Path < skipped[j].Path
+	})
+	return skipped
+}
+
+// SkippedProbes lists the probes Options.ReadOnly skips because of their request method;
+// it is empty without ReadOnly
+func (d *Detector) SkippedProbes() []SkippedProbe {
+	return d.skippedProbes
+}
@@ -0,0 +1,181 @@
+package techdetect
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+)
+
+// CapturedResponse is a probe response as the evaluator saw it, after following redirects
+type CapturedResponse struct {
+	Target      string            `json:"target,omitempty"` // URL the scan was started with
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`                 // requested probe URL
+	FinalURL    string            `json:"final_url,omitempty"` // where redirects ended up
+	StatusCode  int               `json:"status"`
+	ContentType string            `json:"content_type,omitempty"`
+	Headers     map[string]string `json:"headers"`
+	Cookies     map[string]string `json:"cookies,omitempty"` // every cookie set along the redirect chain
+	Body        string            `json:"body"`
+	LinkHeaders []LinkHeader      `json:"link_headers,omitempty"` // every Link header entry along the redirect chain
+}
+
+// recorder appends captured responses to a JSON Lines file
+type recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// record writes one captured response of a scan of target; write errors are ignored so
+// scans are never affected. A nil recorder records nothing.
+func (r *recorder) record(target, method, url string, dctx *DetectionContext) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(CapturedResponse{
+		Target:      target,
+		Method:      method,
+		URL:         url,
+		FinalURL:    dctx.URL,
+		StatusCode:  dctx.StatusCode,
+		ContentType: dctx.ContentType,
+		Headers:     dctx.Headers,
+		Cookies:     dctx.Cookies,
+		LinkHeaders: dctx.LinkHeaders,
+		Body:        dctx.Body,
+	})
+}
+
+// activeRecorder returns the recorder in use, nil unless recording
+func (hd *HTTPDetector) activeRecorder() *recorder {
+	hd.recorderMu.Lock()
+	defer hd.recorderMu.Unlock()
+	return hd.recorder
+}
+
+// swapRecorder installs r (nil to stop recording) and returns the previous recorder
+func (hd *HTTPDetector) swapRecorder(r *recorder) *recorder {
+	hd.recorderMu.Lock()
+	defer hd.recorderMu.Unlock()
+	previous := hd.recorder
+	hd.recorder = r
+	return previous
+}
+
+// RecordTo captures every response fetched by subsequent scans to a JSON Lines file
+// (created or truncated), for replaying later with ReplayFrom. Call StopRecording to
+// close the file. A scan already running when recording starts or stops may be
+// captured only in part.
+func (d *Detector) RecordTo(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create recording: %w", err)
+	}
+	previous := d.httpDetector.swapRecorder(&recorder{file: file, enc: json.NewEncoder(file)})
+	return previous.close()
+}
+
+// StopRecording stops capturing responses and closes the recording file
+func (d *Detector) StopRecording() error {
+	return d.httpDetector.swapRecorder(nil).close()
+}
+
+// close closes the recording file once the responses being written are done; later
+// writes fail and are ignored. A nil recorder has nothing to close.
+func (r *recorder) close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// ReadCaptures decodes captured responses written by RecordTo
+func ReadCaptures(r io.Reader) ([]CapturedResponse, error) {
+	var captures []CapturedResponse
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var capture CapturedResponse
+		if err := json.Unmarshal(scanner.Bytes(), &capture); err != nil {
+			return nil, fmt.Errorf("invalid capture on line %d: %w", line, err)
+		}
+		captures = append(captures, capture)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read captures: %w", err)
+	}
+	return captures, nil
+}
+
+// ReplayFrom runs detection against a recording made with RecordTo, without any network
+// access, producing one report per recorded scan target. Replaying a recording with an updated
+// fingerprint set shows how detections change.
+func (d *Detector) ReplayFrom(path string) ([]*Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer file.Close()
+
+	captures, err := ReadCaptures(file)
+	if err != nil {
+		return nil, err
+	}
+	return d.ReplayCaptures(captures), nil
+}
+
+// ReplayCaptures runs detection against captured responses, one report per scan target.
+// Probe paths resolve against the target as they did live, so a scan of
+// "https://example.com/app/" replays its "/app/..." probes. Captures without a target,
+// from older recordings, are replayed per origin.
+func (d *Detector) ReplayCaptures(captures []CapturedResponse) []*Report {
+	contexts := make(map[string]*DetectionContext)
+	var targets []string
+	seenTargets := make(map[string]bool)
+	for _, c := range captures {
+		target := c.Target
+		if target == "" {
+			u, err := url.Parse(c.URL)
+			if err != nil || u.Host == "" {
+				continue
+			}
+			target = u.Scheme + "://" + u.Host
+		}
+		if !seenTargets[target] {
+			seenTargets[target] = true
+			targets = append(targets, target)
+		}
+
+		key := c.Method + " " + c.URL
+		if _, exists := contexts[key]; exists {
+			continue
+		}
+		contexts[key] = &DetectionContext{
+			Body:        c.Body,
+			Headers:     c.Headers,
+			StatusCode:  c.StatusCode,
+			ContentType: c.ContentType,
+			URL:         c.FinalURL,
+			Cookies:     c.Cookies,
+			LinkHeaders: c.LinkHeaders,
+		}
+	}
+	sort.Strings(targets)
+
+	return d.analyzeTargets(targets, func(method, rawURL string) *DetectionContext {
+		return contexts[method+" "+rawURL]
+	})
+}
@@ -0,0 +1,96 @@
+package techdetect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordAndReplayUnderBasePath(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app/":
+			w.Write([]byte("<html>home</html>"))
+		case "/app/readme.html":
+			w.Write([]byte("<h1>WordPress</h1> Version 6.4.1"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	d := newTestEngine(t, srv, `{
+		"WordPress": {"paths": [{"path": "readme.html", "detect": {"body": {"$regex": "Version ([\\d.]+)\\;version:\\1"}}}]}
+	}`, Options{})
+
+	recording := filepath.Join(t.TempDir(), "scan.jsonl")
+	if err := d.RecordTo(recording); err != nil {
+		t.Fatal(err)
+	}
+	live, err := d.DetectHTTPOnly("http://target.test/app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if !hasTech(live.Technologies, "WordPress") {
+		t.Fatalf("live scan missed WordPress: %+v", live.Technologies)
+	}
+
+	reports, err := d.ReplayFrom(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].URL != "http://target.test/app/" {
+		t.Fatalf("replayed %d reports, want one for the scanned URL: %+v", len(reports), reports)
+	}
+	found := false
+	for _, tech := range reports[0].Technologies {
+		if tech.Name == "WordPress" && tech.Version == "6.4.1" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("replay missed WordPress 6.4.1 from /app/readme.html: %+v", reports[0].Technologies)
+	}
+}
+
+func TestRecordToWhileScanning(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	}))
+	defer srv.Close()
+
+	d := newTestEngine(t, srv, `{"Page": {"paths": [{"path": "/", "detect": {"body": {"$regex": "html"}}}]}}`, Options{})
+	dir := t.TempDir()
+
+	// Swapping the recorder during scans is safe (run with -race)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			d.DetectHTTPOnly("http://target.test/")
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := d.RecordTo(filepath.Join(dir, "scan.jsonl")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if err := d.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hasTech reports whether techs has a technology called name
+func hasTech(techs []Technology, name string) bool {
+	for _, tech := range techs {
+		if tech.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package techdetect
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Confidence levels assigned to detected technologies
+const (
+	ConfidenceDetected = 100 // matched by an HTTP or browser probe
+	ConfidenceImplied  = 50  // only implied by another detected technology
+)
+
+// Report is the complete analysis of a single URL
+type Report struct {
+	URL          string             `json:"url"`
+	FinalURL     string             `json:"final_url,omitempty"`
+	Mode         string             `json:"mode"`
+	Technologies []ReportTechnology `json:"technologies"`
+	FailedPaths  []string           `json:"failed_paths,omitempty"`
+	TLSInvalid   bool               `json:"tls_invalid,omitempty"` // certificate failed verification (Options.TLSFallback)
+	StartedAt    time.Time          `json:"started_at"`
+	Duration     time.Duration      `json:"duration_ns"`
+
+	// CategoryConfidence lists the technologies detected in each category, most
+	// confident first; several entries in one category flag an ambiguous result. The
+	// scores are the technologies' own Confidence, so they only tell detected technologies
+	// (ConfidenceDetected) from implied ones (ConfidenceImplied), not how strong the
+	// evidence for either was.
+	CategoryConfidence map[int][]TechScore `json:"category_confidence,omitempty"`
+
+	// Explain tells why each technology was detected; set when Options.Explain is enabled
+	Explain []Explanation `json:"explain,omitempty"`
+
+	// Headers holds the response headers of every fetched probe URL, after redirects;
+	// set when Options.IncludeHeaders is enabled
+	Headers map[string]map[string]string `json:"headers,omitempty"`
+
+	// Transaction lists every request of the HTTP stage and its response, redirect hops
+	// included, in the order made; set when Options.IncludeTransaction is enabled
+	Transaction []HTTPHop `json:"transaction,omitempty"`
+}
+
+// ReportTechnology is a detected technology enriched with fingerprint metadata
+type ReportTechnology struct {
+	Name        string   `json:"name"`
+	Version     string   `json:"version,omitempty"`
+	Versions    []string `json:"versions,omitempty"`
+	Categories  []int    `json:"categories,omitempty"`
+	CPE         string   `json:"cpe,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Website     string   `json:"website,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Confidence  int      `json:"confidence"`
+	Sources     []string `json:"sources"`         // detection stages: http, browser, implied
+	Hosts       []string `json:"hosts,omitempty"` // hosts it was found on, for merged www/apex reports
+
+	Metadata map[string]string `json:"metadata,omitempty"` // values extracted by "extract" rules
+}
+
+// TechScore is the confidence of a technology within one of its categories: its
+// ReportTechnology.Confidence, ConfidenceDetected or ConfidenceImplied
+type TechScore struct {
+	Name       string `json:"name"`
+	Confidence int    `json:"confidence"`
+}
+
+// Analyze runs detection on a URL and assembles everything known about the result into a Report.
+// When Options.PerURLDeadline is exceeded, the partial report is returned with ErrURLDeadline.
+func (d *Detector) Analyze(ctx context.Context, url string, useBrowser bool) (*Report, error) {
+	startedAt := time.Now()
+
+	run, err := d.run(ctx, url, useBrowser, d.pathClassifications)
+	if run == nil {
+		return nil, err
+	}
+
+	mode := "http"
+	if useBrowser {
+		mode = "hybrid"
+	}
+
+	return d.buildReport(url, mode, run, startedAt), err
+}
+
+// buildReport enriches the results of a detection run with fingerprint metadata
+func (d *Detector) buildReport(url, mode string, run *detectRun, startedAt time.Time) *Report {
+	report := &Report{
+		URL:          url,
+		FinalURL:     run.finalURL,
+		Mode:         mode,
+		Technologies: make([]ReportTechnology, 0, len(run.results)),
+		FailedPaths:  run.failedPaths,
+		TLSInvalid:   run.tlsInvalid,
+		StartedAt:    startedAt,
+		Headers:      run.headers,
+		Transaction:  run.transaction,
+	}
+
+	for name, tech := range run.results {
+		fp := d.fingerprints[name]
+		sources := run.sources[name]
+
+		confidence := ConfidenceDetected
+		if len(sources) == 1 && sources[0] == SourceImplied {
+			confidence = ConfidenceImplied
+		}
+
+		report.Technologies = append(report.Technologies, ReportTechnology{
+			Name:        name,
+			Version:     tech.Version,
+			Versions:    tech.Versions,
+			Categories:  tech.Cats,
+			CPE:         fp.CPE,
+			Tags:        tech.Tags,
+			Website:     fp.Website,
+			Description: fp.Description,
+			Confidence:  confidence,
+			Sources:     sources,
+			Metadata:    tech.Metadata,
+		})
+	}
+
+	sort.Slice(report.Technologies, func(i, j int) bool {
+		return report.Technologies[i].Name < report.Technologies[j].Name
+	})
+
+	report.CategoryConfidence = categoryConfidence(report.Technologies)
+
+	if run.matches != nil {
+		for _, tech := range report.Technologies {
+			report.Explain = append(report.Explain, Explanation{
+				Technology: tech.Name,
+				Source:     tech.Sources[0],
+				Matches:    run.matches[tech.Name],
+			})
+		}
+	}
+
+	report.Duration = time.Since(startedAt)
+	return report
+}
+
+// categoryConfidence groups the technology confidences by category, detected before implied
+func categoryConfidence(techs []ReportTechnology) map[int][]TechScore {
+	if len(techs) == 0 {
+		return nil
+	}
+
+	scores := make(map[int][]TechScore)
+	for _, tech := range techs {
+		for _, cat := range tech.Categories {
+			scores[cat] = append(scores[cat], TechScore{Name: tech.Name, Confidence: tech.Confidence})
+		}
+	}
+
+	for _, list := range scores {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Confidence > list[j].Confidence
+		})
+	}
+	return scores
+}
@@ -0,0 +1,238 @@
+package techdetect
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRequestCacheTTL is how long a cached response is reused when no TTL is given
+const DefaultRequestCacheTTL = 5 * time.Minute
+
+// MaxRequestCacheSize caps the bodies a RequestCache holds, in bytes; past it the oldest
+// responses are dropped
+const MaxRequestCacheSize = 64 * 1024 * 1024
+
+// RequestCache deduplicates identical probe requests within a batch scan. Concurrent
+// requests for the same key wait for the first one instead of fetching again. Failed
+// requests are not cached, and the cached bodies are kept under MaxRequestCacheSize. A
+// cache is safe for use by several detectors at once.
+type RequestCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]*cacheEntry
+	lastSweep time.Time
+
+	// Completed entries, oldest first, and the size of their bodies
+	order []*cacheEntry
+	size  int
+}
+
+// cacheEntry is a response that is being fetched or was fetched at a given time
+type cacheEntry struct {
+	key       string
+	done      chan struct{} // closed once dctx/err are set
+	dctx      *DetectionContext
+	err       error
+	cancelled bool // err came from the fetching caller's context, not the request
+	fetchedAt time.Time
+	size      int // body bytes counted in RequestCache.size, 0 once dropped
+}
+
+// NewRequestCache creates a request cache whose entries expire after ttl
+// (DefaultRequestCacheTTL if ttl <= 0)
+func NewRequestCache(ttl time.Duration) *RequestCache {
+	if ttl <= 0 {
+		ttl = DefaultRequestCacheTTL
+	}
+	return &RequestCache{
+		ttl:       ttl,
+		entries:   make(map[string]*cacheEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// fetch returns the cached response for key, or calls fetchFn once for all concurrent callers
+func (c *RequestCache) fetch(ctx context.Context, key string, fetchFn func() (*DetectionContext, error)) (*DetectionContext, error) {
+	c.mu.Lock()
+	entry, exists := c.entries[key]
+	if exists {
+		select {
+		case <-entry.done:
+			if time.Since(entry.fetchedAt) > c.ttl {
+				exists = false
+			}
+		default:
+			// Still in flight
+		}
+	}
+	if !exists {
+		if entry != nil {
+			// Expired, replaced below
+			c.drop(entry)
+		}
+		c.sweep()
+		entry = &cacheEntry{key: key, done: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+
+		entry.dctx, entry.err = fetchFn()
+		entry.cancelled = entry.err != nil && ctx.Err() != nil
+		entry.fetchedAt = time.Now()
+		c.mu.Lock()
+		if entry.err != nil {
+			// Let the next caller try again
+			if c.entries[key] == entry {
+				delete(c.entries, key)
+			}
+		} else if c.entries[key] == entry {
+			c.add(entry)
+		}
+		c.mu.Unlock()
+		close(entry.done)
+		return entry.dctx.clone(), entry.err
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.done:
+		if entry.cancelled {
+			// The scan that was fetching it stopped, which says nothing about the request
+			return c.fetch(ctx, key, fetchFn)
+		}
+		return entry.dctx.clone(), entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// add counts a fetched entry towards the size cap, dropping the oldest entries past it;
+// callers hold c.mu
+func (c *RequestCache) add(entry *cacheEntry) {
+	entry.size = len(entry.dctx.Body) + 1
+	c.size += entry.size
+	c.order = append(c.order, entry)
+	for c.size > MaxRequestCacheSize && len(c.order) > 0 {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		c.drop(oldest)
+	}
+}
+
+// drop removes a completed entry and its size; callers hold c.mu
+func (c *RequestCache) drop(entry *cacheEntry) {
+	if c.entries[entry.key] == entry {
+		delete(c.entries, entry.key)
+	}
+	c.size -= entry.size
+	entry.size = 0
+}
+
+// sweep drops expired entries at most once per TTL; callers hold c.mu
+func (c *RequestCache) sweep() {
+	if time.Since(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = time.Now()
+	kept := c.order[:0]
+	for _, entry := range c.order {
+		if time.Since(entry.fetchedAt) > c.ttl {
+			c.drop(entry)
+		} else if entry.size > 0 {
+			kept = append(kept, entry)
+		}
+	}
+	clear(c.order[len(kept):])
+	c.order = kept
+}
+
+// cacheKey identifies a request of the detector in its RequestCache: the request itself,
+// the detector settings that change its response (cacheScope), the cookies the detector
+// adds to it for the scanned target (Options.Cookies as scoped, and CookieJar), since a
+// cache shared by detectors must not hand out responses fetched with other credentials,
+// and the streamed body digest, which only holds what its own patterns matched
+func (hd *HTTPDetector) cacheKey(target, rawURL string, reqConfig *RequestConfig, digest *bodyDigest) string {
+	key := requestCacheKey(rawURL, reqConfig) + " " + hd.cacheScope
+
+	var session []string
+	if u, err := url.Parse(rawURL); err == nil {
+		cookies := hd.scopedCookies(target, u)
+		for _, name := range sortedKeys(cookies) {
+			session = append(session, name+"="+cookies[name])
+		}
+		if hd.cookieJar != nil {
+			for _, cookie := range hd.cookieJar.Cookies(u) {
+				session = append(session, "jar "+cookie.Name+"="+cookie.Value)
+			}
+		}
+	}
+	if len(session) > 0 {
+		sum := sha256.Sum256([]byte(strings.Join(session, "\n")))
+		key += " session " + hex.EncodeToString(sum[:])
+	}
+
+	if digest != nil {
+		key += " (streamed " + digest.key + ")"
+	}
+	return key
+}
+
+// requestCacheScope identifies the settings of a detector that change the responses it
+// gets or keeps for the same request: TLS verification, proxies, the HTTP client, how
+// redirect bodies are combined and whether hops are recorded. Detectors sharing a cache
+// only share responses when these match.
+func requestCacheScope(opts Options) string {
+	insecureHosts := slices.Clone(opts.InsecureHosts)
+	sort.Strings(insecureHosts)
+	scope, _ := json.Marshal([]interface{}{
+		opts.InsecureSkipVerify, insecureHosts, opts.TLSFallback,
+		opts.ProxyURL, opts.ProxyURLs, fmt.Sprintf("%p", opts.HTTPClient),
+		opts.CombineRedirectBodies, opts.RedirectBodySeparator, opts.MaxCombinedBodySize,
+		opts.IncludeTransaction,
+	})
+	sum := sha256.Sum256(scope)
+	return hex.EncodeToString(sum[:streamDigestKeySize])
+}
+
+// requestCacheKey identifies a request by method, full URL, headers, body and redirect policy
+func requestCacheKey(url string, reqConfig *RequestConfig) string {
+	method := "GET"
+	var headers []string
+	var body interface{}
+	if reqConfig != nil {
+		if reqConfig.Method != "" {
+			method = reqConfig.Method
+		}
+		for k, v := range reqConfig.Headers {
+			headers = append(headers, k+": "+v)
+		}
+		for name, value := range reqConfig.Cookies {
+			headers = append(headers, "cookie "+name+"="+value)
+		}
+		body = reqConfig.Body
+	}
+	sort.Strings(headers)
+	if !reqConfig.followRedirects() {
+		// The first response differs from the redirect target's
+		method += " (no redirects)"
+	}
+
+	h := sha256.New()
+	for _, header := range headers {
+		h.Write([]byte(header))
+		h.Write([]byte{'\n'})
+	}
+	if body != nil {
+		encoded, _ := json.Marshal(body)
+		h.Write(encoded)
+	}
+	return method + " " + url + " " + hex.EncodeToString(h.Sum(nil))
+}
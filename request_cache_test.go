@@ -0,0 +1,163 @@
+package techdetect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestCacheSeparatesCredentials(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if c, err := r.Cookie("session"); err == nil {
+			w.Write([]byte("hello " + c.Value))
+		}
+	}))
+	defer srv.Close()
+
+	cache := NewRequestCache(0)
+	alice := newTestDetector(t, srv, Options{RequestCache: cache, Cookies: map[string]string{"session": "alice"}})
+	bob := newTestDetector(t, srv, Options{RequestCache: cache, Cookies: map[string]string{"session": "bob"}})
+	ctx := context.Background()
+
+	first, err := alice.requestWithRetry(ctx, "http://target.test/", "http://target.test/", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := alice.requestWithRetry(ctx, "http://target.test/", "http://target.test/", nil, nil)
+	other, _ := bob.requestWithRetry(ctx, "http://target.test/", "http://target.test/", nil, nil)
+
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want 2 (one per session)", n)
+	}
+	if other.Body != "hello bob" {
+		t.Errorf("bob got %q", other.Body)
+	}
+	if first == again {
+		t.Error("callers share one cached context")
+	}
+	if again.Body != "hello alice" {
+		t.Errorf("cached body %q", again.Body)
+	}
+}
+
+func TestRequestCacheSizeCap(t *testing.T) {
+	cache := NewRequestCache(0)
+	body := strings.Repeat("x", MaxRequestCacheSize/2)
+	fetch := func(key string) {
+		cache.fetch(context.Background(), key, func() (*DetectionContext, error) {
+			return &DetectionContext{Body: body}, nil
+		})
+	}
+
+	fetch("a")
+	fetch("b")
+	fetch("c")
+	if _, ok := cache.entries["a"]; ok {
+		t.Error("oldest entry kept past the size cap")
+	}
+	if cache.size > MaxRequestCacheSize {
+		t.Errorf("cache holds %d bytes, cap %d", cache.size, MaxRequestCacheSize)
+	}
+	if _, ok := cache.entries["c"]; !ok {
+		t.Error("newest entry dropped")
+	}
+}
+
+func TestRequestCacheKeepsDetectorPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal dashboard"))
+	}))
+	defer srv.Close()
+
+	policy, err := NewHostPolicy(nil, []string{"internal.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewRequestCache(0)
+	open := newTestDetector(t, srv, Options{RequestCache: cache})
+	guarded := newTestDetector(t, srv, Options{RequestCache: cache, HostPolicy: policy})
+	target := "http://internal.test/"
+
+	if _, err := open.requestWithRetry(t.Context(), target, target, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The response the unrestricted detector cached is still refused
+	if dctx, err := guarded.requestWithRetry(t.Context(), target, target, nil, nil); !errors.Is(err, ErrHostDenied) {
+		t.Errorf("guarded detector got %v, %v; want ErrHostDenied", dctx, err)
+	}
+}
+
+func TestRequestCacheSeparatesSettings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Header().Set("Location", "/home")
+			w.WriteHeader(http.StatusFound)
+			w.Write([]byte("moved"))
+			return
+		}
+		w.Write([]byte("home"))
+	}))
+	defer srv.Close()
+
+	cache := NewRequestCache(0)
+	final := newTestDetector(t, srv, Options{RequestCache: cache})
+	combined := newTestDetector(t, srv, Options{RequestCache: cache, CombineRedirectBodies: true})
+	target := "http://target.test/"
+
+	first, err := final.requestWithRetry(t.Context(), target, target, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := combined.requestWithRetry(t.Context(), target, target, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Body != "home" || second.Body != "moved\nhome" {
+		t.Errorf("bodies %q and %q, want %q and %q", first.Body, second.Body, "home", "moved\nhome")
+	}
+}
+
+func TestRequestCacheWaiterOutlivesCancelledFetch(t *testing.T) {
+	cache := NewRequestCache(0)
+	fetcherCtx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	fetcherErr := make(chan error, 1)
+	go func() {
+		_, err := cache.fetch(fetcherCtx, "key", func() (*DetectionContext, error) {
+			close(started)
+			<-fetcherCtx.Done()
+			return nil, fetcherCtx.Err()
+		})
+		fetcherErr <- err
+	}()
+	<-started
+
+	waiter := make(chan *DetectionContext, 1)
+	go func() {
+		dctx, err := cache.fetch(context.Background(), "key", func() (*DetectionContext, error) {
+			return &DetectionContext{Body: "fetched again"}, nil
+		})
+		if err != nil {
+			t.Errorf("waiter: %v", err)
+		}
+		waiter <- dctx
+	}()
+
+	// Let the waiter find the entry in flight before the fetching scan is cancelled
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-fetcherErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("fetcher error %v, want context.Canceled", err)
+	}
+	if dctx := <-waiter; dctx == nil || dctx.Body != "fetched again" {
+		t.Errorf("waiter got %+v, want its own fetch", dctx)
+	}
+}
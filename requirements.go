@@ -0,0 +1,138 @@
+package techdetect
+
+import (
+	"sort"
+)
+
+// requirementsMet checks if every technology required by the probe was already detected
+func (pp *PathProbe) requirementsMet(results map[string]*Technology) bool {
+	for _, required := range pp.Requires {
+		if _, detected := results[required]; !detected {
+			return false
+		}
+	}
+	return true
+}
+
+// hasRunnableProbe checks if at least one probe of the classification can run with the current results
+func (pc *PathClassification) hasRunnableProbe(results map[string]*Technology) bool {
+	for _, probes := range pc.Technologies {
+		for i := range probes {
+			if probes[i].requirementsMet(results) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OrderByRequirements sorts path classifications so that paths able to detect a
+// technology are probed before paths whose probes require it. Paths without
+// requirements come first; dependency cycles keep their relative order. Within each
+// path, technologies are evaluated in the same order, see evaluationOrder.
+func OrderByRequirements(classifications []PathClassification) []PathClassification {
+	// tech name -> indices of paths that can detect it
+	techPaths := make(map[string][]int)
+	for i, pc := range classifications {
+		for techName := range pc.Technologies {
+			techPaths[techName] = append(techPaths[techName], i)
+		}
+	}
+
+	depth := make([]int, len(classifications))
+	state := make([]int, len(classifications)) // 0 = unvisited, 1 = visiting, 2 = done
+
+	var visit func(i int) int
+	visit = func(i int) int {
+		switch state[i] {
+		case 1:
+			return 0 // cycle, stop descending
+		case 2:
+			return depth[i]
+		}
+		state[i] = 1
+
+		d := 0
+		for _, probes := range classifications[i].Technologies {
+			for _, probe := range probes {
+				for _, required := range probe.Requires {
+					for _, j := range techPaths[required] {
+						if j == i {
+							continue
+						}
+						if dj := visit(j) + 1; dj > d {
+							d = dj
+						}
+					}
+				}
+			}
+		}
+
+		depth[i] = d
+		state[i] = 2
+		return d
+	}
+
+	indices := make([]int, len(classifications))
+	for i := range classifications {
+		indices[i] = i
+		visit(i)
+	}
+	sort.SliceStable(indices, func(a, b int) bool {
+		return depth[indices[a]] < depth[indices[b]]
+	})
+
+	ordered := make([]PathClassification, len(classifications))
+	for pos, i := range indices {
+		ordered[pos] = classifications[i]
+		ordered[pos].order = orderTechnologies(ordered[pos].Technologies)
+	}
+	return ordered
+}
+
+// evaluationOrder lists the technologies of a classification in the order their probes
+// are evaluated, so that a probe requiring a technology detected on the same path sees it
+func (pc *PathClassification) evaluationOrder() []string {
+	if len(pc.order) == len(pc.Technologies) {
+		return pc.order
+	}
+	return orderTechnologies(pc.Technologies)
+}
+
+// orderTechnologies sorts technologies topologically by the requirements of their
+// probes, required ones first and by name otherwise; cycles are broken by name
+func orderTechnologies(techs map[string][]PathProbe) []string {
+	names := make([]string, 0, len(techs))
+	for name := range techs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	order := make([]string, 0, len(names))
+	state := make(map[string]int, len(names)) // 0 = unvisited, 1 = visiting, 2 = done
+	var visit func(name string)
+	visit = func(name string) {
+		if state[name] != 0 {
+			return
+		}
+		state[name] = 1
+		var required []string
+		for _, probe := range techs[name] {
+			for _, req := range probe.Requires {
+				if _, onPath := techs[req]; onPath && req != name {
+					required = append(required, req)
+				}
+			}
+		}
+		sort.Strings(required)
+		for _, req := range required {
+			visit(req)
+		}
+		state[name] = 2
+		order = append(order, name)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return order
+}
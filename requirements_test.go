@@ -0,0 +1,75 @@
+package techdetect
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestOrderByRequirementsWithinPath(t *testing.T) {
+	fingerprints := map[string]Fingerprint{
+		"A-Plugin":  {Paths: []PathProbe{{Path: "/", Requires: []string{"WordPress"}}}},
+		"WordPress": {Paths: []PathProbe{{Path: "/", Requires: []string{"PHP"}}}},
+		"PHP":       {Paths: []PathProbe{{Path: "/"}}},
+		"Nginx":     {Paths: []PathProbe{{Path: "/"}}},
+	}
+
+	// Required technologies first, by name otherwise
+	want := []string{"PHP", "WordPress", "A-Plugin", "Nginx"}
+	for i := 0; i < 20; i++ {
+		classifications := OrderByRequirements(ClassifyByPath(fingerprints))
+		if len(classifications) != 1 {
+			t.Fatalf("got %d paths, want 1", len(classifications))
+		}
+		if got := classifications[0].evaluationOrder(); !slices.Equal(got, want) {
+			t.Fatalf("evaluation order = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRequiresOnSamePath(t *testing.T) {
+	detect := map[string]interface{}{"body": map[string]interface{}{"$regex": "wp-content"}}
+	fingerprints := map[string]Fingerprint{
+		"WordPress": {Paths: []PathProbe{{Path: "/", Detect: detect}}},
+		"Plugin":    {Paths: []PathProbe{{Path: "/", Detect: detect, Requires: []string{"WordPress"}}}},
+	}
+	classifications := OrderByRequirements(ClassifyByPath(fingerprints))
+	hd := NewHTTPDetectorWithConfig(Options{})
+
+	// Map order used to decide whether Plugin saw WordPress; it must on every run
+	for i := 0; i < 20; i++ {
+		results := make(map[string]*Technology)
+		hd.applyPathProbes(classifications[0], NewDetectionContext(`<link href="/wp-content/x.css">`, nil), nil, results, nil)
+		if _, ok := results["Plugin"]; !ok {
+			t.Fatalf("run %d: Plugin not detected, results %v", i, results)
+		}
+	}
+}
+
+func TestVersionFromLongestDropsPrefixes(t *testing.T) {
+	probe := PathProbe{
+		Path:   "/",
+		Detect: map[string]interface{}{"body": map[string]interface{}{"$regex": `app-(\d+)\.js\;version:\1`}},
+		ExtractVersion: []map[string]string{
+			{"headers.x-app-version": `(\d+\.\d+)`},
+			{"body": `app-([\d.]+)\.js`},
+		},
+		VersionFrom: VersionFromLongest,
+	}
+	classifications := OrderByRequirements(ClassifyByPath(map[string]Fingerprint{"App": {Paths: []PathProbe{probe}}}))
+	ctx := NewDetectionContext(`<script src="/app-5.js"></script><script src="/app-5.2.10.js"></script><script src="/app-4.9.1.js"></script>`,
+		map[string]string{"X-App-Version": "5.2"})
+
+	results := make(map[string]*Technology)
+	NewHTTPDetectorWithConfig(Options{}).applyPathProbes(classifications[0], ctx, nil, results, nil)
+	tech, ok := results["App"]
+	if !ok {
+		t.Fatal("App not detected")
+	}
+	if tech.Version != "5.2.10" {
+		t.Errorf("version %q, want \"5.2.10\"", tech.Version)
+	}
+	// "5" and "5.2" are partial captures of 5.2.10, the 4.9.1 copy stays
+	if want := []string{"5.2.10", "4.9.1"}; !slices.Equal(tech.Versions, want) {
+		t.Errorf("versions %v, want %v", tech.Versions, want)
+	}
+}
@@ -0,0 +1,91 @@
+package techdetect
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultMaxScripts is how many scripts a page's script probes fetch when no cap is given
+const DefaultMaxScripts = 10
+
+// ScriptSources returns the same-origin script URLs (<script src>) of an HTML body,
+// resolved against the page URL, in document order and without duplicates
+func (ctx *DetectionContext) ScriptSources() []string {
+	doc, ok := ctx.parsedHTML()
+	if !ok {
+		return nil
+	}
+	page, err := url.Parse(ctx.URL)
+	if err != nil || page.Host == "" {
+		return nil
+	}
+
+	var sources []string
+	seen := make(map[string]bool)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "script" {
+			for _, attr := range n.Attr {
+				if attr.Key != "src" {
+					continue
+				}
+				u, err := page.Parse(strings.TrimSpace(attr.Val))
+				if err != nil || u.Scheme != page.Scheme || !strings.EqualFold(u.Host, page.Host) {
+					continue
+				}
+				u.Fragment = ""
+				if src := u.String(); !seen[src] {
+					seen[src] = true
+					sources = append(sources, src)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return sources
+}
+
+// hasScriptProbe checks if any probe of the path matches against the page's scripts.
+// The scripts are only fetched once one of these probes has its requirements met.
+func (pc *PathClassification) hasScriptProbe() bool {
+	for _, probes := range pc.Technologies {
+		for _, probe := range probes {
+			if probe.Scripts {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scriptsContext fetches the first maxScripts same-origin scripts of a page and combines
+// their contents into one context for script probes. Failed and non-2xx fetches are left
+// out; it returns nil when no script could be fetched.
+func (hd *HTTPDetector) scriptsContext(page *DetectionContext, fetch func(scriptURL string) *DetectionContext) *DetectionContext {
+	sources := page.ScriptSources()
+	if len(sources) > hd.maxScripts {
+		sources = sources[:hd.maxScripts]
+	}
+
+	var bodies []string
+	for _, src := range sources {
+		script := fetch(src)
+		if script == nil || script.StatusCode < 200 || script.StatusCode > 299 || script.Body == "" {
+			continue
+		}
+		bodies = append(bodies, script.Body)
+	}
+	if len(bodies) == 0 {
+		return nil
+	}
+
+	scripts := NewDetectionContext(joinBodies(bodies, "\n", hd.maxCombinedBody), nil)
+	scripts.ContentType = "application/javascript"
+	scripts.URL = page.URL
+	return scripts
+}
@@ -0,0 +1,53 @@
+package techdetect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestScriptProbesRespectRequires(t *testing.T) {
+	var scriptFetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><script src="/app.js"></script></html>`))
+		case "/app.js":
+			scriptFetches.Add(1)
+			w.Header().Set("Content-Type", "application/javascript")
+			w.Write([]byte("/*! Widget v2.1.0 */"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	widget := func(requires ...string) map[string]Fingerprint {
+		return map[string]Fingerprint{
+			"Framework": fingerprint("/", map[string]interface{}{"headers.x-framework": map[string]interface{}{"$exists": true}}),
+			"Widget": {Paths: []PathProbe{
+				{Path: "/", Scripts: true, Requires: requires, Detect: map[string]interface{}{"body": regex(`Widget v([\d.]+)\;version:\1`)}},
+				{Path: "/", Scripts: true, Requires: requires, Detect: map[string]interface{}{"body": regex(`Widget`)}},
+			}},
+		}
+	}
+
+	hd := newTestDetector(t, srv, Options{})
+	results, _ := hd.DetectHTTP("http://target.test/", widget("Framework"))
+	if _, ok := results["Widget"]; ok {
+		t.Error("Widget detected without its required Framework")
+	}
+	if n := scriptFetches.Load(); n != 0 {
+		t.Errorf("scripts fetched %d times for a probe whose requirements were not met", n)
+	}
+
+	results, _ = hd.DetectHTTP("http://target.test/", widget())
+	if tech, ok := results["Widget"]; !ok || tech.Version != "2.1.0" {
+		t.Errorf("Widget = %+v, want version 2.1.0", tech)
+	}
+	if n := scriptFetches.Load(); n != 1 {
+		t.Errorf("scripts fetched %d times for two script probes, want 1", n)
+	}
+}
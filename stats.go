@@ -0,0 +1,120 @@
+package techdetect
+
+import (
+	"sort"
+	"strings"
+)
+
+// FingerprintStats summarizes the coverage of a fingerprint database
+type FingerprintStats struct {
+	Total              int         `json:"total"`
+	ByCategory         map[int]int `json:"by_category"`          // category ID -> fingerprint count
+	WithPaths          int         `json:"with_paths"`           // fingerprints with at least one HTTP probe
+	WithBrowser        int         `json:"with_browser"`         // fingerprints with at least one browser probe
+	WithVersion        int         `json:"with_version"`         // fingerprints able to extract a version
+	WithImplies        int         `json:"with_implies"`         // fingerprints implying other technologies
+	Uncategorized      int         `json:"uncategorized"`        // fingerprints without any category
+	TotalPathProbes    int         `json:"total_path_probes"`    // number of HTTP probes across all fingerprints
+	TotalBrowserProbes int         `json:"total_browser_probes"` // number of browser probes across all fingerprints
+}
+
+// ComputeStats walks the fingerprints and aggregates coverage tallies
+func ComputeStats(fingerprints map[string]Fingerprint) FingerprintStats {
+	stats := FingerprintStats{
+		ByCategory: make(map[int]int),
+	}
+
+	for _, fp := range fingerprints {
+		stats.Total++
+
+		if len(fp.Cats) == 0 {
+			stats.Uncategorized++
+		}
+		for _, cat := range fp.Cats {
+			stats.ByCategory[cat]++
+		}
+
+		if len(fp.Paths) > 0 {
+			stats.WithPaths++
+		}
+		if len(fp.Browser) > 0 {
+			stats.WithBrowser++
+		}
+		if len(fp.Implies) > 0 {
+			stats.WithImplies++
+		}
+		if fp.hasVersionExtraction() {
+			stats.WithVersion++
+		}
+
+		stats.TotalPathProbes += len(fp.Paths)
+		stats.TotalBrowserProbes += len(fp.Browser)
+	}
+
+	return stats
+}
+
+// SortedCategories returns the category IDs present in the stats in ascending order
+func (s FingerprintStats) SortedCategories() []int {
+	cats := make([]int, 0, len(s.ByCategory))
+	for cat := range s.ByCategory {
+		cats = append(cats, cat)
+	}
+	sort.Ints(cats)
+	return cats
+}
+
+// hasVersionExtraction checks if any probe of the fingerprint can yield a version
+func (fp *Fingerprint) hasVersionExtraction() bool {
+	for _, probe := range fp.Paths {
+		if len(probe.ExtractVersion) > 0 || queryHasVersionSyntax(probe.Detect) {
+			return true
+		}
+	}
+	for i := range fp.Browser {
+		if fp.Browser[i].HasVersionCapability() {
+			return true
+		}
+	}
+	return false
+}
+
+// queryHasVersionSyntax checks if a query contains a $regex with \;version: extraction
+func queryHasVersionSyntax(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, sub := range v {
+			if key == "$regex" {
+				if pattern, ok := sub.(string); ok && strings.Contains(pattern, "\\;version:") {
+					return true
+				}
+				continue
+			}
+			if queryHasVersionSyntax(sub) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, sub := range v {
+			if queryHasVersionSyntax(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Stats loads all fingerprints and returns their coverage statistics
+func (l *Loader) Stats() (*FingerprintStats, error) {
+	fingerprints, err := l.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+	stats := ComputeStats(fingerprints)
+	return &stats, nil
+}
+
+// Stats returns coverage statistics for the fingerprints loaded by the detector
+func (d *Detector) Stats() FingerprintStats {
+	return ComputeStats(d.fingerprints)
+}
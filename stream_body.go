@@ -0,0 +1,300 @@
+package techdetect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+// Limits of streamed body evaluation (Options.StreamBody)
+const (
+	streamChunkSize     = 64 * 1024   // bytes read per step
+	streamOverlap       = 8 * 1024    // longest match found across chunk boundaries
+	maxStreamedDigest   = 1024 * 1024 // size cap of the matches kept per pattern; all are counted
+	streamDigestKeySize = 8           // bytes of the pattern set hash in request cache keys
+)
+
+// bodyDigest reads a response body in chunks, keeping only the regions its patterns
+// match, so a path whose probes only run regexes against the body never holds all of it
+type bodyDigest struct {
+	patterns []*regexp.Regexp
+	sources  []string // source of each pattern, as the evaluator compiles it
+	key      string   // identifies the pattern set, requests with other sets differ
+}
+
+// streamedBody is what a bodyDigest kept of a body. Each pattern only ever sees its own
+// matches, so patterns can't match across the excerpts of others, and $count uses the
+// number of matches rather than re-counting the excerpts.
+type streamedBody struct {
+	matches map[string]string // pattern source -> its matches in order, one per line
+	counts  map[string]int    // pattern source -> number of matches
+	first   map[string]int64  // pattern source -> byte offset of its first match in the body
+	size    int64             // bytes of body read, for $exists
+}
+
+// merge appends the excerpts of the next response of a redirect chain, placing its
+// offsets after sep as the combined body would
+func (sb *streamedBody) merge(next *streamedBody, sep string) {
+	if next.size == 0 {
+		return
+	}
+	base := sb.size
+	if base > 0 {
+		base += int64(len(sep))
+	}
+	for source, text := range next.matches {
+		if sb.matches[source] == "" {
+			sb.matches[source] = text
+			sb.first[source] = base + next.first[source]
+		} else if len(sb.matches[source])+len(text) <= maxStreamedDigest {
+			sb.matches[source] += text
+		}
+	}
+	for source, n := range next.counts {
+		sb.counts[source] += n
+	}
+	sb.size = base + next.size
+}
+
+// text returns every kept excerpt, by pattern, for what needs a single body: the body
+// field of explanations and recordings
+func (sb *streamedBody) text() string {
+	var text strings.Builder
+	for _, source := range sortedKeys(sb.matches) {
+		text.WriteString(sb.matches[source])
+	}
+	return text.String()
+}
+
+// newBodyDigest prepares streamed reading for a path, or returns nil when a probe needs
+// the full body: a body operator other than $regex, $count and $exists, a pattern that
+// isn't streamable, a transform, the json, link, extensions or any fields, or a script probe
+func (hd *HTTPDetector) newBodyDigest(pc *PathClassification) *bodyDigest {
+	var sources []string
+	for _, probes := range pc.Technologies {
+		for _, probe := range probes {
+			if probe.Scripts || !queryBodyPatterns(probe.Detect, &sources) ||
+				!rulesBodyPatterns(probe.ExtractVersion, &sources) {
+				return nil
+			}
+			for _, rules := range probe.Extract {
+				if !rulesBodyPatterns(rules, &sources) {
+					return nil
+				}
+			}
+		}
+	}
+
+	sort.Strings(sources)
+	digest := &bodyDigest{}
+	h := sha256.New()
+	for i, source := range sources {
+		if i > 0 && source == sources[i-1] {
+			continue
+		}
+		re, err := hd.evaluator.compile(source)
+		if err != nil {
+			// Never matches during evaluation either
+			continue
+		}
+		digest.patterns = append(digest.patterns, re)
+		digest.sources = append(digest.sources, source)
+		h.Write([]byte(source))
+		h.Write([]byte{0})
+	}
+	digest.key = hex.EncodeToString(h.Sum(nil)[:streamDigestKeySize])
+	return digest
+}
+
+// queryBodyPatterns adds the body regexes of a query to patterns; false when the query
+// uses the body in a way a digest can't answer
+func queryBodyPatterns(query map[string]interface{}, patterns *[]string) bool {
+	for key, value := range query {
+		switch key {
+		case "$or", "$and", "$nor":
+			conditions, _ := value.([]interface{})
+			for _, cond := range conditions {
+				if condMap, ok := cond.(map[string]interface{}); ok && !queryBodyPatterns(condMap, patterns) {
+					return false
+				}
+			}
+		case "$not":
+			if condMap, ok := value.(map[string]interface{}); ok && !queryBodyPatterns(condMap, patterns) {
+				return false
+			}
+		default:
+			if !fieldBodyPatterns(key, value, patterns) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fieldBodyPatterns adds the regexes of one field condition when the field is the body
+func fieldBodyPatterns(fieldPath string, condition interface{}, patterns *[]string) bool {
+	if !readsBody(fieldPath) {
+		return true
+	}
+	if fieldPath != "body" {
+		return false
+	}
+	condMap, ok := condition.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	for operator, operand := range condMap {
+		switch operator {
+		case "$regex":
+			pattern, ok := operand.(string)
+			if !ok || !streamable(strings.Split(pattern, "\\;version:")[0]) {
+				return false
+			}
+			*patterns = append(*patterns, strings.Split(pattern, "\\;version:")[0])
+		case "$count":
+			spec, _ := operand.(map[string]interface{})
+			pattern, ok := spec["pattern"].(string)
+			if !ok || !streamable(pattern) {
+				return false
+			}
+			*patterns = append(*patterns, pattern)
+		case "$not":
+			if !fieldBodyPatterns(fieldPath, operand, patterns) {
+				return false
+			}
+		case "$exists":
+			// Answered by the size of the body
+		case "$options":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// rulesBodyPatterns adds the body patterns of extraction rules
+func rulesBodyPatterns(rules []map[string]string, patterns *[]string) bool {
+	for _, rule := range rules {
+		for field, pattern := range rule {
+			if !readsBody(field) {
+				continue
+			}
+			if field != "body" || !streamable(pattern) {
+				return false
+			}
+			*patterns = append(*patterns, pattern)
+		}
+	}
+	return true
+}
+
+// streamable checks if a pattern matches the same in a window of the body as in all of
+// it: anchors and word boundaries would also match at the edges of the window
+func streamable(pattern string) bool {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		// Never matches during evaluation either
+		return true
+	}
+	return !hasEdgeAssertion(re)
+}
+
+// hasEdgeAssertion checks if a parsed pattern contains an anchor or word boundary
+func hasEdgeAssertion(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasEdgeAssertion(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// readsBody checks if a field is derived from the response body
+func readsBody(fieldPath string) bool {
+	base, _ := splitTransforms(fieldPath)
+	switch strings.Split(base, ".")[0] {
+	case "body", "json", "link", "extensions", AnyField:
+		return true
+	}
+	return false
+}
+
+// read consumes a body and returns what its patterns matched: for each pattern, every
+// match in the order found, one per line, and the number of matches. Matches longer than
+// streamOverlap may be cut short where they cross a chunk boundary.
+func (bd *bodyDigest) read(r io.Reader) (*streamedBody, error) {
+	excerpts := make([]strings.Builder, len(bd.patterns))
+	counts := make([]int, len(bd.patterns))
+	first := make([]int64, len(bd.patterns))
+	resume := make([]int, len(bd.patterns)) // where the next match may start, in window offsets
+
+	var size, start int64 // start is the body offset of the window
+	window := make([]byte, 0, streamChunkSize+streamOverlap)
+	chunk := make([]byte, streamChunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return nil, err
+		}
+		size += int64(n)
+		window = append(window, chunk[:n]...)
+
+		// Matches starting in the overlap are left to the next window, which sees more
+		cut := len(window)
+		if !eof {
+			cut -= streamOverlap
+		}
+
+		text := string(window)
+		for i, re := range bd.patterns {
+			for _, loc := range re.FindAllStringIndex(text, -1) {
+				if loc[0] >= cut {
+					break
+				}
+				if loc[0] < resume[i] || loc[0] == loc[1] {
+					continue
+				}
+				if counts[i] == 0 {
+					first[i] = start + int64(loc[0])
+				}
+				counts[i]++
+				resume[i] = loc[1]
+				if excerpts[i].Len()+loc[1]-loc[0] < maxStreamedDigest {
+					excerpts[i].WriteString(text[loc[0]:loc[1]])
+					excerpts[i].WriteByte('\n')
+				}
+			}
+			resume[i] = max(resume[i]-cut, 0)
+		}
+
+		if eof {
+			body := &streamedBody{
+				matches: make(map[string]string),
+				counts:  make(map[string]int),
+				first:   make(map[string]int64),
+				size:    size,
+			}
+			for i, source := range bd.sources {
+				if counts[i] > 0 {
+					body.matches[source] = excerpts[i].String()
+					body.counts[source] = counts[i]
+					body.first[source] = first[i]
+				}
+			}
+			return body, nil
+		}
+		window = append(window[:0], window[cut:]...)
+		start += int64(cut)
+	}
+}
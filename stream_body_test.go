@@ -0,0 +1,127 @@
+package techdetect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamBodyMatchesFullBody(t *testing.T) {
+	// Spans several chunks, with more occurrences than a digest once kept
+	page := "<p>alpha-widget beta-widget</p>\n" +
+		strings.Repeat("<ins class=adsbygoogle></ins>\n", 1500) +
+		strings.Repeat("x", 3*streamChunkSize) +
+		"\n<!-- Version 2.4.1 -->\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	count := func(spec map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"body": map[string]interface{}{"$count": spec}}
+	}
+	fingerprints := map[string]Fingerprint{
+		"ManyAds":  fingerprint("/", count(map[string]interface{}{"pattern": "adsbygoogle", "$gte": 1200.0})),
+		"ExactAds": fingerprint("/", count(map[string]interface{}{"pattern": "adsbygoogle", "$eq": 1500.0})),
+		"FewAds":   fingerprint("/", count(map[string]interface{}{"pattern": "adsbygoogle", "$lt": 1000.0})),
+		"Alpha":    fingerprint("/", map[string]interface{}{"body": regex(`alpha-widget`)}),
+		"Beta":     fingerprint("/", map[string]interface{}{"body": regex(`beta-widget`)}),
+		// Only true if the excerpts of other patterns were joined into one text
+		"LineStart": fingerprint("/", map[string]interface{}{"body": regex(`(?m)^beta-widget`)}),
+		"Joined":    fingerprint("/", map[string]interface{}{"body": regex(`widget\nbeta`)}),
+		"Versioned": {Paths: []PathProbe{{
+			Path:           "/",
+			Detect:         map[string]interface{}{"body": regex(`<!-- Version`)},
+			ExtractVersion: []map[string]string{{"body": `Version ([\d.]+)`}},
+		}}},
+	}
+
+	full, _ := newTestDetector(t, srv, Options{}).DetectHTTP("http://target.test/", fingerprints)
+	streamed, _ := newTestDetector(t, srv, Options{StreamBody: true}).DetectHTTP("http://target.test/", fingerprints)
+
+	if !reflect.DeepEqual(streamed, full) {
+		t.Errorf("streamed results = %+v, want the full body's %+v", streamed, full)
+	}
+	for _, name := range []string{"ManyAds", "ExactAds", "Alpha", "Beta", "Versioned"} {
+		if _, ok := streamed[name]; !ok {
+			t.Errorf("%s not detected with a streamed body", name)
+		}
+	}
+	for _, name := range []string{"FewAds", "LineStart", "Joined"} {
+		if _, ok := streamed[name]; ok {
+			t.Errorf("%s detected with a streamed body", name)
+		}
+	}
+	if v := streamed["Versioned"].Version; v != "2.4.1" {
+		t.Errorf("Versioned version = %q, want 2.4.1", v)
+	}
+}
+
+func TestStreamBodyEdgeAssertions(t *testing.T) {
+	// Each marker starts the second window, where a window-local ^, \A or \b would match
+	filler := strings.Repeat("a", streamChunkSize-streamOverlap)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(filler + "MARKER" + strings.Repeat("x", 2*streamChunkSize)))
+	}))
+	defer srv.Close()
+
+	fingerprints := map[string]Fingerprint{
+		"TextStart": fingerprint("/", map[string]interface{}{"body": regex(`\AMARKER`)}),
+		"LineStart": fingerprint("/", map[string]interface{}{"body": regex(`(?m)^MARKER`)}),
+		"WordStart": fingerprint("/", map[string]interface{}{"body": regex(`\bMARKER`)}),
+		"Counted": fingerprint("/", map[string]interface{}{"body": map[string]interface{}{
+			"$count": map[string]interface{}{"pattern": `^MARKER`, "$gte": 1.0},
+		}}),
+		"Unanchored": fingerprint("/", map[string]interface{}{"body": regex(`aMARKER`)}),
+	}
+	for _, streamBody := range []bool{false, true} {
+		results, _ := newTestDetector(t, srv, Options{StreamBody: streamBody}).DetectHTTP("http://target.test/", fingerprints)
+		for _, name := range []string{"TextStart", "LineStart", "WordStart", "Counted"} {
+			if _, ok := results[name]; ok {
+				t.Errorf("StreamBody %v: %s detected", streamBody, name)
+			}
+		}
+		if _, ok := results["Unanchored"]; !ok {
+			t.Errorf("StreamBody %v: Unanchored not detected", streamBody)
+		}
+	}
+}
+
+func TestStreamBodyExplain(t *testing.T) {
+	page := strings.Repeat("x", 2*streamChunkSize) + "<!-- Widget 3.1 -->" + strings.Repeat("y", 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	d := newTestEngine(t, srv, `{
+		"Widget": {"cats": [1], "paths": [{"path": "/", "detect": {"body": {"$regex": "Widget ([\\d.]+)\\;version:\\1"}}}]}
+	}`, Options{StreamBody: true, Explain: true, SnippetLength: 40})
+	report, err := d.Analyze(context.Background(), "http://target.test/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Explain) != 1 || len(report.Explain[0].Matches) != 1 {
+		t.Fatalf("explanations = %+v, want one match", report.Explain)
+	}
+	m := report.Explain[0].Matches[0]
+	want := Match{
+		Path:     "/",
+		Field:    "body",
+		Operator: "$regex",
+		Matched:  "Widget 3.1",
+		Version:  "3.1",
+		Offset:   strings.Index(page, "Widget"),
+		Length:   len("Widget 3.1"),
+		Size:     len(page),
+	}
+	if m != want {
+		t.Errorf("match = %+v, want %+v", m, want)
+	}
+}
@@ -0,0 +1,37 @@
+package techdetect
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hostTLSTransport skips TLS verification only for requests to listed hosts
+type hostTLSTransport struct {
+	secure   http.RoundTripper
+	insecure http.RoundTripper
+	hosts    []string
+}
+
+// RoundTrip dispatches the request to the verifying or non-verifying transport by host
+func (t *hostTLSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if matchesHostList(req.URL.Hostname(), t.hosts) {
+		return t.insecure.RoundTrip(req)
+	}
+	return t.secure.RoundTrip(req)
+}
+
+// matchesHostList checks host against a list of hostnames; "*.example.com" matches any subdomain
+func matchesHostList(host string, hosts []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range hosts {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
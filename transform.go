@@ -0,0 +1,81 @@
+package techdetect
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Field transforms, appended to a field path with "|", e.g. "body|base64decode"
+const (
+	TransformBase64Decode = "base64decode" // decoded base64 segments (standard or URL alphabet)
+	TransformHexDecode    = "hexdecode"    // decoded hex segments
+)
+
+var (
+	// base64Segment matches runs long enough to be encoded data rather than words
+	base64Segment = regexp.MustCompile(`[A-Za-z0-9+/_-]{16,}={0,2}`)
+	hexSegment    = regexp.MustCompile(`(?:[0-9a-fA-F]{2}){8,}`)
+)
+
+// splitTransforms separates a field path from its "|" transforms
+func splitTransforms(fieldPath string) (string, []string) {
+	parts := strings.Split(fieldPath, "|")
+	return parts[0], parts[1:]
+}
+
+// applyTransform decodes the encoded segments of a field value, returning the decoded
+// texts joined by newlines. Segments that don't decode to printable text are left out;
+// ok is false when none does or the transform is unknown.
+func applyTransform(transform, value string) (string, bool) {
+	var segments []string
+	var decode func(string) ([]byte, error)
+	switch strings.TrimSpace(transform) {
+	case TransformBase64Decode:
+		segments = base64Segment.FindAllString(value, -1)
+		decode = decodeBase64
+	case TransformHexDecode:
+		segments = hexSegment.FindAllString(value, -1)
+		decode = hex.DecodeString
+	default:
+		return "", false
+	}
+
+	var decoded []string
+	for _, segment := range segments {
+		data, err := decode(segment)
+		if err != nil || !isPrintableText(data) {
+			continue
+		}
+		decoded = append(decoded, string(data))
+	}
+	if len(decoded) == 0 {
+		return "", false
+	}
+	return strings.Join(decoded, "\n"), true
+}
+
+// decodeBase64 decodes a segment in the standard or URL alphabet, padded or not
+func decodeBase64(segment string) ([]byte, error) {
+	unpadded := strings.TrimRight(segment, "=")
+	if strings.ContainsAny(unpadded, "-_") {
+		return base64.RawURLEncoding.DecodeString(unpadded)
+	}
+	return base64.RawStdEncoding.DecodeString(unpadded)
+}
+
+// isPrintableText checks that decoded bytes are UTF-8 text rather than binary data
+func isPrintableText(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package techdetect
+
+import "testing"
+
+func TestApplyTransform(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform string
+		value     string
+		want      string
+		ok        bool
+	}{
+		{"padded base64", TransformBase64Decode, `data-config="eyJnZW5lcmF0b3IiOiJBY21lQ01TIDQuMi4wIiwidGhlbWUiOiJkYXJrIn0="`, `{"generator":"AcmeCMS 4.2.0","theme":"dark"}`, true},
+		{"URL alphabet without padding", TransformBase64Decode, "?state=Z2VuZXJhdG9yPUFjbWVDTVMgNC4yLjE_eD4-", "generator=AcmeCMS 4.2.1?x>>", true},
+		{"short runs are words", TransformBase64Decode, "plain words only", "", false},
+		{"binary data is left out", TransformBase64Decode, "iVBORw0KGgoAAAANSUhEUgAAAAEAAAAB", "", false},
+		{"hex", TransformHexDecode, "x-build: 41636d65434d532f342e322e30;", "AcmeCMS/4.2.0", true},
+		{"short hex", TransformHexDecode, "deadbeef", "", false},
+		{"unknown transform", "rot13", "eyJnZW5lcmF0b3IiOiJBY21lQ01TIn0=", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := applyTransform(tt.transform, tt.value)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("applyTransform(%q) = %q, %v; want %q, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEvaluateTransforms(t *testing.T) {
+	ctx := NewDetectionContext(
+		`<div id="app" data-config="eyJnZW5lcmF0b3IiOiJBY21lQ01TIDQuMi4wIiwidGhlbWUiOiJkYXJrIn0="></div>`,
+		map[string]string{
+			"X-Build": "41636d65434d532f342e322e30",
+			"X-Data":  "51574e745a554e4e557941314c6a41754d434270626e4e705a47553d",
+		},
+	)
+
+	tests := []struct {
+		name    string
+		query   string
+		match   bool
+		version string
+	}{
+		{"base64 generator", `{"body|base64decode": {"$regex": "\"generator\":\"AcmeCMS ([\\d.]+)\\;version:\\1"}}`, true, "4.2.0"},
+		{"raw body does not match", `{"body": {"$regex": "AcmeCMS"}}`, false, ""},
+		{"hex header", `{"headers.x-build|hexdecode": {"$regex": "^AcmeCMS/([\\d.]+)\\;version:\\1"}}`, true, "4.2.0"},
+		{"chained", `{"headers.x-data|hexdecode|base64decode": {"$eq": "AcmeCMS 5.0.0 inside"}}`, true, ""},
+		{"nothing decodes", `{"headers.x-build|base64decode": {"$exists": true}}`, false, ""},
+		{"missing field", `{"headers.x-missing|hexdecode": {"$exists": false}}`, true, ""},
+	}
+
+	qe := NewQueryEvaluator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, version := qe.Evaluate(parseQuery(t, tt.query), ctx)
+			if match != tt.match || version != tt.version {
+				t.Errorf("Evaluate(%s) = %v, %q; want %v, %q", tt.query, match, version, tt.match, tt.version)
+			}
+		})
+	}
+
+	rules := []map[string]string{{"body|base64decode": `"generator":"AcmeCMS ([\d.]+)"`}}
+	if v := qe.ExtractVersion(rules, ctx); v != "4.2.0" {
+		t.Errorf("ExtractVersion from decoded body = %q, want \"4.2.0\"", v)
+	}
+}
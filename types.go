@@ -1,49 +1,257 @@
 package techdetect
 
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
 // Technology represents a detected technology
 type Technology struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`            // primary version: first found, or per Options.VersionPolicy
+	Versions []string `json:"versions,omitempty"` // every distinct version found, e.g. two bundled jQuery copies
+	Tags     []string `json:"tags,omitempty"`     // labels from the fingerprint
+	Cats     []int    `json:"cats,omitempty"`     // category IDs from the fingerprint, for the detected version
+
+	// Metadata holds named values extracted by the probes' "extract" rules, e.g. theme or build
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// HasTag checks if the technology carries a tag (case-insensitive)
+func (t *Technology) HasTag(tag string) bool {
+	return HasTag(t.Tags, tag)
+}
+
+// HasTag checks if tags, e.g. those of a ReportTechnology, include tag (case-insensitive)
+func HasTag(tags []string, tag string) bool {
+	for _, label := range tags {
+		if strings.EqualFold(label, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// addMetadata records an extracted value, keeping the first one found for each name
+func (t *Technology) addMetadata(name, value string) {
+	if value == "" {
+		return
+	}
+	if t.Metadata == nil {
+		t.Metadata = make(map[string]string)
+	}
+	if _, exists := t.Metadata[name]; !exists {
+		t.Metadata[name] = value
+	}
 }
 
+// addVersion records a version, keeping the first one found as the primary Version
+func (t *Technology) addVersion(version string) {
+	if version == "" {
+		return
+	}
+	if t.Version == "" {
+		t.Version = version
+	}
+	for _, v := range t.Versions {
+		if v == version {
+			return
+		}
+	}
+	t.Versions = append(t.Versions, version)
+}
+
+// ResultSchemaVersion is the version of the JSON output shape (ScanResult, BatchResults,
+// HostResults, HostBatchResults, TechnologyRecord). It is bumped when a field is renamed,
+// removed or changes type; new optional fields are added without a bump. Only top-level
+// documents and lines carry it: results nested in a batch or host group leave it unset.
+const ResultSchemaVersion = 1
+
 // ScanResult represents the result for a single URL in JSON/JSONL format
 type ScanResult struct {
-	URL          string            `json:"url"`
-	Technologies map[string]string `json:"technologies"`    // tech name -> version
-	Mode         string            `json:"mode"`            // "http", "browser", or "hybrid"
-	Error        string            `json:"error,omitempty"` // error message if scan failed
+	URL          string              `json:"url"`
+	Technologies map[string]string   `json:"technologies"`          // tech name -> version
+	Versions     map[string][]string `json:"versions,omitempty"`    // tech name -> all versions, only for techs with several
+	Mode         string              `json:"mode"`                  // "http", "browser", or "hybrid"
+	Error        string              `json:"error,omitempty"`       // error message if scan failed
+	Explain      []Explanation       `json:"explain,omitempty"`     // why each technology was detected, with -explain
+	TLSInvalid   bool                `json:"tls_invalid,omitempty"` // certificate failed verification, see -tls-fallback
+	Hosts        map[string][]string `json:"hosts,omitempty"`       // tech name -> hosts it was found on, with -include-apex
+
+	// Metadata holds the values extracted by "extract" rules: tech name -> name -> value
+	Metadata map[string]map[string]string `json:"metadata,omitempty"`
+
+	// Headers holds the response headers of every fetched probe URL, with -include-headers
+	Headers map[string]map[string]string `json:"headers,omitempty"`
+
+	// Transaction lists every request of the scan and its response, with -include-transaction
+	Transaction []HTTPHop `json:"transaction,omitempty"`
+
+	// Diff is how the technologies changed since the -baseline results
+	Diff *ScanDiff `json:"diff,omitempty"`
+
+	SchemaVersion int `json:"schema_version,omitempty"` // ResultSchemaVersion on a top-level line, unset when nested
+}
+
+// TechnologyRecord is a single (url, technology) pair for the ndjson-tech output format
+type TechnologyRecord struct {
+	URL        string   `json:"url"`
+	Technology string   `json:"technology"`
+	Version    string   `json:"version"`
+	Categories []int    `json:"categories"`
+	Confidence int      `json:"confidence"`
+	Source     string   `json:"source"` // first stage that detected it: http, browser or implied
+	Tags       []string `json:"tags,omitempty"`
+	Hosts      []string `json:"hosts,omitempty"` // hosts it was found on, with -include-apex
+
+	Metadata map[string]string `json:"metadata,omitempty"` // values extracted by "extract" rules
+
+	SchemaVersion int `json:"schema_version,omitempty"` // ResultSchemaVersion on a top-level line, unset when nested
 }
 
 // BatchResults wraps multiple scan results for JSON array output
 type BatchResults struct {
-	Results []ScanResult `json:"results"`
+	SchemaVersion int           `json:"schema_version"`     // ResultSchemaVersion
+	Database      *DatabaseInfo `json:"database,omitempty"` // fingerprint rule set used for the scan
+	Results       []ScanResult  `json:"results"`
+}
+
+// HostResults merges the scan results of every endpoint (path, port, scheme) of one host
+type HostResults struct {
+	Host         string              `json:"host"`
+	Technologies map[string]string   `json:"technologies"`       // merged across endpoints
+	Versions     map[string][]string `json:"versions,omitempty"` // every distinct version seen on the host
+	Endpoints    []ScanResult        `json:"endpoints"`
+
+	SchemaVersion int `json:"schema_version,omitempty"` // ResultSchemaVersion on a top-level line, unset when nested
+}
+
+// HostBatchResults wraps host-grouped results for JSON output
+type HostBatchResults struct {
+	SchemaVersion int           `json:"schema_version"` // ResultSchemaVersion
+	Database      *DatabaseInfo `json:"database,omitempty"`
+	Hosts         []HostResults `json:"hosts"`
 }
 
 // Fingerprint represents the detection rules for a technology
 type Fingerprint struct {
 	Cats        []int          `json:"cats"`
 	Implies     []string       `json:"implies,omitempty"`
+	Tags        []string       `json:"tags,omitempty"` // free-form labels such as "eol", "open-source", "saas"
 	Paths       []PathProbe    `json:"paths,omitempty"`
 	Browser     []BrowserProbe `json:"browser,omitempty"`
 	Description string         `json:"description,omitempty"`
 	Website     string         `json:"website,omitempty"`
 	Icon        string         `json:"icon,omitempty"`
 	CPE         string         `json:"cpe,omitempty"`
+
+	// BrowserRequired marks a technology only the browser stage can reliably detect,
+	// even though it has HTTP probes; see Options.BrowserRequiredOnly
+	BrowserRequired bool `json:"browser_required,omitempty"`
+
+	// VersionRules change the cats or add tags for some versions, see Classify
+	VersionRules []VersionRule `json:"version_rules,omitempty"`
+}
+
+// NeedsBrowser reports whether the technology is browser-required: marked so, or
+// having browser probes but no HTTP probes
+func (fp *Fingerprint) NeedsBrowser() bool {
+	return fp.BrowserRequired || (len(fp.Paths) == 0 && len(fp.Browser) > 0)
 }
 
 // PathProbe represents an HTTP-based detection probe
 type PathProbe struct {
-	Path           string                 `json:"path"`
+	Path           string                 `json:"path"` // "/" (the target page) when empty
 	Request        *RequestConfig         `json:"request,omitempty"`
 	Detect         map[string]interface{} `json:"detect"`
 	ExtractVersion []map[string]string    `json:"extract_version,omitempty"`
+	VersionFrom    string                 `json:"version_from,omitempty"`  // how extract_version rules combine, see VersionFrom* constants
+	ContentTypes   []string               `json:"content_types,omitempty"` // only evaluate for these media types
+	Requires       []string               `json:"requires,omitempty"`      // only run once these techs are detected
+	Sensitive      bool                   `json:"sensitive,omitempty"`     // noisy or risky to request; skipped unless Options.AllowSensitive
+	Scripts        bool                   `json:"scripts,omitempty"`       // match the combined same-origin scripts the page loads, not the page
+
+	// Extract names rules like extract_version for other values, e.g. "theme" or "build";
+	// stored in Technology.Metadata ("version" adds a version)
+	Extract map[string][]map[string]string `json:"extract,omitempty"`
 }
 
+// How the captures of several extract_version rules are combined
+const (
+	VersionFromFirst   = "first"   // first capture of the first matching rule (default)
+	VersionFromLongest = "longest" // most specific capture across all rules (most components, then longest)
+	VersionFromJoin    = "join"    // first capture of every matching rule, joined with "."
+)
+
 // RequestConfig represents optional HTTP request configuration
 type RequestConfig struct {
 	Method  string            `json:"method,omitempty"`
 	Headers map[string]string `json:"headers,omitempty"`
-	Body    interface{}       `json:"body,omitempty"`
+	Body    interface{}       `json:"body,omitempty"`    // string sent as-is, anything else JSON-encoded; {host} etc. substituted and escaped
+	Timeout float64           `json:"timeout,omitempty"` // seconds, overrides RequestTimeout for this request
+	Cookies map[string]string `json:"cookies,omitempty"` // sent on every hop, replacing cookies of the same name
+
+	// FollowRedirects set to false returns the first response as-is, e.g. to match a 301 and its Location
+	FollowRedirects *bool `json:"follow_redirects,omitempty"`
+}
+
+// method returns the HTTP method for a request with this config
+func (rc *RequestConfig) method() string {
+	if rc == nil || rc.Method == "" {
+		return "GET"
+	}
+	return rc.Method
+}
+
+// followRedirects reports whether a request with this config follows redirects (default true)
+func (rc *RequestConfig) followRedirects() bool {
+	return rc == nil || rc.FollowRedirects == nil || *rc.FollowRedirects
+}
+
+// encodeBody returns the request body and its default Content-Type: strings are sent
+// as-is (text/plain), other values JSON-encoded (application/json)
+func (rc *RequestConfig) encodeBody() ([]byte, string, error) {
+	if rc == nil || rc.Body == nil {
+		return nil, "", nil
+	}
+	if text, ok := rc.Body.(string); ok {
+		return []byte(text), "text/plain; charset=utf-8", nil
+	}
+	data, err := json.Marshal(rc.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode request body: %w", err)
+	}
+	return data, "application/json", nil
+}
+
+// contentType returns the Content-Type a request with this config sends its body with:
+// the probe's Content-Type header, or the default of the body
+func (rc *RequestConfig) contentType() string {
+	for name, value := range rc.Headers {
+		if strings.EqualFold(name, "Content-Type") {
+			return value
+		}
+	}
+	if _, ok := rc.Body.(string); ok {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// timeout returns the per-hop deadline for a request with this config
+func (rc *RequestConfig) timeout() time.Duration {
+	if rc == nil || rc.Timeout <= 0 {
+		return RequestTimeout
+	}
+	return time.Duration(rc.Timeout * float64(time.Second))
 }
 
 // BrowserProbe represents a browser-based detection probe
@@ -55,14 +263,175 @@ type BrowserProbe struct {
 
 // FingerprintDB represents the entire fingerprint database
 type FingerprintDB struct {
-	Apps map[string]Fingerprint `json:"apps"`
+	Version string                 `json:"version,omitempty"` // optional version of this file's rule set
+	Updated string                 `json:"updated,omitempty"` // optional last-updated date (RFC 3339 or YYYY-MM-DD)
+	Apps    map[string]Fingerprint `json:"apps"`
+}
+
+// HTTPHop is one request of a probe and the response to it: a redirect, or the response
+// detection ran against
+type HTTPHop struct {
+	Probe      string            `json:"probe"` // probe path the request was made for
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	StatusCode int               `json:"status"`
+	Location   string            `json:"location,omitempty"` // redirect target as sent
+	Headers    map[string]string `json:"headers,omitempty"`  // first value of each response header
 }
 
 // DetectionContext holds data available for detection
 type DetectionContext struct {
-	Body       string
-	Headers    map[string]string
-	StatusCode int
+	Body        string
+	Headers     map[string]string
+	StatusCode  int    // status of the final response, 0 when unknown
+	ContentType string // media type of the final response, without parameters
+	URL         string // final URL after following redirects
+	TLSInvalid  bool   // fetched only after certificate verification failed (Options.TLSFallback)
+
+	// Cookies set along the redirect chain, name -> first value; when nil, cookies are
+	// read from the Set-Cookie header
+	Cookies map[string]string
+
+	// Entries of the Link headers along the redirect chain, in order; when nil, they are
+	// read from the Link header
+	LinkHeaders []LinkHeader
+
+	// Hops are the requests that led to the response, with Options.IncludeTransaction
+	Hops []HTTPHop
+
+	// Matches of each body pattern when the body was streamed (Options.StreamBody);
+	// Body then only holds their excerpts. Never modified, so copies share it.
+	streamed *streamedBody
+
+	// Lazily decoded JSON body for json.* field paths
+	jsonOnce  sync.Once
+	jsonValue interface{}
+	jsonValid bool
+
+	// Lazily parsed HTML body for link-derived fields
+	htmlOnce  sync.Once
+	htmlDoc   *html.Node
+	linksOnce sync.Once
+	links     []Link
+
+	// Array element an $elemMatch sub-query is evaluated against
+	element   interface{}
+	inElement bool
+}
+
+// NewDetectionContext creates a detection context from raw response data so queries
+// can be evaluated without fetching anything. Header names are matched case-insensitively.
+func NewDetectionContext(body string, headers map[string]string) *DetectionContext {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	contentType := ""
+	for k, v := range headers {
+		if strings.EqualFold(k, "Content-Type") {
+			contentType = normalizeContentType(v)
+			break
+		}
+	}
+	return &DetectionContext{
+		Body:        body,
+		Headers:     headers,
+		ContentType: contentType,
+	}
+}
+
+// clone copies the response data of a context, so a cached response handed to several
+// callers is never shared; lazily parsed bodies are parsed again by the copy
+func (ctx *DetectionContext) clone() *DetectionContext {
+	if ctx == nil {
+		return nil
+	}
+	return &DetectionContext{
+		Body:        ctx.Body,
+		Headers:     maps.Clone(ctx.Headers),
+		StatusCode:  ctx.StatusCode,
+		ContentType: ctx.ContentType,
+		URL:         ctx.URL,
+		TLSInvalid:  ctx.TLSInvalid,
+		Cookies:     maps.Clone(ctx.Cookies),
+		LinkHeaders: slices.Clone(ctx.LinkHeaders),
+		Hops:        slices.Clone(ctx.Hops),
+		streamed:    ctx.streamed,
+	}
+}
+
+// streamedBody returns the streamed matches when a field path is the whole streamed body
+func (ctx *DetectionContext) streamedBody(fieldPath string) *streamedBody {
+	if fieldPath != "body" || ctx.inElement {
+		return nil
+	}
+	return ctx.streamed
+}
+
+// cookie returns the value of a cookie set by the response; names match case-insensitively
+func (ctx *DetectionContext) cookie(name string) (string, bool) {
+	cookies := ctx.cookies()
+	if value, ok := cookies[name]; ok {
+		return value, true
+	}
+	for k, v := range cookies {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// cookies returns the cookies set along the redirect chain; when Cookies is nil, they
+// are read from the Set-Cookie header
+func (ctx *DetectionContext) cookies() map[string]string {
+	if ctx.Cookies != nil {
+		return ctx.Cookies
+	}
+	cookies := make(map[string]string)
+	for k, v := range ctx.Headers {
+		if strings.EqualFold(k, "Set-Cookie") {
+			addCookie(cookies, v)
+		}
+	}
+	return cookies
+}
+
+// addCookie records the cookie of a Set-Cookie header value, keeping the first value of each name
+func addCookie(cookies map[string]string, setCookie string) {
+	cookie, err := http.ParseSetCookie(setCookie)
+	if err != nil {
+		return
+	}
+	if _, exists := cookies[cookie.Name]; !exists {
+		cookies[cookie.Name] = cookie.Value
+	}
+}
+
+// normalizeContentType strips parameters from a Content-Type value and lowercases it
+func normalizeContentType(value string) string {
+	if idx := strings.Index(value, ";"); idx != -1 {
+		value = value[:idx]
+	}
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// AppliesToContentType checks if the probe should be evaluated for a response media type.
+// Entries may use a "type/*" wildcard; probes without content_types apply to everything.
+func (pp *PathProbe) AppliesToContentType(contentType string) bool {
+	if len(pp.ContentTypes) == 0 {
+		return true
+	}
+	for _, allowed := range pp.ContentTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if strings.HasSuffix(allowed, "/*") {
+			if strings.HasPrefix(contentType, strings.TrimSuffix(allowed, "*")) {
+				return true
+			}
+		} else if allowed == contentType {
+			return true
+		}
+	}
+	return false
 }
 
 // HasDetectionCapability checks if browser probe can detect technology
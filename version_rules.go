@@ -0,0 +1,145 @@
+package techdetect
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// VersionRule gives a technology other categories or extra tags for some of its versions,
+// e.g. a library that became a framework in 3.0
+type VersionRule struct {
+	Range string   `json:"version_range"`  // space-separated comparators, all must hold: ">=3.0 <4"
+	Cats  []int    `json:"cats,omitempty"` // replace the fingerprint's cats
+	Tags  []string `json:"tags,omitempty"` // added to the fingerprint's tags
+}
+
+// Classify returns the categories and tags of the technology at a detected version: the
+// fingerprint's own, with the cats of the first matching version rule and the tags of
+// every matching rule applied. Rules never match an unknown version. The returned slices
+// are copies, so results can be modified without touching the shared fingerprint.
+func (fp *Fingerprint) Classify(version string) ([]int, []string) {
+	cats, tags := fp.Cats, fp.Tags
+	if version == "" || len(fp.VersionRules) == 0 {
+		return slices.Clone(cats), slices.Clone(tags)
+	}
+
+	catsSet := false
+	for _, rule := range fp.VersionRules {
+		if !VersionInRange(version, rule.Range) {
+			continue
+		}
+		if len(rule.Cats) > 0 && !catsSet {
+			cats = rule.Cats
+			catsSet = true
+		}
+		for _, tag := range rule.Tags {
+			if !containsFold(tags, tag) {
+				tags = append(tags[:len(tags):len(tags)], tag)
+			}
+		}
+	}
+	return slices.Clone(cats), slices.Clone(tags)
+}
+
+// containsFold checks if a list holds a value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// VersionInRange checks a version against space-separated comparators (>=, >, <=, <, =,
+// or none for equality), all of which must hold. Invalid or empty ranges never match.
+func VersionInRange(version, versionRange string) bool {
+	comparators := strings.Fields(versionRange)
+	if version == "" || len(comparators) == 0 {
+		return false
+	}
+
+	for _, comparator := range comparators {
+		op := strings.TrimRight(comparator, "0123456789.vV-+abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_")
+		bound := comparator[len(op):]
+		if bound == "" {
+			return false
+		}
+
+		cmp := CompareVersions(version, bound)
+		var ok bool
+		switch op {
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "=", "==", "":
+			ok = cmp == 0
+		default:
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareVersions compares dotted versions component by component, numerically where
+// both components are numbers ("1.10" > "1.9"); missing components count as 0. A leading
+// "v" is ignored. It returns -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(strings.ToLower(a), "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(strings.ToLower(b), "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		ca, cb := "0", "0"
+		if i < len(pa) {
+			ca = pa[i]
+		}
+		if i < len(pb) {
+			cb = pb[i]
+		}
+		if c := compareVersionComponent(ca, cb); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareVersionComponent compares the leading numbers of two components, then the rest
+// as text; a component without suffix sorts after one with ("1" > "1rc1")
+func compareVersionComponent(a, b string) int {
+	na, restA := leadingNumber(a)
+	nb, restB := leadingNumber(b)
+	switch {
+	case na < nb:
+		return -1
+	case na > nb:
+		return 1
+	case restA == restB:
+		return 0
+	case restA == "":
+		return 1
+	case restB == "":
+		return -1
+	case restA < restB:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// leadingNumber splits a version component into its leading number and the remainder
+func leadingNumber(component string) (int, string) {
+	end := 0
+	for end < len(component) && component[end] >= '0' && component[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(component[:end])
+	return n, strings.TrimLeft(component[end:], "-_+")
+}
@@ -0,0 +1,141 @@
+package techdetect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// wellKnownFile is a file a test site serves
+type wellKnownFile struct {
+	contentType string
+	body        string
+}
+
+const keycloakDiscovery = `{
+  "issuer": "https://sso.example.com/realms/acme",
+  "authorization_endpoint": "https://sso.example.com/realms/acme/protocol/openid-connect/auth",
+  "token_endpoint": "https://sso.example.com/realms/acme/protocol/openid-connect/token",
+  "jwks_uri": "https://sso.example.com/realms/acme/protocol/openid-connect/certs",
+  "response_types_supported": ["code", "id_token", "code id_token"]
+}`
+
+func TestDetectHTTPWellKnown(t *testing.T) {
+	sites := map[string]map[string]wellKnownFile{
+		"keycloak.test": {
+			"/realms/master/.well-known/openid-configuration": {"application/json", keycloakDiscovery},
+		},
+		"tenant.test": {
+			"/realms/acme/.well-known/openid-configuration": {"application/json", keycloakDiscovery},
+		},
+		"auth0.test": {
+			"/.well-known/openid-configuration": {"application/json", `{
+  "issuer": "https://acme.eu.auth0.com/",
+  "authorization_endpoint": "https://acme.eu.auth0.com/authorize",
+  "jwks_uri": "https://acme.eu.auth0.com/.well-known/jwks.json",
+  "mfa_challenge_endpoint": "https://acme.eu.auth0.com/mfa/challenge"
+}`},
+		},
+		"okta.test": {
+			"/.well-known/openid-configuration": {"application/json; charset=UTF-8", `{
+  "issuer": "https://acme.okta.com",
+  "authorization_endpoint": "https://acme.okta.com/oauth2/v1/authorize",
+  "jwks_uri": "https://acme.okta.com/oauth2/v1/keys"
+}`},
+		},
+		"cognito.test": {
+			"/.well-known/openid-configuration": {"application/json", `{
+  "issuer": "https://cognito-idp.eu-west-1.amazonaws.com/eu-west-1_AbCdEf123",
+  "authorization_endpoint": "https://acme.auth.eu-west-1.amazoncognito.com/oauth2/authorize",
+  "jwks_uri": "https://cognito-idp.eu-west-1.amazonaws.com/eu-west-1_AbCdEf123/.well-known/jwks.json"
+}`},
+		},
+		// A single-page app answering every path with its shell
+		"spa.test": {
+			"*": {"text/html", `<html><body><div id="app">{"issuer": "https://acme.okta.com"}</div></body></html>`},
+		},
+		// Discovery served as JSON but missing the required endpoints
+		"partial.test": {
+			"/.well-known/openid-configuration": {"application/json", `{"issuer": "https://partial.test"}`},
+		},
+		"hackerone.test": {
+			"/.well-known/security.txt": {"text/plain; charset=utf-8", "Contact: https://hackerone.com/acme\nExpires: 2030-01-01T00:00:00.000Z\n"},
+		},
+		"bugcrowd.test": {
+			"/.well-known/security.txt": {"text/plain", "# Report issues\nPolicy: https://bugcrowd.com/acme\nContact: mailto:security@bugcrowd.test\n"},
+		},
+		"apps.test": {
+			"/.well-known/assetlinks.json": {"application/json", `[{
+  "relation": ["delegate_permission/common.handle_all_urls"],
+  "target": {"namespace": "android_app", "package_name": "com.acme.app"}
+}]`},
+			"/.well-known/apple-app-site-association": {"application/octet-stream", `{
+  "applinks": {"details": [{"appIDs": ["ABCDE12345.com.acme.app"], "components": [{"/": "/orders/*"}]}]}
+}`},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files := sites[r.Host]
+		file, ok := files[r.URL.Path]
+		if !ok {
+			file, ok = files["*"]
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", file.contentType)
+		w.Write([]byte(file.body))
+	}))
+	defer srv.Close()
+
+	all, err := NewLoader("").LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprints := make(map[string]Fingerprint)
+	for _, name := range []string{
+		"Keycloak", "Auth0", "Okta", "Amazon Cognito", "OpenID Connect",
+		"HackerOne", "Bugcrowd", "Android App Links", "Apple Universal Links",
+	} {
+		if _, ok := all[name]; !ok {
+			t.Fatalf("no %s fingerprint", name)
+		}
+		fingerprints[name] = all[name]
+	}
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		// Only Keycloak probes its master realm
+		{"http://keycloak.test/", []string{"Keycloak"}},
+		// The discovery document of a tenant is found under the scanned path
+		{"http://tenant.test/realms/acme/", []string{"Keycloak", "OpenID Connect"}},
+		{"http://auth0.test/", []string{"Auth0", "OpenID Connect"}},
+		{"http://okta.test/", []string{"Okta", "OpenID Connect"}},
+		{"http://cognito.test/", []string{"Amazon Cognito", "OpenID Connect"}},
+		{"http://spa.test/", nil},
+		{"http://partial.test/", nil},
+		{"http://hackerone.test/", []string{"HackerOne"}},
+		{"http://bugcrowd.test/", []string{"Bugcrowd"}},
+		{"http://apps.test/", []string{"Android App Links", "Apple Universal Links"}},
+	}
+
+	hd := newTestDetector(t, srv, Options{})
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			results, _ := hd.DetectHTTP(tt.url, fingerprints)
+			var detected []string
+			for name := range results {
+				detected = append(detected, name)
+			}
+			sort.Strings(detected)
+			if !slices.Equal(detected, tt.want) {
+				t.Errorf("detected %v, want %v", detected, tt.want)
+			}
+		})
+	}
+}